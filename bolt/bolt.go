@@ -0,0 +1,357 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bolt implements a CAS engine backed by a bbolt database, for
+// a portable, single-file store.
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/net/context"
+)
+
+var (
+	// blobsBucket maps digests to blob content.
+	blobsBucket = []byte("blobs")
+
+	// metadataBucket maps digests to JSON-encoded metadata.
+	metadataBucket = []byte("metadata")
+)
+
+// openTimeout is how long NewEngine waits for another process to
+// release its lock on the database file.
+var openTimeout = time.Second
+
+// metadata is stored for each blob in metadataBucket.
+type metadata struct {
+	// Size is the size of the blob in bytes.
+	Size int64 `json:"size"`
+
+	// Created is when the blob was first stored.
+	Created time.Time `json:"created"`
+}
+
+// Engine is a CAS engine which stores blobs in a bbolt database.
+// Blobs are held in memory while they are read or written, so it is
+// best suited to stores of small to medium blobs.
+type Engine struct {
+	db *bbolt.DB
+
+	// Algorithm selects the Algorithm used for Put.
+	Algorithm digest.Algorithm
+}
+
+// NewEngine opens (creating if necessary) the database at path.
+// Only one Engine may have the database open at a time.
+func NewEngine(ctx context.Context, path string) (engine casengine.DigestListerEngine, err error) {
+	db, err := bbolt.Open(path, 0666, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) (err error) {
+		for _, name := range [][]byte{blobsBucket, metadataBucket} {
+			_, err = tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Engine{
+		db:        db,
+		Algorithm: digest.SHA256,
+	}, nil
+}
+
+// New creates a new CAS-engine instance from a configuration object,
+// for the protocol registry.  The config must be a map[string]string
+// or a map[string]interface{} with string values.  The required
+// 'path' property is the database file, which is resolved against
+// baseURI if baseURI is a file: URI and path is relative.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	var path string
+	switch configMap := config.(type) {
+	case map[string]string:
+		path = configMap["path"]
+	case map[string]interface{}:
+		value, ok := configMap["path"]
+		if ok {
+			path, ok = value.(string)
+			if !ok {
+				return nil, fmt.Errorf("bolt config 'path' is not a string: %v", value)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("bolt config is not a map[string]string: %v", config)
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("bolt config missing required 'path' property: %v", config)
+	}
+
+	if baseURI != nil && baseURI.Scheme == "file" {
+		path = baseURI.ResolveReference(&url.URL{Path: path}).Path
+	}
+
+	return NewEngine(ctx, path)
+}
+
+// Get implements Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	var data []byte
+	err = engine.db.View(func(tx *bbolt.Tx) (err error) {
+		value := tx.Bucket(blobsBucket).Get([]byte(digest))
+		if value == nil {
+			return fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+		}
+
+		// values are only valid for the life of the transaction
+		data = append([]byte{}, value...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	meta, err := engine.metadata(digest)
+	if err != nil {
+		return -1, err
+	}
+	return meta.Size, nil
+}
+
+// Created returns when the blob for digest was first stored.
+func (engine *Engine) Created(ctx context.Context, digest digest.Digest) (created time.Time, err error) {
+	meta, err := engine.metadata(digest)
+	if err != nil {
+		return created, err
+	}
+	return meta.Created, nil
+}
+
+// metadata returns the stored metadata for digest.
+func (engine *Engine) metadata(digest digest.Digest) (meta *metadata, err error) {
+	err = engine.db.View(func(tx *bbolt.Tx) (err error) {
+		value := tx.Bucket(metadataBucket).Get([]byte(digest))
+		if value == nil {
+			return fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+		}
+
+		meta = &metadata{}
+		return json.Unmarshal(value, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.  Only algorithms
+// with stored digests are listed.
+func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	present := map[string]bool{}
+	err = engine.db.View(func(tx *bbolt.Tx) (err error) {
+		cursor := tx.Bucket(blobsBucket).Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			present[digest.Digest(key).Algorithm().String()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	algorithms := make([]string, 0, len(present))
+	for algorithm := range present {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	offset := 0
+	count := 0
+	for _, algorithm := range algorithms {
+		if prefix == "" || strings.HasPrefix(algorithm, prefix) {
+			if offset >= from {
+				err = callback(ctx, digest.Algorithm(algorithm))
+				if err != nil {
+					return err
+				}
+				count++
+				if size != -1 && count >= size {
+					return nil
+				}
+			}
+			offset++
+		}
+	}
+	return nil
+}
+
+// Digests implements DigestLister.Digests.  When algorithm is set,
+// the cursor seeks directly to the first matching key.  The page is
+// collected before callback is called, so callback may use the
+// engine.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	var digests []digest.Digest
+	err = engine.db.View(func(tx *bbolt.Tx) (err error) {
+		cursor := tx.Bucket(blobsBucket).Cursor()
+
+		var seek []byte
+		if algorithm != "" {
+			seek = []byte(algorithm.String() + ":" + prefix)
+		}
+
+		offset := 0
+		var key []byte
+		if seek == nil {
+			key, _ = cursor.First()
+		} else {
+			key, _ = cursor.Seek(seek)
+		}
+		for ; key != nil; key, _ = cursor.Next() {
+			if seek != nil && !bytes.HasPrefix(key, seek) {
+				break
+			}
+
+			dig := digest.Digest(key)
+			if prefix != "" && !strings.HasPrefix(dig.Encoded(), prefix) {
+				continue
+			}
+
+			if offset >= from {
+				digests = append(digests, dig)
+				if size != -1 && len(digests) >= size {
+					break
+				}
+			}
+			offset++
+
+			err = ctx.Err()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, dig := range digests {
+		err = callback(ctx, dig)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put implements Writer.Put.  The content is read into memory before
+// it is stored.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	if algorithm.String() == "" {
+		algorithm = engine.Algorithm
+	}
+	if !algorithm.Available() {
+		return "", digest.ErrDigestUnsupported
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	dig = algorithm.FromBytes(data)
+	meta, err := json.Marshal(&metadata{
+		Size:    int64(len(data)),
+		Created: time.Now().UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = engine.db.Update(func(tx *bbolt.Tx) (err error) {
+		metadataTable := tx.Bucket(metadataBucket)
+		if metadataTable.Get([]byte(dig)) != nil {
+			return nil
+		}
+
+		err = tx.Bucket(blobsBucket).Put([]byte(dig), data)
+		if err != nil {
+			return err
+		}
+
+		return metadataTable.Put([]byte(dig), meta)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return dig, nil
+}
+
+// Delete implements Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	return engine.db.Update(func(tx *bbolt.Tx) (err error) {
+		for _, name := range [][]byte{blobsBucket, metadataBucket} {
+			err = tx.Bucket(name).Delete([]byte(digest))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close implements Closer.Close.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	return engine.db.Close()
+}
+
+func init() {
+	read.Register("oci-cas-bolt-v1", read.ReadWrite, New)
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-bolt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+	path := filepath.Join(temp, "cas.db")
+
+	engine, err := NewEngine(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"), dig)
+
+	created, err := engine.(*Engine).Created(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// idempotent Puts keep the original metadata
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recreated, err := engine.(*Engine).Created(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, created.Equal(recreated))
+
+	// the store persists across reopening
+	err = engine.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err = NewEngine(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	reader, err := engine.Get(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello, World!", string(data))
+
+	size, err := engine.(*Engine).Stat(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(13), size)
+
+	err = engine.Delete(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Get(ctx, dig)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+	}
+
+	_, err = engine.(*Engine).Stat(ctx, dig)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestDigests(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-bolt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(ctx, filepath.Join(temp, "cas.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	var sha256Digests, sha512Digests []string
+	for i := 0; i < 10; i++ {
+		content := fmt.Sprintf("blob %d", i)
+		for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+			dig, err := engine.Put(ctx, algorithm, strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if algorithm == digest.SHA256 {
+				sha256Digests = append(sha256Digests, dig.String())
+			} else {
+				sha512Digests = append(sha512Digests, dig.String())
+			}
+		}
+	}
+	sort.Strings(sha256Digests)
+	sort.Strings(sha512Digests)
+	all := append(append([]string{}, sha256Digests...), sha512Digests...)
+
+	prefix := digest.Digest(sha256Digests[0]).Encoded()[:1]
+	var prefixed []string
+	for _, dig := range sha256Digests {
+		if strings.HasPrefix(digest.Digest(dig).Encoded(), prefix) {
+			prefixed = append(prefixed, dig)
+		}
+	}
+
+	for _, testcase := range []struct {
+		name      string
+		algorithm digest.Algorithm
+		prefix    string
+		size      int
+		from      int
+		expected  []string
+	}{
+		{
+			name:     "all",
+			size:     -1,
+			expected: all,
+		},
+		{
+			name:     "page across algorithms",
+			size:     4,
+			from:     8,
+			expected: all[8:12],
+		},
+		{
+			name:      "one algorithm",
+			algorithm: digest.SHA512,
+			size:      3,
+			from:      2,
+			expected:  sha512Digests[2:5],
+		},
+		{
+			name:      "prefix",
+			algorithm: digest.SHA256,
+			prefix:    prefix,
+			size:      -1,
+			expected:  prefixed,
+		},
+		{
+			name:     "past the end",
+			size:     5,
+			from:     20,
+			expected: nil,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var digests []string
+			err := engine.Digests(ctx, testcase.algorithm, testcase.prefix, testcase.size, testcase.from, func(ctx context.Context, digest digest.Digest) (err error) {
+				digests = append(digests, digest.String())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, digests)
+		})
+	}
+
+	var algorithms []digest.Algorithm
+	err = engine.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+		algorithms = append(algorithms, algorithm)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []digest.Algorithm{digest.SHA256, digest.SHA512}, algorithms)
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// RetryBudget bounds the total number of retries made by all of the
+// engines sharing a context, e.g. while falling back across several
+// engines for the same blob.  Engines which retry should call Spend
+// (see SpendRetry) before each retry.  Bound the total time with a
+// context deadline.
+type RetryBudget struct {
+	mutex     sync.Mutex
+	remaining int
+}
+
+// retryBudgetKey is the context key for RetryBudget values.
+type retryBudgetKey struct{}
+
+// NewRetryBudget creates a RetryBudget allowing retries retries.
+func NewRetryBudget(retries int) (budget *RetryBudget) {
+	return &RetryBudget{remaining: retries}
+}
+
+// Spend consumes a retry from the budget, returning false if the
+// budget is exhausted.
+func (budget *RetryBudget) Spend() (ok bool) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	if budget.remaining <= 0 {
+		return false
+	}
+	budget.remaining--
+	return true
+}
+
+// Remaining returns the number of retries left in the budget.
+func (budget *RetryBudget) Remaining() (retries int) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	return budget.remaining
+}
+
+// WithRetryBudget returns a copy of ctx carrying budget.
+func WithRetryBudget(ctx context.Context, budget *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// SpendRetry spends a retry from the budget carried by ctx (see
+// WithRetryBudget), returning false if the budget is exhausted.
+// Retries are unbounded if ctx carries no budget.
+func SpendRetry(ctx context.Context) (ok bool) {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	if budget == nil {
+		return true
+	}
+	return budget.Spend()
+}
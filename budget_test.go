@@ -0,0 +1,60 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRetryBudget(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no budget", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.True(t, SpendRetry(ctx))
+		}
+	})
+
+	t.Run("shared budget", func(t *testing.T) {
+		budget := NewRetryBudget(5)
+		ctx := WithRetryBudget(ctx, budget)
+
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		spent := 0
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 3; j++ {
+					if SpendRetry(ctx) {
+						mutex.Lock()
+						spent++
+						mutex.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 5, spent)
+		assert.Equal(t, 0, budget.Remaining())
+		assert.False(t, SpendRetry(ctx))
+	})
+}
@@ -0,0 +1,473 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cassandra implements a CAS engine backed by Cassandra or
+// ScyllaDB.  Blobs are split into chunks stored in separate rows, so
+// they may exceed the database's cell-size limits, and are streamed
+// in both directions.
+package cassandra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+// DefaultChunkSize is the default ChunkSize, well under the 1 MiB
+// cell size recommended for Cassandra.
+const DefaultChunkSize = 512 * 1024
+
+// schema creates the engine's tables.  Blob content is written to
+// chunks under a fresh upload ID before its digest is known, and
+// blobs maps each digest to its upload once the content is
+// complete.  The digests table is an index clustered by digest
+// within each algorithm's partition, so Digests can page through it
+// in order.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS blobs (digest text PRIMARY KEY, size bigint, upload text)`,
+	`CREATE TABLE IF NOT EXISTS chunks (upload text, idx int, data blob, PRIMARY KEY (upload, idx))`,
+	`CREATE TABLE IF NOT EXISTS digests (algorithm text, digest text, PRIMARY KEY (algorithm, digest))`,
+}
+
+// Engine is a CAS engine which stores blobs in Cassandra.
+type Engine struct {
+	session *gocql.Session
+
+	// Algorithm selects the Algorithm used for Put.
+	Algorithm digest.Algorithm
+
+	// ChunkSize is the size in bytes of the chunks which Put splits
+	// blobs into.  NewEngine sets it to DefaultChunkSize.
+	ChunkSize int
+}
+
+// NewEngine creates a new CAS-engine instance using session, creating
+// the engine's tables in the session's keyspace if they do not
+// already exist.  The engine takes ownership of session, and Close
+// closes it.
+func NewEngine(ctx context.Context, session *gocql.Session) (engine casengine.DigestListerEngine, err error) {
+	for _, statement := range schema {
+		err = session.Query(statement).WithContext(ctx).Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Engine{
+		session:   session,
+		Algorithm: digest.SHA256,
+		ChunkSize: DefaultChunkSize,
+	}, nil
+}
+
+// New creates a new CAS-engine instance from a configuration object,
+// for the protocol registry.  The baseURI is ignored.  The config must
+// be a map[string]string or a map[string]interface{} with string
+// values.  The required 'hosts' property is a comma-separated list of
+// cluster hosts, and the required 'keyspace' property names an
+// existing keyspace.  The optional 'chunkSize' property sets
+// ChunkSize.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	configMap, ok := config.(map[string]string)
+	if !ok {
+		configMap2, ok := config.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cassandra config is not a map[string]string: %v", config)
+		}
+		configMap = make(map[string]string)
+		for key, value := range configMap2 {
+			configMap[key], ok = value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cassandra config %q is not a string: %v", key, value)
+			}
+		}
+	}
+
+	for _, property := range []string{"hosts", "keyspace"} {
+		if configMap[property] == "" {
+			return nil, fmt.Errorf("cassandra config missing required %q property: %v", property, configMap)
+		}
+	}
+
+	chunkSize := DefaultChunkSize
+	chunkSizeString, ok := configMap["chunkSize"]
+	if ok {
+		chunkSize, err = strconv.Atoi(chunkSizeString)
+		if err != nil || chunkSize <= 0 {
+			return nil, fmt.Errorf("cassandra config 'chunkSize' %q is not a positive integer", chunkSizeString)
+		}
+	}
+
+	cluster := gocql.NewCluster(strings.Split(configMap["hosts"], ",")...)
+	cluster.Keyspace = configMap["keyspace"]
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+
+	eng, err := NewEngine(ctx, session)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	eng.(*Engine).ChunkSize = chunkSize
+	return eng, nil
+}
+
+// upload returns the upload ID and size of the blob for digest.
+func (engine *Engine) upload(ctx context.Context, digest digest.Digest) (upload string, size int64, err error) {
+	err = engine.session.Query(
+		`SELECT upload, size FROM blobs WHERE digest = ?`, digest.String(),
+	).WithContext(ctx).Scan(&upload, &size)
+	if err == gocql.ErrNotFound {
+		return "", -1, fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+	}
+	return upload, size, err
+}
+
+// Get implements Reader.Get.  Chunks are fetched as the returned
+// reader is read.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	upload, _, err := engine.upload(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := engine.session.Query(
+		`SELECT data FROM chunks WHERE upload = ? ORDER BY idx`, upload,
+	).WithContext(ctx).PageSize(2).Iter()
+	return &chunkReader{iter: iter}, nil
+}
+
+// scanner is the subset of *gocql.Iter used to read query results, so
+// row handling can be tested without a cluster.
+type scanner interface {
+	Scan(dest ...interface{}) bool
+	Close() error
+}
+
+// chunkReader streams chunk rows from iter.
+type chunkReader struct {
+	iter    scanner
+	current []byte
+}
+
+// Read implements io.Reader.Read.
+func (reader *chunkReader) Read(p []byte) (n int, err error) {
+	for len(reader.current) == 0 {
+		var data []byte
+		if !reader.iter.Scan(&data) {
+			err = reader.iter.Close()
+			if err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		reader.current = data
+	}
+
+	n = copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.Close.
+func (reader *chunkReader) Close() (err error) {
+	return reader.iter.Close()
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	_, size, err = engine.upload(ctx, digest)
+	return size, err
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.  Only algorithms
+// with stored digests are listed.
+func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	algorithms, err := engine.algorithms(ctx)
+	if err != nil {
+		return err
+	}
+
+	page := &pager{size: size, from: from}
+	for _, algorithm := range algorithms {
+		if prefix == "" || strings.HasPrefix(algorithm, prefix) {
+			full, err := page.visit(func() error {
+				return callback(ctx, digest.Algorithm(algorithm))
+			})
+			if err != nil || full {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pager applies the size and from arguments of Algorithms and Digests
+// to the matching entries it visits.
+type pager struct {
+	size   int
+	from   int
+	offset int
+	count  int
+}
+
+// visit calls callback for the next matching entry if that entry is
+// within the requested page.  It returns true once the page is full.
+func (page *pager) visit(callback func() error) (full bool, err error) {
+	if page.offset >= page.from {
+		err = callback()
+		if err != nil {
+			return false, err
+		}
+		page.count++
+		if page.size != -1 && page.count >= page.size {
+			return true, nil
+		}
+	}
+	page.offset++
+	return false, nil
+}
+
+// algorithms returns the sorted algorithms in the digests index.
+// Partitions are listed in token order, so they are sorted here.
+func (engine *Engine) algorithms(ctx context.Context) (algorithms []string, err error) {
+	iter := engine.session.Query(`SELECT DISTINCT algorithm FROM digests`).WithContext(ctx).Iter()
+	var algorithm string
+	for iter.Scan(&algorithm) {
+		algorithms = append(algorithms, algorithm)
+	}
+	err = iter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(algorithms)
+	return algorithms, nil
+}
+
+// Digests implements DigestLister.Digests.  Each algorithm's digests
+// are read in order from the digests index, with prefix applied as a
+// clustering range so non-matching digests are not transferred.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	algorithms := []string{algorithm.String()}
+	if algorithm == "" {
+		algorithms, err = engine.algorithms(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	page := &pager{size: size, from: from}
+	for _, algorithm := range algorithms {
+		start := algorithm + ":" + prefix
+		iter := engine.session.Query(
+			`SELECT digest FROM digests WHERE algorithm = ? AND digest >= ?`, algorithm, start,
+		).WithContext(ctx).Iter()
+
+		full, err := scanDigests(ctx, iter, start, page, callback)
+		if err != nil || full {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanDigests passes the digests from iter which start with start to
+// callback, through page.  iter must return digests in order starting
+// from start, so the scan stops at the first digest without that
+// prefix.  It returns true once the page is full.
+func scanDigests(ctx context.Context, iter scanner, start string, page *pager, callback casengine.DigestCallback) (full bool, err error) {
+	var digestString string
+	for iter.Scan(&digestString) {
+		if !strings.HasPrefix(digestString, start) {
+			break
+		}
+		full, err = page.visit(func() error {
+			return callback(ctx, digest.Digest(digestString))
+		})
+		if err != nil {
+			iter.Close()
+			return false, err
+		}
+		if full {
+			return true, iter.Close()
+		}
+	}
+	return false, iter.Close()
+}
+
+// Put implements Writer.Put.  The content is streamed into chunk rows
+// as it is read, so blobs are never held in memory.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	if algorithm.String() == "" {
+		algorithm = engine.Algorithm
+	}
+	if !algorithm.Available() {
+		return "", digest.ErrDigestUnsupported
+	}
+
+	chunkSize := engine.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	upload := gocql.TimeUUID().String()
+	defer func() {
+		if err != nil {
+			engine.deleteChunks(ctx, upload)
+		}
+	}()
+
+	digester := algorithm.Digester()
+	size, err := writeChunks(io.TeeReader(reader, digester.Hash()), chunkSize, func(index int, data []byte) (err error) {
+		return engine.session.Query(
+			`INSERT INTO chunks (upload, idx, data) VALUES (?, ?, ?)`, upload, index, data,
+		).WithContext(ctx).Exec()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	dig = digester.Digest()
+
+	// keep the first upload if the blob is already stored
+	previous := map[string]interface{}{}
+	applied, err := engine.session.Query(
+		`INSERT INTO blobs (digest, size, upload) VALUES (?, ?, ?) IF NOT EXISTS`, dig.String(), size, upload,
+	).WithContext(ctx).MapScanCAS(previous)
+	if err != nil {
+		return "", err
+	}
+	if !applied {
+		engine.deleteChunks(ctx, upload)
+	}
+
+	// The blobs insert is a lightweight transaction, which cannot
+	// share a logged batch with the digests insert, so roll it back by
+	// hand if the index cannot be updated.
+	err = engine.session.Query(
+		`INSERT INTO digests (algorithm, digest) VALUES (?, ?)`, dig.Algorithm().String(), dig.String(),
+	).WithContext(ctx).Exec()
+	if err != nil {
+		if applied {
+			engine.deleteBlob(ctx, dig, upload)
+		}
+		return "", err
+	}
+
+	return dig, nil
+}
+
+// writeChunks splits the content from reader into chunks of chunkSize
+// bytes, passing each to write with its index, and returns the total
+// size.  Only the final chunk may be short, and empty content writes
+// no chunks.  The data slice is reused once write returns.
+func writeChunks(reader io.Reader, chunkSize int, write func(index int, data []byte) (err error)) (size int64, err error) {
+	chunk := make([]byte, chunkSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(reader, chunk)
+		if n > 0 {
+			err2 := write(index, chunk[:n])
+			if err2 != nil {
+				return size, err2
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+	}
+}
+
+// Delete implements Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	upload, _, err := engine.upload(ctx, digest)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	err = engine.session.Query(
+		`DELETE FROM digests WHERE algorithm = ? AND digest = ?`, digest.Algorithm().String(), digest.String(),
+	).WithContext(ctx).Exec()
+	if err != nil {
+		return err
+	}
+
+	err = engine.session.Query(`DELETE FROM blobs WHERE digest = ?`, digest.String()).WithContext(ctx).Exec()
+	if err != nil {
+		return err
+	}
+
+	return engine.session.Query(`DELETE FROM chunks WHERE upload = ?`, upload).WithContext(ctx).Exec()
+}
+
+// deleteChunks removes the chunks for an abandoned upload, logging
+// any error.
+func (engine *Engine) deleteChunks(ctx context.Context, upload string) {
+	err := engine.session.Query(`DELETE FROM chunks WHERE upload = ?`, upload).WithContext(ctx).Exec()
+	if err != nil {
+		logrus.Warnf("failed to remove chunks for abandoned upload %s: %s", upload, err)
+	}
+}
+
+// deleteBlob removes the blobs row which upload added for digest,
+// logging any error.  Put calls it when it fails after adding the row,
+// and its own deferred cleanup removes the upload's chunks.
+func (engine *Engine) deleteBlob(ctx context.Context, digest digest.Digest, upload string) {
+	err := engine.session.Query(
+		`DELETE FROM blobs WHERE digest = ? IF upload = ?`, digest.String(), upload,
+	).WithContext(ctx).Exec()
+	if err != nil {
+		logrus.Warnf("failed to remove the blobs row for abandoned upload %s of %s: %s", upload, digest, err)
+	}
+}
+
+// Close implements Closer.Close.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	engine.session.Close()
+	return nil
+}
+
+func init() {
+	read.Register("oci-cas-cassandra-v1", read.ReadWrite, New)
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cassandra
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// newTestEngine connects to the cluster listed in
+// CASENGINE_CASSANDRA_HOSTS (for example, a local ccm cluster or a
+// container), skipping the test when it is unset.
+func newTestEngine(t *testing.T, ctx context.Context) *Engine {
+	hosts := os.Getenv("CASENGINE_CASSANDRA_HOSTS")
+	if hosts == "" {
+		t.Skip("CASENGINE_CASSANDRA_HOSTS is not set")
+	}
+
+	cluster := gocql.NewCluster(strings.Split(hosts, ",")...)
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = session.Query(`CREATE KEYSPACE IF NOT EXISTS casengine_test WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}`).Exec()
+	session.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster.Keyspace = "casengine_test"
+	session, err = cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"blobs", "chunks", "digests"} {
+		err = session.Query(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table)).Exec()
+		if err != nil {
+			session.Close()
+			t.Fatal(err)
+		}
+	}
+
+	engine, err := NewEngine(ctx, session)
+	if err != nil {
+		session.Close()
+		t.Fatal(err)
+	}
+	return engine.(*Engine)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	engine := newTestEngine(t, ctx)
+	defer engine.Close(ctx)
+
+	// several chunks, with a short final chunk
+	engine.ChunkSize = 4
+	content := "Hello, World!"
+
+	dig, err := engine.Put(ctx, "", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"), dig)
+
+	// idempotent Puts keep a single copy
+	_, err = engine.Put(ctx, "", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := engine.Stat(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(len(content)), size)
+
+	reader, err := engine.Get(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, content, string(data))
+
+	err = engine.Delete(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Get(ctx, dig)
+	assert.True(t, errors.Is(err, os.ErrNotExist), fmt.Sprint(err))
+
+	err = engine.Delete(ctx, dig)
+	assert.Nil(t, err)
+}
+
+func TestDigests(t *testing.T) {
+	ctx := context.Background()
+	engine := newTestEngine(t, ctx)
+	defer engine.Close(ctx)
+
+	expected := []digest.Digest{}
+	for _, content := range []string{"a", "b", "c", "d"} {
+		dig, err := engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, dig)
+	}
+	_, err := engine.Put(ctx, digest.SHA512, strings.NewReader("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name      string
+		algorithm digest.Algorithm
+		size      int
+		from      int
+		expected  int
+	}{
+		{name: "all sha256", algorithm: digest.SHA256, size: -1, expected: 4},
+		{name: "all algorithms", size: -1, expected: 5},
+		{name: "page", algorithm: digest.SHA256, size: 2, from: 1, expected: 2},
+		{name: "past the end", algorithm: digest.SHA256, size: -1, from: 10, expected: 0},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			digests := []digest.Digest{}
+			err := engine.Digests(ctx, testcase.algorithm, "", testcase.size, testcase.from, func(ctx context.Context, digest digest.Digest) (err error) {
+				digests = append(digests, digest)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, len(digests))
+		})
+	}
+
+	t.Run("prefix", func(t *testing.T) {
+		prefix := expected[0].Encoded()[:2]
+		digests := []digest.Digest{}
+		err := engine.Digests(ctx, digest.SHA256, prefix, -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+			digests = append(digests, digest)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, digests, expected[0])
+		for _, dig := range digests {
+			assert.True(t, strings.HasPrefix(dig.Encoded(), prefix))
+		}
+	})
+}
+
+// sliceScanner implements scanner over rows held in memory.
+type sliceScanner struct {
+	rows   []interface{}
+	err    error
+	closed bool
+}
+
+// Scan implements scanner.Scan.
+func (iter *sliceScanner) Scan(dest ...interface{}) bool {
+	if len(iter.rows) == 0 {
+		return false
+	}
+	switch value := iter.rows[0].(type) {
+	case []byte:
+		*dest[0].(*[]byte) = value
+	case string:
+		*dest[0].(*string) = value
+	}
+	iter.rows = iter.rows[1:]
+	return true
+}
+
+// Close implements scanner.Close.
+func (iter *sliceScanner) Close() error {
+	iter.closed = true
+	return iter.err
+}
+
+func TestWriteChunks(t *testing.T) {
+	for _, testcase := range []struct {
+		name      string
+		content   string
+		chunkSize int
+		expected  []string
+	}{
+		{name: "empty", content: "", chunkSize: 4, expected: []string{}},
+		{name: "short final chunk", content: "Hello, World!", chunkSize: 4, expected: []string{"Hell", "o, W", "orld", "!"}},
+		{name: "exact chunks", content: "Hello, World", chunkSize: 4, expected: []string{"Hell", "o, W", "orld"}},
+		{name: "single chunk", content: "Hello", chunkSize: 512, expected: []string{"Hello"}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			chunks := []string{}
+			size, err := writeChunks(strings.NewReader(testcase.content), testcase.chunkSize, func(index int, data []byte) (err error) {
+				assert.Equal(t, len(chunks), index)
+				chunks = append(chunks, string(data))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(len(testcase.content)), size)
+			assert.Equal(t, testcase.expected, chunks)
+		})
+	}
+
+	t.Run("write error", func(t *testing.T) {
+		failure := errors.New("write failed")
+		calls := 0
+		_, err := writeChunks(strings.NewReader("Hello, World!"), 4, func(index int, data []byte) (err error) {
+			calls++
+			return failure
+		})
+		assert.Equal(t, failure, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestChunkReader(t *testing.T) {
+	iter := &sliceScanner{rows: []interface{}{[]byte("Hell"), []byte{}, []byte("o, W"), []byte("orld!")}}
+	data, err := ioutil.ReadAll(&chunkReader{iter: iter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello, World!", string(data))
+	assert.True(t, iter.closed)
+
+	failure := errors.New("read failed")
+	_, err = ioutil.ReadAll(&chunkReader{iter: &sliceScanner{rows: []interface{}{[]byte("Hell")}, err: failure}})
+	assert.Equal(t, failure, err)
+}
+
+func TestScanDigests(t *testing.T) {
+	ctx := context.Background()
+	rows := []interface{}{"sha256:aa", "sha256:ab", "sha256:ac", "sha256:ba"}
+
+	for _, testcase := range []struct {
+		name     string
+		start    string
+		size     int
+		from     int
+		expected []digest.Digest
+		full     bool
+	}{
+		{name: "all", start: "sha256:", size: -1, expected: []digest.Digest{"sha256:aa", "sha256:ab", "sha256:ac", "sha256:ba"}},
+		{name: "prefix", start: "sha256:a", size: -1, expected: []digest.Digest{"sha256:aa", "sha256:ab", "sha256:ac"}},
+		{name: "page", start: "sha256:", size: 2, from: 1, expected: []digest.Digest{"sha256:ab", "sha256:ac"}, full: true},
+		{name: "past the end", start: "sha256:", size: -1, from: 10, expected: []digest.Digest{}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			iter := &sliceScanner{rows: rows}
+			digests := []digest.Digest{}
+			full, err := scanDigests(ctx, iter, testcase.start, &pager{size: testcase.size, from: testcase.from}, func(ctx context.Context, digest digest.Digest) (err error) {
+				digests = append(digests, digest)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.full, full)
+			assert.Equal(t, testcase.expected, digests)
+			assert.True(t, iter.closed)
+		})
+	}
+
+	t.Run("pages span algorithms", func(t *testing.T) {
+		page := &pager{size: 3, from: 1}
+		digests := []digest.Digest{}
+		callback := func(ctx context.Context, digest digest.Digest) (err error) {
+			digests = append(digests, digest)
+			return nil
+		}
+		full, err := scanDigests(ctx, &sliceScanner{rows: []interface{}{"sha256:aa", "sha256:ab"}}, "sha256:", page, callback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, full)
+		full, err = scanDigests(ctx, &sliceScanner{rows: []interface{}{"sha512:aa", "sha512:ab", "sha512:ac"}}, "sha512:", page, callback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, full)
+		assert.Equal(t, []digest.Digest{"sha256:ab", "sha512:aa", "sha512:ab"}, digests)
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		failure := errors.New("callback failed")
+		iter := &sliceScanner{rows: rows}
+		_, err := scanDigests(ctx, iter, "sha256:", &pager{size: -1}, func(ctx context.Context, digest digest.Digest) (err error) {
+			return failure
+		})
+		assert.Equal(t, failure, err)
+		assert.True(t, iter.closed)
+	})
+}
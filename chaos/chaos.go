@@ -0,0 +1,224 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chaos implements a CAS engine decorator which injects
+// failures into a wrapped engine, so consumers can exercise their
+// fallback and retry logic.  Failures are drawn from a seeded source,
+// so a given seed and sequence of calls always injects the same
+// failures.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// ErrInjected is wrapped by all errors injected by Engine.
+var ErrInjected = errors.New("injected failure")
+
+// Engine wraps a casengine.Engine, injecting failures into Get, Put,
+// and Delete.  Other methods are passed through to the wrapped
+// engine.  The rates are probabilities between 0 and 1, and each is
+// drawn independently for each call.
+type Engine struct {
+	casengine.Engine
+
+	// mutex guards random.
+	mutex  sync.Mutex
+	random *rand.Rand
+
+	// ErrorRate is the probability that a call fails with an error
+	// wrapping ErrInjected without reaching the wrapped engine.
+	ErrorRate float64
+
+	// DelayRate is the probability that a call sleeps for Delay
+	// before proceeding.  If the context is done first, the call
+	// returns the context's error.
+	DelayRate float64
+
+	// Delay is the duration of injected delays.
+	Delay time.Duration
+
+	// TruncateRate is the probability that content is cut short: the
+	// reader returned by Get, or the reader consumed by Put, returns
+	// an error wrapping ErrInjected and io.ErrUnexpectedEOF instead
+	// of reaching the end of the blob.  Gets are truncated at a
+	// random offset within the blob when the wrapped engine
+	// implements casengine.Stater, and at the start otherwise.  Puts
+	// are truncated after a random fraction of their first read.
+	TruncateRate float64
+}
+
+// NewEngine creates a new chaos engine wrapping engine, with failures
+// drawn from a source seeded with seed.  All rates start at zero, so
+// no failures are injected until they are set.
+func NewEngine(engine casengine.Engine, seed int64) (chaos *Engine) {
+	return &Engine{
+		Engine: engine,
+		random: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// outcome is the set of failures drawn for a single call.
+type outcome struct {
+	delay    bool
+	err      bool
+	truncate bool
+
+	// fraction is where in the content a truncation happens, between
+	// 0 and 1.
+	fraction float64
+}
+
+// roll draws the failures for a call.  The same number of values is
+// drawn for every call, so each call's outcome depends only on the
+// seed and the number of earlier calls.
+func (engine *Engine) roll() (result outcome) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	result.delay = engine.random.Float64() < engine.DelayRate
+	result.err = engine.random.Float64() < engine.ErrorRate
+	result.truncate = engine.random.Float64() < engine.TruncateRate
+	result.fraction = engine.random.Float64()
+	return result
+}
+
+// inject applies the delay and error from result for the named
+// method.
+func (engine *Engine) inject(ctx context.Context, result outcome, method string) (err error) {
+	if result.delay {
+		timer := time.NewTimer(engine.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if result.err {
+		return fmt.Errorf("%s: %w", method, ErrInjected)
+	}
+
+	return nil
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	result := engine.roll()
+	err = engine.inject(ctx, result, "Get")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = engine.Engine.Get(ctx, digest)
+	if err != nil || !result.truncate {
+		return reader, err
+	}
+
+	var offset int64
+	stater, ok := engine.Engine.(casengine.Stater)
+	if ok {
+		size, err := stater.Stat(ctx, digest)
+		if err == nil && size > 0 {
+			offset = int64(result.fraction * float64(size))
+		}
+	}
+
+	return &truncatedReader{reader: reader, remaining: offset}, nil
+}
+
+// Put implements casengine.Writer.Put.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	result := engine.roll()
+	err = engine.inject(ctx, result, "Put")
+	if err != nil {
+		return "", err
+	}
+
+	if result.truncate {
+		reader = &truncatedReader{reader: reader, fraction: result.fraction, firstRead: true}
+	}
+
+	return engine.Engine.Put(ctx, algorithm, reader)
+}
+
+// Delete implements casengine.Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	result := engine.roll()
+	err = engine.inject(ctx, result, "Delete")
+	if err != nil {
+		return err
+	}
+
+	return engine.Engine.Delete(ctx, digest)
+}
+
+// truncatedReader returns an injected error after remaining bytes,
+// or, with firstRead, after fraction of its first read.
+type truncatedReader struct {
+	reader    io.Reader
+	remaining int64
+	fraction  float64
+	firstRead bool
+}
+
+// Read implements io.Reader.Read.
+func (reader *truncatedReader) Read(p []byte) (n int, err error) {
+	if reader.firstRead {
+		reader.firstRead = false
+		n, err = reader.reader.Read(p)
+		if n == 0 && err == nil {
+			return 0, nil
+		}
+		return int(reader.fraction * float64(n)), reader.truncated()
+	}
+
+	if reader.remaining <= 0 {
+		return 0, reader.truncated()
+	}
+	if int64(len(p)) > reader.remaining {
+		p = p[:reader.remaining]
+	}
+	n, err = reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if err == io.EOF {
+		return n, reader.truncated()
+	}
+	return n, err
+}
+
+// truncated returns the injected truncation error.
+func (reader *truncatedReader) truncated() (err error) {
+	return fmt.Errorf("%w: %w", ErrInjected, io.ErrUnexpectedEOF)
+}
+
+// Close implements io.Closer.Close, closing the wrapped reader if it
+// is an io.Closer.
+func (reader *truncatedReader) Close() (err error) {
+	closer, ok := reader.reader.(io.Closer)
+	if ok {
+		return closer.Close()
+	}
+	return nil
+}
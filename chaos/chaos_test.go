@@ -0,0 +1,173 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func newTestEngine(t *testing.T, ctx context.Context, seed int64) (engine *Engine, dig digest.Digest) {
+	base, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dig, err = base.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewEngine(base, seed), dig
+}
+
+// failures returns the pattern of failed Gets for count calls.
+func failures(ctx context.Context, engine *Engine, dig digest.Digest, count int) (pattern []bool) {
+	pattern = make([]bool, count)
+	for i := range pattern {
+		reader, err := engine.Get(ctx, dig)
+		if err == nil {
+			reader.Close()
+		}
+		pattern[i] = err != nil
+	}
+	return pattern
+}
+
+func TestErrorRate(t *testing.T) {
+	ctx := context.Background()
+	calls := 10000
+
+	for _, rate := range []float64{0, 0.1, 0.5, 1} {
+		t.Run(fmt.Sprint(rate), func(t *testing.T) {
+			engine, dig := newTestEngine(t, ctx, 1)
+			defer engine.Close(ctx)
+			engine.ErrorRate = rate
+
+			failed := 0
+			for _, failure := range failures(ctx, engine, dig, calls) {
+				if failure {
+					failed++
+				}
+			}
+			assert.InDelta(t, rate, float64(failed)/float64(calls), 0.02)
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		engine, dig := newTestEngine(t, ctx, 1)
+		defer engine.Close(ctx)
+		engine.ErrorRate = 1
+
+		_, err := engine.Get(ctx, dig)
+		assert.True(t, errors.Is(err, ErrInjected), fmt.Sprint(err))
+
+		_, err = engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+		assert.True(t, errors.Is(err, ErrInjected), fmt.Sprint(err))
+
+		err = engine.Delete(ctx, dig)
+		assert.True(t, errors.Is(err, ErrInjected), fmt.Sprint(err))
+
+		engine.ErrorRate = 0
+		_, err = engine.Get(ctx, dig)
+		assert.Nil(t, err)
+	})
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+
+	pattern := func(seed int64) []bool {
+		engine, dig := newTestEngine(t, ctx, seed)
+		defer engine.Close(ctx)
+		engine.ErrorRate = 0.5
+		return failures(ctx, engine, dig, 100)
+	}
+
+	assert.Equal(t, pattern(1), pattern(1))
+	assert.NotEqual(t, pattern(1), pattern(2))
+}
+
+func TestTruncate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("get", func(t *testing.T) {
+		engine, dig := newTestEngine(t, ctx, 1)
+		defer engine.Close(ctx)
+		engine.TruncateRate = 1
+
+		for i := 0; i < 10; i++ {
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadAll(reader)
+			reader.Close()
+			assert.True(t, errors.Is(err, ErrInjected), fmt.Sprint(err))
+			assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), fmt.Sprint(err))
+			assert.True(t, strings.HasPrefix("Hello, World!", string(data)))
+			assert.True(t, len(data) < len("Hello, World!"))
+		}
+	})
+
+	t.Run("put", func(t *testing.T) {
+		engine, _ := newTestEngine(t, ctx, 1)
+		defer engine.Close(ctx)
+		engine.TruncateRate = 1
+
+		_, err := engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+		assert.True(t, errors.Is(err, ErrInjected), fmt.Sprint(err))
+
+		reader, err := engine.Engine.Get(ctx, digest.FromString("Goodbye, World!"))
+		if err == nil {
+			reader.Close()
+		}
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDelay(t *testing.T) {
+	ctx := context.Background()
+	engine, dig := newTestEngine(t, ctx, 1)
+	defer engine.Close(ctx)
+	engine.DelayRate = 1
+	engine.Delay = 20 * time.Millisecond
+
+	start := time.Now()
+	err := engine.Delete(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, time.Since(start) >= engine.Delay)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = engine.Get(ctx, dig)
+	assert.Equal(t, context.Canceled, err)
+}
+
+var _ casengine.Engine = &Engine{}
@@ -0,0 +1,79 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/wking/casengine"
+)
+
+var copyCommand = cli.Command{
+	Name:      "copy",
+	Usage:     "Copy blobs from the engines configured on stdin into a directory-based store.",
+	ArgsUsage: "DIGEST...",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Value: ".",
+			Usage: "Root directory of the destination store.",
+		},
+		cli.StringFlag{
+			Name:  "uri",
+			Value: "blobs/{algorithm}/{encoded:2}/{encoded}",
+			Usage: "URI Template for blob paths, relative to --path.",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		ctx := commandContext(c)
+
+		dst, err := newWritableEngine(ctx, c)
+		if err != nil {
+			return err
+		}
+		defer dst.Close(ctx)
+
+		engines, err := loadEngines(ctx, c)
+		if err != nil {
+			return err
+		}
+		defer closeEngines(ctx, engines)
+
+	DigestLoop:
+		for _, digestString := range c.Args() {
+			digest, err := digest.Parse(digestString)
+			if err != nil {
+				logrus.Errorf("failed to parse digest %s", digestString)
+				return err
+			}
+
+			for _, eng := range engines {
+				err = casengine.Copy(ctx, dst, eng, digest)
+				if err != nil {
+					logrus.Warnf("failed to copy %s: %s", digest, err)
+					continue
+				}
+				fmt.Println(digest)
+				continue DigestLoop
+			}
+			return fmt.Errorf("failed to copy %s", digest)
+		}
+
+		return nil
+	},
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,6 +27,8 @@ import (
 	"github.com/urfave/cli"
 	"github.com/wking/casengine"
 	"github.com/wking/casengine/read"
+	"github.com/wking/casengine/read/blob"
+	"github.com/wking/casengine/read/template"
 	"github.com/xiekeyang/oci-discovery/tools/engine"
 	"golang.org/x/net/context"
 )
@@ -34,36 +37,36 @@ var get = cli.Command{
 	Name:      "get",
 	Usage:     "Retrieve blobs from the store and write them to stdout.",
 	ArgsUsage: "DIGEST...",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "Number of times each template engine retries a failed request.",
+		},
+		cli.IntFlag{
+			Name:  "retry-budget",
+			Value: -1,
+			Usage: "Total number of retries allowed across all engines, to bound the latency of falling back between engines.  The default (-1) is unbounded.",
+		},
+		cli.StringFlag{
+			Name:  "blob",
+			Usage: "Also serve the content of this file (or stdin, for '-') under its own digest, e.g. to verify ad-hoc content.  With '-', no engine configuration is read from stdin.",
+		},
+		cli.BoolFlag{
+			Name:  "recover",
+			Usage: "Convert engine panics into errors, so a misbehaving engine falls back to the next engine instead of crashing.",
+		},
+	},
 	Action: func(c *cli.Context) (err error) {
-		ctx := context.Background()
+		ctx := commandContext(c)
+		if c.Int("retry-budget") >= 0 {
+			ctx = casengine.WithRetryBudget(ctx, casengine.NewRetryBudget(c.Int("retry-budget")))
+		}
 
-		var configReferences []engine.Reference
-		err = json.NewDecoder(os.Stdin).Decode(&configReferences)
+		engines, err := loadEngines(ctx, c)
 		if err != nil {
-			logrus.Error("failed to read engine config from stdin")
 			return err
 		}
-
-		engines := []casengine.ReadCloser{}
-		for _, configReference := range configReferences {
-			constructor, ok := read.Constructors[configReference.Config.Protocol]
-			if !ok {
-				logrus.Debugf("unsupported CAS-engine protocol %q (%v)", configReference.Config.Protocol, read.Constructors)
-				continue
-			}
-
-			eng, err := constructor(ctx, configReference.URI, configReference.Config.Data)
-			if err != nil {
-				logrus.Warnf("failed to initialize %s CAS engine with %v: %s", configReference.Config.Protocol, configReference.Config.Data, err)
-				continue
-			}
-			defer eng.Close(ctx)
-
-			engines = append(engines, eng)
-		}
-		if len(engines) == 0 {
-			return fmt.Errorf("failed to load any engine configurations")
-		}
+		defer closeEngines(ctx, engines)
 
 	DigestLoop:
 		for _, digestString := range c.Args() {
@@ -100,3 +103,95 @@ var get = cli.Command{
 		return nil
 	},
 }
+
+// loadEngines creates read-only engines from the engine
+// configurations on stdin, skipping configurations which cannot be
+// loaded.  If none can be loaded, the returned error joins the
+// reasons for each configuration.  It applies the command's
+// --retries, --recover, and --blob flags, if set.  Callers should
+// close the returned engines with closeEngines.
+func loadEngines(ctx context.Context, c *cli.Context) (engines []casengine.ReadCloser, err error) {
+	engines = []casengine.ReadCloser{}
+	if c.String("blob") != "" {
+		algorithm, _ := c.App.Metadata["algorithm"].(digest.Algorithm)
+		blobEngine, err := loadBlob(ctx, algorithm, c.String("blob"))
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("serving %s from %s", blobEngine.Digest(), c.String("blob"))
+		engines = append(engines, blobEngine)
+		if c.String("blob") == "-" {
+			return engines, nil
+		}
+	}
+
+	var configReferences []engine.Reference
+	err = json.NewDecoder(os.Stdin).Decode(&configReferences)
+	if err != nil {
+		closeEngines(ctx, engines)
+		logrus.Error("failed to read engine config from stdin")
+		return nil, err
+	}
+
+	var errs []error
+	for i, configReference := range configReferences {
+		constructor, err := read.Lookup(configReference.Config.Protocol, read.ReadOnly)
+		if err != nil {
+			logrus.Debug(err)
+			errs = append(errs, fmt.Errorf("engine %d: %w", i, err))
+			continue
+		}
+
+		eng, err := constructor.New(ctx, configReference.URI, configReference.Config.Data)
+		if err != nil {
+			logrus.Warnf("failed to initialize %s CAS engine with %v: %s", configReference.Config.Protocol, configReference.Config.Data, err)
+			errs = append(errs, fmt.Errorf("engine %d (%s): %w", i, configReference.Config.Protocol, err))
+			continue
+		}
+
+		templateEngine, ok := eng.(*template.Engine)
+		if ok {
+			templateEngine.Retries = c.Int("retries")
+		}
+
+		if c.Bool("recover") {
+			eng = &casengine.RecoveringReadCloser{ReadCloser: eng}
+		}
+
+		engines = append(engines, eng)
+	}
+	if len(engines) == 0 {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("failed to load any engine configurations")
+		}
+		return nil, fmt.Errorf("failed to load any engine configurations:\n%w", errors.Join(errs...))
+	}
+
+	return engines, nil
+}
+
+// closeEngines closes engines, logging any errors.
+func closeEngines(ctx context.Context, engines []casengine.ReadCloser) {
+	for _, eng := range engines {
+		err := eng.Close(ctx)
+		if err != nil {
+			logrus.Warnf("failed to close %v: %s", eng, err)
+		}
+	}
+}
+
+// loadBlob creates a pseudo-engine serving the content of path, or of
+// stdin if path is "-", under its algorithm digest.
+func loadBlob(ctx context.Context, algorithm digest.Algorithm, path string) (blobEngine *blob.Engine, err error) {
+	if path == "-" {
+		return blob.New(ctx, algorithm, os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return blob.New(ctx, algorithm, file)
+}
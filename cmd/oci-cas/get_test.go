@@ -0,0 +1,123 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestGetBlob(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-oci-cas-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	input := filepath.Join(temp, "input")
+	err = ioutil.WriteFile(input, []byte("Hello, World!"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		digest   digest.Digest
+		expected string
+		err      string
+	}{
+		{
+			name:     "own digest",
+			digest:   digest.FromString("Hello, World!"),
+			expected: "Hello, World!",
+		},
+		{
+			name:   "other digest",
+			digest: digest.FromString("Goodbye, World!"),
+			err:    "failed to retrieve " + string(digest.FromString("Goodbye, World!")),
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			stdin, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+
+			stdout, err := os.Create(filepath.Join(temp, "output"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdout.Close()
+
+			originalStdin, originalStdout := os.Stdin, os.Stdout
+			os.Stdin, os.Stdout = stdin, stdout
+			err = newApp(context.Background()).Run([]string{"oci-cas", "get", "--blob", "-", string(testcase.digest)})
+			os.Stdin, os.Stdout = originalStdin, originalStdout
+
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := ioutil.ReadFile(stdout.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, string(output))
+		})
+	}
+}
+
+func TestGetEngineErrors(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-oci-cas-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	config := filepath.Join(temp, "config.json")
+	err = ioutil.WriteFile(config, []byte(`[
+  {"config": {"protocol": "oci-cas-template-v1"}},
+  {"config": {"protocol": "oci-cas-template-v1", "uri": 1}}
+]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, err := os.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	originalStdin := os.Stdin
+	os.Stdin = stdin
+	err = newApp(context.Background()).Run([]string{"oci-cas", "get", string(digest.FromString("Hello, World!"))})
+	os.Stdin = originalStdin
+
+	assert.EqualError(t, err, `failed to load any engine configurations:
+engine 0 (oci-cas-template-v1): CAS-template config missing required 'uri' property: map[]
+engine 1 (oci-cas-template-v1): CAS-template config 'uri' is not a string: 1`)
+}
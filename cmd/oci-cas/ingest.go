@@ -0,0 +1,60 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var ingest = cli.Command{
+	Name:      "ingest",
+	Usage:     "Fetch URLs, store them in a directory-based store, and print their digests.",
+	ArgsUsage: "URL...",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Value: ".",
+			Usage: "Root directory of the store.",
+		},
+		cli.StringFlag{
+			Name:  "uri",
+			Value: "blobs/{algorithm}/{encoded:2}/{encoded}",
+			Usage: "URI Template for blob paths, relative to --path.",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		ctx := commandContext(c)
+
+		engine, err := newWritableEngine(ctx, c)
+		if err != nil {
+			return err
+		}
+		defer engine.Close(ctx)
+
+		for _, uri := range c.Args() {
+			digest, err := engine.PutURL(ctx, nil, uri)
+			if err != nil {
+				logrus.Errorf("failed to ingest %s", uri)
+				return err
+			}
+			fmt.Println(digest)
+		}
+
+		return nil
+	},
+}
@@ -21,20 +21,42 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/omeid/go-tarfs"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/wking/casengine/dir"
+	_ "github.com/wking/casengine/memory"
 	_ "github.com/wking/casengine/read/template"
+	_ "github.com/wking/casengine/tiered"
+	"golang.org/x/net/context"
 	"golang.org/x/tools/godoc/vfs/httpfs"
 	"golang.org/x/tools/godoc/vfs/zipfs"
 )
 
 func main() {
-	app := cli.NewApp()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newApp(ctx).Run(os.Args)
+	stop()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// newApp creates the command-line application.  Commands use ctx
+// (see commandContext), so cancelling it aborts in-flight operations.
+func newApp(ctx context.Context) (app *cli.App) {
+	app = cli.NewApp()
 	app.Name = "oci-cas"
 	app.Version = "0.1.0"
 	app.Usage = "Open Container Intiative Content Addressable Storage"
+	app.Metadata = map[string]interface{}{
+		"context": ctx,
+	}
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -42,6 +64,10 @@ func main() {
 			Value: "error",
 			Usage: "Log level (panic, fatal, error, warn, info, or debug)",
 		},
+		cli.StringFlag{
+			Name:  "algorithm",
+			Usage: "Default digest algorithm (e.g. sha256 or sha512) for writable engines, like the ones used by put and ingest.  Engines use their own default if this is not set.",
+		},
 		cli.StringFlag{
 			Name:  "file",
 			Usage: "Effective root for file URIs.  To allow access to your entire filesystem, use '--file /'.  More restricted values are recommended to avoid accessing sensitive information.  The default is to disable file URIs entirely; you must set this flag (or another --*-file flag) to enable them.",
@@ -57,7 +83,11 @@ func main() {
 	}
 
 	app.Commands = []cli.Command{
+		copyCommand,
 		get,
+		ingest,
+		put,
+		relayout,
 	}
 
 	app.Before = func(c *cli.Context) (err error) {
@@ -69,6 +99,14 @@ func main() {
 		logrus.SetLevel(logLevel)
 		logrus.Debugf("set log level to %s", logLevelString)
 
+		if c.GlobalIsSet("algorithm") {
+			algorithm := digest.Algorithm(c.GlobalString("algorithm"))
+			if !algorithm.Available() {
+				return fmt.Errorf("algorithm %q is not available", algorithm)
+			}
+			c.App.Metadata["algorithm"] = algorithm
+		}
+
 		if c.GlobalIsSet("file") {
 			if c.GlobalIsSet("tar-file") {
 				return fmt.Errorf("setting both --file and --tar-file is invalid")
@@ -119,8 +157,37 @@ func main() {
 		return nil
 	}
 
-	err := app.Run(os.Args)
+	return app
+}
+
+// commandContext returns the context passed to newApp.
+func commandContext(c *cli.Context) (ctx context.Context) {
+	ctx, ok := c.App.Metadata["context"].(context.Context)
+	if !ok {
+		return context.Background()
+	}
+	return ctx
+}
+
+// newWritableEngine creates a directory-based engine from the
+// command's --path and --uri flags, using the --algorithm set for the
+// session, if any.
+func newWritableEngine(ctx context.Context, c *cli.Context) (engine *dir.Engine, err error) {
+	path, err := filepath.Abs(c.String("path"))
 	if err != nil {
-		logrus.Fatal(err)
+		return nil, err
 	}
+
+	base, err := dir.NewEngine(ctx, path, fmt.Sprintf("file://%s/%s", path, c.String("uri")))
+	if err != nil {
+		return nil, err
+	}
+	engine = base.(*dir.Engine)
+
+	algorithm, ok := c.App.Metadata["algorithm"].(digest.Algorithm)
+	if ok {
+		engine.Algorithm = algorithm
+	}
+
+	return engine, nil
 }
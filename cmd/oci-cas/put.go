@@ -0,0 +1,79 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var put = cli.Command{
+	Name:      "put",
+	Usage:     "Store files (or stdin, if no files are given) in a directory-based store, and print their digests.",
+	ArgsUsage: "[FILE...]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Value: ".",
+			Usage: "Root directory of the store.",
+		},
+		cli.StringFlag{
+			Name:  "uri",
+			Value: "blobs/{algorithm}/{encoded:2}/{encoded}",
+			Usage: "URI Template for blob paths, relative to --path.",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		ctx := commandContext(c)
+
+		engine, err := newWritableEngine(ctx, c)
+		if err != nil {
+			return err
+		}
+		defer engine.Close(ctx)
+
+		if c.NArg() == 0 {
+			digest, err := engine.Put(ctx, "", os.Stdin)
+			if err != nil {
+				return err
+			}
+			fmt.Println(digest)
+			return nil
+		}
+
+		for _, path := range c.Args() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			digest, err := engine.Put(ctx, "", file)
+			err2 := file.Close()
+			if err2 != nil {
+				logrus.Warnf("failed to close %s", path)
+			}
+			if err != nil {
+				logrus.Errorf("failed to put %s", path)
+				return err
+			}
+			fmt.Println(digest)
+		}
+
+		return nil
+	},
+}
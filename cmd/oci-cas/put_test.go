@@ -0,0 +1,66 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPutAlgorithm(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-oci-cas-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	input := filepath.Join(temp, "input")
+	err = ioutil.WriteFile(input, []byte("Hello, World!"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := filepath.Join(temp, "store")
+	err = os.Mkdir(store, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = newApp(context.Background()).Run([]string{"oci-cas", "--algorithm", "sha512", "put", "--path", store, input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := digest.SHA512.FromString("Hello, World!").Encoded()
+	content, err := ioutil.ReadFile(filepath.Join(store, "blobs", "sha512", encoded[:2], encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello, World!", string(content))
+
+	_, err = os.Stat(filepath.Join(store, "blobs", "sha256"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPutUnavailableAlgorithm(t *testing.T) {
+	err := newApp(context.Background()).Run([]string{"oci-cas", "--algorithm", "md5", "put"})
+	assert.EqualError(t, err, `algorithm "md5" is not available`)
+}
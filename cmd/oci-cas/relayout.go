@@ -0,0 +1,91 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+	"github.com/wking/casengine/dir"
+	"golang.org/x/net/context"
+)
+
+var relayout = cli.Command{
+	Name:      "relayout",
+	Usage:     "Move the blobs in a directory-based store from one URI Template layout to another.",
+	ArgsUsage: "PATH",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "Current URI Template for blob paths, relative to PATH.",
+		},
+		cli.StringFlag{
+			Name:  "to",
+			Usage: "New URI Template for blob paths, relative to PATH.",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the moves which would be made without changing the store.",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		ctx := commandContext(c)
+
+		if c.NArg() != 1 {
+			return fmt.Errorf("relayout requires a single PATH argument")
+		}
+		if c.String("from") == "" || c.String("to") == "" {
+			return fmt.Errorf("relayout requires both --from and --to")
+		}
+
+		path, err := filepath.Abs(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		getDigestRegexp, err := dir.TemplateRegexp(fmt.Sprintf("%s/%s", path, c.String("from")))
+		if err != nil {
+			return err
+		}
+
+		from, err := dir.NewDigestListerEngine(
+			ctx,
+			path,
+			fmt.Sprintf("file://%s/%s", path, c.String("from")),
+			(&dir.RegexpGetDigest{Regexp: getDigestRegexp}).GetDigest,
+		)
+		if err != nil {
+			return err
+		}
+		defer from.Close(ctx)
+
+		to, err := dir.NewEngine(ctx, path, fmt.Sprintf("file://%s/%s", path, c.String("to")))
+		if err != nil {
+			return err
+		}
+		defer to.Close(ctx)
+
+		dryRun := c.Bool("dry-run")
+		return to.(*dir.Engine).Relayout(ctx, from.(*dir.DigestListerEngine), dryRun, func(ctx context.Context, move *dir.RelayoutMove) (err error) {
+			if dryRun {
+				fmt.Printf("would move %s from %s to %s\n", move.Digest, move.From, move.To)
+			} else {
+				fmt.Printf("moved %s from %s to %s\n", move.Digest, move.From, move.To)
+			}
+			return nil
+		})
+	},
+}
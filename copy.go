@@ -0,0 +1,66 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Copy copies the blob for digest from src to dst.  The content is
+// streamed from src.Get into dst.Put and verified against digest as
+// it goes, so memory use does not depend on the size of the blob.
+// Returns an error wrapping ErrDigestMismatch if the content does not
+// match digest, in which case the Put fails when it reads the end of
+// the content, before the Writer commits it.  Returns the error from
+// digest.Validate, without calling src.Get, if digest is invalid or
+// its algorithm is not available.
+func Copy(ctx context.Context, dst Writer, src Reader, digest digest.Digest) (err error) {
+	err = digest.Validate()
+	if err != nil {
+		return err
+	}
+
+	rawReader, err := src.Get(ctx, digest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rawReader.Close()
+		if err2 != nil {
+			logrus.Warnf("failed to close the reader for %s: %s", digest, err2)
+		}
+	}()
+
+	verifiedReader := &verifiedReadCloser{
+		reader:   rawReader,
+		digest:   digest,
+		verifier: digest.Verifier(),
+	}
+
+	dig, err := dst.Put(ctx, digest.Algorithm(), verifiedReader)
+	if err != nil {
+		return err
+	}
+
+	if dig != digest || !verifiedReader.verifier.Verified() {
+		return fmt.Errorf("%w: %s (stored as %s)", ErrDigestMismatch, digest, dig)
+	}
+
+	return nil
+}
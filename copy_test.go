@@ -0,0 +1,118 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// zeroReader is a Reader serving size zero bytes for any digest,
+// without buffering them.
+type zeroReader struct {
+	size int64
+}
+
+func (reader zeroReader) Read(p []byte) (n int, err error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func (reader zeroReader) Get(ctx context.Context, digest digest.Digest) (rawReader io.ReadCloser, err error) {
+	return ioutil.NopCloser(io.LimitReader(reader, reader.size)), nil
+}
+
+// hashingWriter is a Writer which hashes and discards blobs.
+type hashingWriter struct {
+	size int64
+}
+
+func (writer *hashingWriter) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	digester := algorithm.Digester()
+	writer.size, err = io.Copy(digester.Hash(), reader)
+	if err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	hello := digest.FromString("Hello, World!")
+
+	t.Run("good", func(t *testing.T) {
+		writer := &hashingWriter{}
+		err := Copy(ctx, writer, mapReader{hello: []byte("Hello, World!")}, hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, int64(13), writer.size)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		err := Copy(ctx, &hashingWriter{}, mapReader{hello: []byte("Goodbye, World!")}, hello)
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Fatalf("expected an error matching %s, got %v", ErrDigestMismatch, err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		err := Copy(ctx, &hashingWriter{}, mapReader{}, hello)
+		assert.Error(t, err)
+	})
+
+	t.Run("unavailable algorithm", func(t *testing.T) {
+		unavailable := digest.Digest("md5:65a8e27d8879283831b664bd8b7f0ad4")
+		err := Copy(ctx, &hashingWriter{}, mapReader{unavailable: []byte("Hello, World!")}, unavailable)
+		assert.Equal(t, digest.ErrDigestUnsupported, err)
+	})
+}
+
+func TestCopyLargeBlob(t *testing.T) {
+	ctx := context.Background()
+	size := int64(128 << 20)
+	src := zeroReader{size: size}
+
+	digester := digest.SHA256.Digester()
+	_, err := io.Copy(digester.Hash(), io.LimitReader(src, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dig := digester.Digest()
+
+	writer := &hashingWriter{}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err = Copy(ctx, writer, src, dig)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, size, writer.size)
+
+	allocated := after.TotalAlloc - before.TotalAlloc
+	if allocated > 4<<20 {
+		t.Fatalf("copying a %d-byte blob allocated %d bytes", size, allocated)
+	}
+}
@@ -15,6 +15,15 @@
 // Package counter defines a byte-counting writer.  One use case is measuring the size of content being streamed into CAS.
 package counter
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCapExceeded is returned by CappedCounter.Write when the written
+// content exceeds the counter's cap.
+var ErrCapExceeded = errors.New("byte cap exceeded")
+
 type Counter struct {
 	count uint64
 }
@@ -30,3 +39,26 @@ func (c *Counter) Write(p []byte) (n int, err error) {
 func (c *Counter) Count() (n uint64) {
 	return c.count
 }
+
+// CappedCounter is a Counter which fails writes once the content
+// written exceeds Cap bytes.  Use it with io.TeeReader or io.Copy to
+// abort oversized streams.
+type CappedCounter struct {
+	Counter
+
+	// Cap is the maximum number of bytes which may be written.
+	Cap uint64
+}
+
+// Write implements io.Writer for CappedCounter.  If p would take the
+// count past Cap, only the bytes up to Cap are counted, and the
+// returned error wraps ErrCapExceeded.
+func (c *CappedCounter) Write(p []byte) (n int, err error) {
+	remaining := c.Cap - c.count
+	if uint64(len(p)) <= remaining {
+		return c.Counter.Write(p)
+	}
+
+	n, _ = c.Counter.Write(p[:remaining])
+	return n, fmt.Errorf("%w: %d bytes written with a cap of %d", ErrCapExceeded, c.count-uint64(n)+uint64(len(p)), c.Cap)
+}
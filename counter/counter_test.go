@@ -16,6 +16,7 @@
 package counter
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
 	"strings"
@@ -36,3 +37,42 @@ func Test(t *testing.T) {
 	assert.Equal(t, bodyIn, string(bodyOut))
 	assert.Equal(t, uint64(len(bodyIn)), counter.Count())
 }
+
+func TestCappedCounter(t *testing.T) {
+	counter := &CappedCounter{Cap: 5}
+	reader := io.TeeReader(strings.NewReader("Hello, World!"), counter)
+	bodyOut, err := ioutil.ReadAll(reader)
+	if !errors.Is(err, ErrCapExceeded) {
+		t.Fatalf("expected an error matching %s, got %v", ErrCapExceeded, err)
+	}
+	assert.EqualError(t, err, "byte cap exceeded: 13 bytes written with a cap of 5")
+	assert.Equal(t, "Hello", string(bodyOut))
+	assert.Equal(t, uint64(5), counter.Count())
+
+	t.Run("partial write", func(t *testing.T) {
+		counter := &CappedCounter{Cap: 5}
+		n, err := counter.Write([]byte("Hi, "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 4, n)
+
+		n, err = counter.Write([]byte("World!"))
+		assert.True(t, errors.Is(err, ErrCapExceeded))
+		assert.Equal(t, 1, n)
+		assert.Equal(t, uint64(5), counter.Count())
+
+		n, err = counter.Write([]byte("!"))
+		assert.True(t, errors.Is(err, ErrCapExceeded))
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("exactly at cap", func(t *testing.T) {
+		counter := &CappedCounter{Cap: 5}
+		n, err := counter.Write([]byte("Hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 5, n)
+	})
+}
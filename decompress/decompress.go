@@ -0,0 +1,165 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package decompress implements a CAS reader decorator which
+// transparently decompresses blobs retrieved from a wrapped engine.
+package decompress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// Policy selects how Reader.Get decompresses blobs.
+type Policy int
+
+const (
+	// None returns blobs unchanged.
+	None Policy = iota
+
+	// Gzip decompresses every blob as gzip, failing for blobs which
+	// are not gzipped.
+	Gzip
+
+	// Detect decompresses blobs which start with the gzip magic
+	// number and returns other blobs unchanged.
+	Detect
+)
+
+// gzipMagic is the leading bytes of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Reader wraps a casengine.Reader, decompressing the blobs it
+// returns according to Policy.  The digest passed to Get always
+// identifies the stored (possibly compressed) bytes, which is what
+// the wrapped engine addresses.  Decompressed content will not match
+// that digest, so callers which need a digest for it must recompute
+// one as they read.
+type Reader struct {
+	// Reader is the wrapped engine.
+	Reader casengine.Reader
+
+	// Policy selects which blobs are decompressed.
+	Policy Policy
+
+	// Verify, if set, checks the stored bytes against the requested
+	// digest as they are read, so content addressing is preserved
+	// even when the caller only sees decompressed content.  A
+	// mismatch is returned as an error wrapping
+	// casengine.ErrDigestMismatch when the stored bytes are
+	// exhausted.  Get returns the error from digest.Validate for
+	// digests which cannot be verified, e.g. because their algorithm
+	// is not available.
+	Verify bool
+}
+
+// Get implements casengine.Reader.Get.
+func (reader *Reader) Get(ctx context.Context, digest digest.Digest) (readCloser io.ReadCloser, err error) {
+	if reader.Verify {
+		err = digest.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rawReader, err := reader.Reader.Get(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored io.Reader = rawReader
+	if reader.Verify {
+		stored = &verifiedReader{
+			reader:   rawReader,
+			digest:   digest,
+			verifier: digest.Verifier(),
+		}
+	}
+
+	switch reader.Policy {
+	case None:
+		return &multiCloser{reader: stored, closers: []io.Closer{rawReader}}, nil
+	case Gzip:
+		gzipReader, err := gzip.NewReader(stored)
+		if err != nil {
+			rawReader.Close()
+			return nil, fmt.Errorf("decompress %s: %w", digest, err)
+		}
+		return &multiCloser{reader: gzipReader, closers: []io.Closer{gzipReader, rawReader}}, nil
+	case Detect:
+		bufferedReader := bufio.NewReader(stored)
+		magic, err := bufferedReader.Peek(len(gzipMagic))
+		if err != nil && err != io.EOF {
+			rawReader.Close()
+			return nil, err
+		}
+		if len(magic) < len(gzipMagic) || magic[0] != gzipMagic[0] || magic[1] != gzipMagic[1] {
+			return &multiCloser{reader: bufferedReader, closers: []io.Closer{rawReader}}, nil
+		}
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			rawReader.Close()
+			return nil, fmt.Errorf("decompress %s: %w", digest, err)
+		}
+		return &multiCloser{reader: gzipReader, closers: []io.Closer{gzipReader, rawReader}}, nil
+	default:
+		rawReader.Close()
+		return nil, fmt.Errorf("unrecognized decompression policy %d", reader.Policy)
+	}
+}
+
+// multiCloser reads from reader and closes each of closers in turn.
+type multiCloser struct {
+	reader  io.Reader
+	closers []io.Closer
+}
+
+// Read implements io.Reader.Read.
+func (reader *multiCloser) Read(p []byte) (n int, err error) {
+	return reader.reader.Read(p)
+}
+
+// Close implements io.Closer.Close.  The first error is returned.
+func (reader *multiCloser) Close() (err error) {
+	for _, closer := range reader.closers {
+		err2 := closer.Close()
+		if err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// verifiedReader checks its content against digest as it is read.
+type verifiedReader struct {
+	reader   io.Reader
+	digest   digest.Digest
+	verifier digest.Verifier
+}
+
+// Read implements io.Reader.Read.
+func (reader *verifiedReader) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+	reader.verifier.Write(p[:n])
+	if err == io.EOF && !reader.verifier.Verified() {
+		return n, fmt.Errorf("%w: %s", casengine.ErrDigestMismatch, reader.digest)
+	}
+	return n, err
+}
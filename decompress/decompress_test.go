@@ -0,0 +1,158 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+// mismatchReader serves content regardless of the requested digest.
+type mismatchReader struct {
+	content []byte
+}
+
+func (reader *mismatchReader) Get(ctx context.Context, digest digest.Digest) (readCloser io.ReadCloser, err error) {
+	return ioutil.NopCloser(bytes.NewReader(reader.content)), nil
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	content := "Hello, World!"
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	plainDigest, err := engine.Put(ctx, "", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := gzipped(t, content)
+	gzipDigest, err := engine.Put(ctx, "", bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		policy   Policy
+		digest   digest.Digest
+		expected string
+		err      bool
+	}{
+		{name: "none plain", policy: None, digest: plainDigest, expected: content},
+		{name: "none gzip", policy: None, digest: gzipDigest, expected: string(compressed)},
+		{name: "gzip gzip", policy: Gzip, digest: gzipDigest, expected: content},
+		{name: "gzip plain", policy: Gzip, digest: plainDigest, err: true},
+		{name: "detect plain", policy: Detect, digest: plainDigest, expected: content},
+		{name: "detect gzip", policy: Detect, digest: gzipDigest, expected: content},
+	} {
+		for _, verify := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s verify %t", testcase.name, verify), func(t *testing.T) {
+				reader := &Reader{
+					Reader: engine,
+					Policy: testcase.policy,
+					Verify: verify,
+				}
+				readCloser, err := reader.Get(ctx, testcase.digest)
+				if testcase.err {
+					assert.NotNil(t, err)
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer readCloser.Close()
+
+				data, err := ioutil.ReadAll(readCloser)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, testcase.expected, string(data))
+			})
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	content := "Hello, World!"
+	wrongDigest := digest.FromString("goodbye")
+
+	for _, testcase := range []struct {
+		name    string
+		policy  Policy
+		content []byte
+	}{
+		{name: "none", policy: None, content: []byte(content)},
+		{name: "detect plain", policy: Detect, content: []byte(content)},
+		{name: "detect gzip", policy: Detect, content: gzipped(t, content)},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			reader := &Reader{
+				Reader: &mismatchReader{content: testcase.content},
+				Policy: testcase.policy,
+				Verify: true,
+			}
+			readCloser, err := reader.Get(ctx, wrongDigest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer readCloser.Close()
+
+			_, err = ioutil.ReadAll(readCloser)
+			assert.True(t, errors.Is(err, casengine.ErrDigestMismatch), fmt.Sprint(err))
+		})
+	}
+
+	t.Run("unavailable algorithm", func(t *testing.T) {
+		reader := &Reader{
+			Reader: &mismatchReader{content: []byte(content)},
+			Verify: true,
+		}
+		_, err := reader.Get(ctx, "md5:65a8e27d8879283831b664bd8b7f0ad4")
+		assert.Equal(t, digest.ErrDigestUnsupported, err)
+	})
+}
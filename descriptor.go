@@ -0,0 +1,84 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/net/context"
+)
+
+// ErrSizeMismatch is returned when retrieved content does not match
+// the expected size.
+var ErrSizeMismatch = errors.New("content does not match size")
+
+// GetDescriptor retrieves the blob referenced by descriptor from
+// reader.  If descriptor.Size is not zero, the size is checked:
+// GetDescriptor returns an error wrapping ErrSizeMismatch if reader
+// implements Stater and reports a different size, and reads return
+// such an error if the content turns out to be longer or shorter.
+// Like Get, GetDescriptor does not verify the content against
+// descriptor.Digest.
+// https://github.com/opencontainers/image-spec/blob/v1.0.1/descriptor.md
+func GetDescriptor(ctx context.Context, reader Reader, descriptor ocispec.Descriptor) (rawReader io.ReadCloser, err error) {
+	if descriptor.Size == 0 {
+		return reader.Get(ctx, descriptor.Digest)
+	}
+
+	stater, ok := reader.(Stater)
+	if ok {
+		size, err := stater.Stat(ctx, descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if size != descriptor.Size {
+			return nil, fmt.Errorf("%w: %s has %d bytes, but the descriptor has %d", ErrSizeMismatch, descriptor.Digest, size, descriptor.Size)
+		}
+	}
+
+	rawReader, err = reader.Get(ctx, descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sizeCheckingReadCloser{
+		ReadCloser: rawReader,
+		descriptor: descriptor,
+	}, nil
+}
+
+// sizeCheckingReadCloser returns an error wrapping ErrSizeMismatch if
+// its content does not have the descriptor's size.
+type sizeCheckingReadCloser struct {
+	io.ReadCloser
+	descriptor ocispec.Descriptor
+	count      int64
+}
+
+// Read implements io.Reader.Read.
+func (reader *sizeCheckingReadCloser) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	reader.count += int64(n)
+	if reader.count > reader.descriptor.Size {
+		return n, fmt.Errorf("%w: %s has more than the descriptor's %d bytes", ErrSizeMismatch, reader.descriptor.Digest, reader.descriptor.Size)
+	}
+	if err == io.EOF && reader.count < reader.descriptor.Size {
+		return n, fmt.Errorf("%w: %s has %d bytes, but the descriptor has %d", ErrSizeMismatch, reader.descriptor.Digest, reader.count, reader.descriptor.Size)
+	}
+	return n, err
+}
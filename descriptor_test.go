@@ -0,0 +1,106 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// statMapReader is a mapReader which also implements Stater.
+type statMapReader struct {
+	mapReader
+}
+
+func (reader statMapReader) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	data, ok := reader.mapReader[digest]
+	if !ok {
+		return -1, errors.New("not found")
+	}
+	return int64(len(data)), nil
+}
+
+func TestGetDescriptor(t *testing.T) {
+	ctx := context.Background()
+	dig := digest.FromString("Hello, World!")
+	blobs := mapReader{dig: []byte("Hello, World!")}
+
+	for _, testcase := range []struct {
+		name     string
+		reader   Reader
+		size     int64
+		expected error
+	}{
+		{
+			name:   "matching size",
+			reader: blobs,
+			size:   13,
+		},
+		{
+			name:   "unset size",
+			reader: blobs,
+		},
+		{
+			name:     "short descriptor",
+			reader:   blobs,
+			size:     5,
+			expected: ErrSizeMismatch,
+		},
+		{
+			name:     "long descriptor",
+			reader:   blobs,
+			size:     20,
+			expected: ErrSizeMismatch,
+		},
+		{
+			name:     "long descriptor with Stater",
+			reader:   statMapReader{mapReader: blobs},
+			size:     20,
+			expected: ErrSizeMismatch,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			reader, err := GetDescriptor(ctx, testcase.reader, ocispec.Descriptor{
+				MediaType: "application/octet-stream",
+				Digest:    dig,
+				Size:      testcase.size,
+			})
+			if err == nil {
+				defer reader.Close()
+				var content []byte
+				content, err = ioutil.ReadAll(reader)
+				if err == nil {
+					assert.Equal(t, "Hello, World!", string(content))
+				}
+			}
+
+			if testcase.expected == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, testcase.expected) {
+				t.Fatalf("expected an error matching %s, got %v", testcase.expected, err)
+			}
+		})
+	}
+}
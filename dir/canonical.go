@@ -0,0 +1,51 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+)
+
+// canonicalDigest checks dig before it is mapped to a path.  With
+// StrictDigests, digests which do not validate (including digests
+// with unavailable algorithms) are rejected.  Otherwise digests are
+// case-folded by casengine.NormalizeDigest, and digests which it
+// rejects are returned unchanged.  With
+// CaseInsensitive, digests which still have uppercase characters are
+// rejected.
+func (engine *Engine) canonicalDigest(dig digest.Digest) (canonical digest.Digest, err error) {
+	if engine.StrictDigests {
+		err = dig.Validate()
+		if err != nil {
+			return "", fmt.Errorf("%w: %q: %s", ErrNonCanonicalDigest, dig, err)
+		}
+		canonical = dig
+	} else {
+		canonical, err = casengine.NormalizeDigest(dig, casengine.CaseFold)
+		if err != nil {
+			canonical = dig
+		}
+	}
+
+	if engine.CaseInsensitive && strings.ToLower(canonical.Encoded()) != canonical.Encoded() {
+		return "", fmt.Errorf("%w: %s", ErrCaseCollision, canonical)
+	}
+
+	return canonical, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestStrictDigests(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := digest.Digest(strings.ToUpper(dig.String()))
+
+	t.Run("lenient", func(t *testing.T) {
+		engine.(*Engine).StrictDigests = false
+
+		reader, err := engine.Get(ctx, upper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Hello, World!", string(content))
+
+		size, err := engine.(*Engine).Stat(ctx, upper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, int64(13), size)
+
+		path, err := engine.(*Engine).PathForDigest(upper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, path, dig.Encoded())
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		engine.(*Engine).StrictDigests = true
+
+		_, err := engine.Get(ctx, upper)
+		if !errors.Is(err, ErrNonCanonicalDigest) {
+			t.Fatalf("expected an error matching %s, got %v", ErrNonCanonicalDigest, err)
+		}
+
+		_, err = engine.(*Engine).Stat(ctx, upper)
+		if !errors.Is(err, ErrNonCanonicalDigest) {
+			t.Fatalf("expected an error matching %s, got %v", ErrNonCanonicalDigest, err)
+		}
+
+		err = engine.Delete(ctx, upper)
+		if !errors.Is(err, ErrNonCanonicalDigest) {
+			t.Fatalf("expected an error matching %s, got %v", ErrNonCanonicalDigest, err)
+		}
+
+		reader, err := engine.Get(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Close()
+
+		_, err = engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// foldCase returns the path which a case-insensitive filesystem
+// would treat as identical to path.
+func foldCase(path string) string {
+	return strings.ToLower(path)
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	// Digests with a case-sensitive encoding which differ only by
+	// case.
+	lower := digest.Digest("b64:abcdef")
+	mixed := digest.Digest("b64:aBcDeF")
+
+	lowerPath, err := engine.(*Engine).getPath(lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("case-sensitive", func(t *testing.T) {
+		engine.(*Engine).CaseInsensitive = false
+
+		mixedPath, err := engine.(*Engine).getPath(mixed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEqual(t, lowerPath, mixedPath)
+		assert.Equal(t, foldCase(lowerPath), foldCase(mixedPath))
+	})
+
+	t.Run("case-insensitive", func(t *testing.T) {
+		engine.(*Engine).CaseInsensitive = true
+
+		path, err := engine.(*Engine).getPath(lower)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, lowerPath, path)
+
+		_, err = engine.Get(ctx, mixed)
+		if !errors.Is(err, ErrCaseCollision) {
+			t.Fatalf("expected an error matching %s, got %v", ErrCaseCollision, err)
+		}
+
+		_, err = engine.(*Engine).Stat(ctx, mixed)
+		if !errors.Is(err, ErrCaseCollision) {
+			t.Fatalf("expected an error matching %s, got %v", ErrCaseCollision, err)
+		}
+
+		err = engine.Delete(ctx, mixed)
+		if !errors.Is(err, ErrCaseCollision) {
+			t.Fatalf("expected an error matching %s, got %v", ErrCaseCollision, err)
+		}
+
+		// Hex digests are lowercased, so they are unaffected.
+		dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := engine.Get(ctx, digest.Digest("sha256:"+strings.ToUpper(dig.Encoded())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Close()
+	})
+}
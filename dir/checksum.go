@@ -0,0 +1,144 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// checksumSuffix is appended to a blob's path to locate its CRC-32C
+// sidecar.
+const checksumSuffix = ".crc32c"
+
+// sidecarSuffixes lists the suffixes of files which the engine stores
+// alongside blobs.  Enumeration skips paths with these suffixes.
+var sidecarSuffixes = []string{
+	checksumSuffix,
+	gzipSuffix,
+	expirySuffix,
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is returned by QuickVerify when a blob's
+// content does not match its stored CRC-32C.
+var ErrChecksumMismatch = errors.New("CRC-32C mismatch")
+
+// QuickVerify checks a stored blob against the CRC-32C sidecar
+// written by Put when QuickChecksum was set.  CRC-32C is much cheaper
+// to compute than a cryptographic digest, but it is only a guard
+// against accidental corruption.  A nil return does *not* mean the
+// blob matches digest; use digest.Verifier for that.
+//
+// Returns an error wrapping os.ErrNotExist if the blob or its sidecar
+// is missing, and one wrapping ErrChecksumMismatch if the blob's
+// content does not match the sidecar.
+func (engine *Engine) QuickVerify(ctx context.Context, digest digest.Digest) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return err
+	}
+
+	sidecar, err := engine.FileSystem.OpenFile(path+checksumSuffix, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(sidecar)
+	sidecar.Close()
+	if err != nil {
+		return err
+	}
+
+	expected, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid CRC-32C sidecar for %s: %s", digest, err)
+	}
+
+	file, err := engine.FileSystem.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	checksum := crc32.New(castagnoli)
+	_, err = io.Copy(checksum, file)
+	if err != nil {
+		return err
+	}
+
+	if checksum.Sum32() != uint32(expected) {
+		return fmt.Errorf("%w for %s: expected %08x but got %08x", ErrChecksumMismatch, digest, expected, checksum.Sum32())
+	}
+
+	return nil
+}
+
+// putChecksum stores the CRC-32C sidecar for the blob at path.
+func (engine *Engine) putChecksum(path string, checksum uint32) (err error) {
+	file, err := engine.FileSystem.TempFile(engine.temp, "crc32c-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err2 := engine.FileSystem.Remove(file.Name())
+			if err2 != nil {
+				logrus.Error(err2)
+			}
+		}
+	}()
+
+	_, err = fmt.Fprintf(file, "%08x\n", checksum)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return engine.FileSystem.Rename(file.Name(), path+checksumSuffix)
+}
+
+// isSidecar returns true if path is a sidecar file rather than a
+// blob.
+func isSidecar(path string) bool {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestQuickVerify(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).QuickChecksum = true
+
+	digest, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(temp, "blobs", "sha256", "df", "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	t.Run("sidecar", func(t *testing.T) {
+		sidecar, err := ioutil.ReadFile(path + checksumSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "4d551068\n", string(sidecar))
+	})
+
+	t.Run("intact", func(t *testing.T) {
+		err := engine.(*Engine).QuickVerify(ctx, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		err := ioutil.WriteFile(path, []byte("Hello, world!"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = engine.(*Engine).QuickVerify(ctx, digest)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("expected %s, got %v", ErrChecksumMismatch, err)
+		}
+	})
+
+	t.Run("delete removes sidecar", func(t *testing.T) {
+		err := engine.Delete(ctx, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = os.Stat(path + checksumSuffix)
+		assert.True(t, os.IsNotExist(err))
+
+		err = engine.(*Engine).QuickVerify(ctx, digest)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
+
+// failingBlobRenameFileSystem is an OSFileSystem whose renames fail
+// with ENOSPC, except for renames of sidecar files.
+type failingBlobRenameFileSystem struct {
+	OSFileSystem
+}
+
+func (fileSystem failingBlobRenameFileSystem) Rename(oldpath string, newpath string) (err error) {
+	if isSidecar(newpath) {
+		return fileSystem.OSFileSystem.Rename(oldpath, newpath)
+	}
+	return &os.LinkError{
+		Op:  "rename",
+		Old: oldpath,
+		New: newpath,
+		Err: syscall.ENOSPC,
+	}
+}
+
+func TestQuickChecksumCleanup(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.(*Engine).QuickChecksum = true
+	engine.(*Engine).FileSystem = failingBlobRenameFileSystem{}
+
+	dig := digest.FromString("Hello, World!")
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected an error matching %s, got %v", syscall.ENOSPC, err)
+	}
+
+	_, err = os.Stat(filepath.Join(temp, "blobs", "sha256", dig.Encoded()+checksumSuffix))
+	assert.True(t, os.IsNotExist(err), fmt.Sprint(err))
+
+	err = engine.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.(*Engine).QuickVerify(ctx, dig)
+	assert.Equal(t, ErrClosed, err)
+}
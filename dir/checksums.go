@@ -0,0 +1,84 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// WriteChecksums writes a SHA256SUMS-style file (named for algorithm,
+// e.g. SHA256SUMS or SHA512SUMS) to the image layout's root, listing
+// each of the layout's algorithm blobs as "{encoded}  {path}", with
+// paths relative to the root.  Consumers can then verify a copied or
+// archived layout independently, e.g. with "sha256sum -c SHA256SUMS"
+// from the root.  The file is written to a temporary file and renamed
+// into place, so an existing checksums file is replaced atomically.
+// An empty algorithm selects digest.Canonical.
+func (engine *OCILayoutEngine) WriteChecksums(ctx context.Context, algorithm digest.Algorithm) (path string, err error) {
+	if algorithm == "" {
+		algorithm = digest.Canonical
+	}
+
+	file, err := engine.FileSystem.TempFile(engine.root, ".checksums-")
+	if err != nil {
+		return "", err
+	}
+	tempPath := file.Name()
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+		if err != nil {
+			engine.FileSystem.Remove(tempPath)
+		}
+	}()
+
+	err = engine.Digests(ctx, algorithm, "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		blobPath, err := engine.getPath(digest)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(engine.root, blobPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(file, "%s  %s\n", digest.Encoded(), filepath.ToSlash(relPath))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = file.Close()
+	file = nil
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.Join(engine.root, strings.ToUpper(algorithm.String())+"SUMS")
+	err = engine.FileSystem.Rename(tempPath, path)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewOCILayout(ctx, temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	expected := []string{}
+	for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+		dig, err := engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, dig.Encoded()+"  blobs/sha256/"+dig.Encoded())
+	}
+	sort.Strings(expected)
+
+	_, err = engine.Put(ctx, digest.SHA512, strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := engine.(*OCILayoutEngine).WriteChecksums(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(temp, "SHA256SUMS"), path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Equal(t, expected, lines)
+
+	for _, line := range lines {
+		fields := strings.SplitN(line, "  ", 2)
+		content, err := ioutil.ReadFile(filepath.Join(temp, filepath.FromSlash(fields[1])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, fields[0], digest.SHA256.FromBytes(content).Encoded())
+	}
+
+	// no temporary files are left behind
+	matches, err := filepath.Glob(filepath.Join(temp, ".checksums-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, matches)
+}
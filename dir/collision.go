@@ -0,0 +1,55 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrDigestCollision is returned by Put when CollisionCheck is set
+// and the stored blob for the computed digest differs from the new
+// content.  With a sound hash this should never happen; it usually
+// means the algorithm is broken or the stored blob is corrupt.
+var ErrDigestCollision = errors.New("digest collision")
+
+// checkCollision compares the freshly-written blob at newPath with
+// the blob already stored at path.
+func checkCollision(fs FileSystem, digest digest.Digest, newPath string, path string) (err error) {
+	newFile, err := fs.OpenFile(newPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	equal, err := equalReaders(newFile, file)
+	if err != nil {
+		return err
+	}
+	if !equal {
+		return fmt.Errorf("%w: new content for %s differs from %s", ErrDigestCollision, digest, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestCollisionCheck(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).CollisionCheck = true
+
+	t.Run("identical", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		// go-digest does not allow registering a deliberately broken
+		// algorithm, so store different content under the digest a
+		// broken algorithm would have computed.
+		path := filepath.Join(temp, "blobs", "sha256", "fb", "fb62f02acda7d74177a701a1ce006e6bacd90c7d4d7ab481692c1da47c81076b")
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte("Hello, World?!"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+		if !errors.Is(err, ErrDigestCollision) {
+			t.Fatalf("expected an error matching %s, got %v", ErrDigestCollision, err)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "Hello, World?!" {
+			t.Fatalf("stored blob was replaced: %q", content)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+// New creates a new CAS-engine instance from a configuration object.
+// The path argument is the same as for NewEngine.  The config must be
+// a map[string]string or a map[string]interface{} with string values.
+// The required 'uri' property is the URI Template passed to
+// NewEngine.  The optional 'algorithm' property sets the default
+// Algorithm used by Put, which otherwise defaults to sha256.
+func New(ctx context.Context, path string, config interface{}) (engine casengine.Engine, err error) {
+	configMap, err := stringMap(config)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, ok := configMap["uri"]
+	if !ok {
+		return nil, fmt.Errorf("dir config missing required 'uri' property: %v", configMap)
+	}
+
+	algorithm := digest.SHA256
+	algorithmString, ok := configMap["algorithm"]
+	if ok {
+		algorithm = digest.Algorithm(algorithmString)
+		if !algorithm.Available() {
+			return nil, fmt.Errorf("dir config 'algorithm' %q is not available", algorithmString)
+		}
+	}
+
+	engine, err = NewEngine(ctx, path, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	engine.(*Engine).Algorithm = algorithm
+	return engine, nil
+}
+
+// newFromURI adapts New to read.New for the protocol registry.  The
+// baseURI must be a file URI whose path is the store's root directory,
+// and relative 'uri' properties are resolved against it.
+func newFromURI(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	if baseURI == nil || baseURI.Scheme != "file" {
+		return nil, fmt.Errorf("dir engine requires a file:// base URI, not %v", baseURI)
+	}
+
+	return New(ctx, baseURI.Path, config)
+}
+
+// stringMap converts a map[string]string or map[string]interface{}
+// with string values into a map[string]string.
+func stringMap(config interface{}) (configMap map[string]string, err error) {
+	configMap, ok := config.(map[string]string)
+	if ok {
+		return configMap, nil
+	}
+
+	configMap2, ok := config.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("dir config is not a map[string]string: %v", config)
+	}
+
+	configMap = make(map[string]string)
+	for key, value := range configMap2 {
+		configMap[key], ok = value.(string)
+		if !ok {
+			return nil, fmt.Errorf("dir config %q is not a string: %v", key, value)
+		}
+	}
+
+	return configMap, nil
+}
+
+func init() {
+	read.Register("oci-cas-dir-v1", read.ReadWrite, newFromURI)
+}
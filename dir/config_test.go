@@ -0,0 +1,150 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+func TestRegistration(t *testing.T) {
+	ctx := context.Background()
+
+	constructor, err := read.Lookup("oci-cas-dir-v1", read.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, read.ReadWrite, constructor.Capability)
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	base, err := url.Parse("file://" + temp + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := constructor.New(ctx, base, map[string]string{
+		"uri": "blobs/{algorithm}/{encoded:2}/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	digest, err := engine.(casengine.Engine).Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(fmt.Sprintf("%s/blobs/sha256/df/%s", temp, digest.Encoded()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewAlgorithm(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := New(ctx, temp, map[string]interface{}{
+		"uri":       fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		"algorithm": "sha512",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	digest, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(
+		t,
+		"sha512:374d794a95cdcfd8b35993185fef9ba368f160d8daf432d08ba9f1ed1e5abe6cc69291e0fa2fe0006a52570ef18c19def4e617c33ce52ef0a6e5fbe318cb0387",
+		digest.String(),
+	)
+}
+
+func TestNewBad(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	for _, testcase := range []struct {
+		name     string
+		config   interface{}
+		expected string
+	}{
+		{
+			name:     "config not a map",
+			config:   "not a map",
+			expected: `^dir config is not a map\[string\]string: .*`,
+		},
+		{
+			name:     "missing 'uri' property",
+			config:   map[string]string{},
+			expected: `^dir config missing required 'uri' property: .*`,
+		},
+		{
+			name: "algorithm not a string",
+			config: map[string]interface{}{
+				"uri":       "blobs/{algorithm}/{encoded}",
+				"algorithm": 1,
+			},
+			expected: `^dir config "algorithm" is not a string: 1$`,
+		},
+		{
+			name: "unavailable algorithm",
+			config: map[string]string{
+				"uri":       "blobs/{algorithm}/{encoded}",
+				"algorithm": "md5",
+			},
+			expected: `^dir config 'algorithm' "md5" is not available$`,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			engine, err := New(ctx, temp, testcase.config)
+			if err == nil {
+				engine.Close(ctx)
+				t.Fatalf("expected %s", testcase.expected)
+			}
+			assert.Regexp(t, testcase.expected, err.Error())
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// CopyFrom copies the blob for digest from src into this store.  The
+// content is streamed to a temporary file and verified against digest
+// as it is written, so it is only hashed once, and it is only renamed
+// into place if it matches.  Returns an error wrapping
+// casengine.ErrDigestMismatch if it does not.
+func (engine *Engine) CopyFrom(ctx context.Context, src casengine.Reader, digest digest.Digest) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	err = digest.Validate()
+	if err != nil {
+		return err
+	}
+
+	reader, err := src.Get(ctx, digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	verifier := digest.Verifier()
+	tempPath, size, checksum, err := engine.writeTemp(reader, verifier)
+	if err != nil {
+		return err
+	}
+
+	if !verifier.Verified() {
+		err2 := engine.FileSystem.Remove(tempPath)
+		if err2 != nil {
+			logrus.Error(err2)
+		}
+		return fmt.Errorf("%w: %s", casengine.ErrDigestMismatch, digest)
+	}
+
+	return engine.place(tempPath, size, &PutResult{
+		Digest: digest,
+		Size:   size,
+	}, checksum)
+}
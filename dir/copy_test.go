@@ -0,0 +1,110 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestCopyFrom(t *testing.T) {
+	ctx := context.Background()
+
+	engines := []casengine.Engine{}
+	for i := 0; i < 2; i++ {
+		temp, err := ioutil.TempDir("", "casengine-dir-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(temp)
+
+		engine, err := NewEngine(
+			ctx,
+			temp,
+			fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+		engines = append(engines, engine)
+	}
+	src, dest := engines[0], engines[1]
+
+	good, err := src.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt, err := src.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := src.(*Engine).getPath(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(path, []byte("Goodbye, World?"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("good", func(t *testing.T) {
+		err := dest.(*Engine).CopyFrom(ctx, src, good)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := dest.Get(ctx, good)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Hello, World!", string(content))
+	})
+
+	t.Run("corrupt source", func(t *testing.T) {
+		err := dest.(*Engine).CopyFrom(ctx, src, corrupt)
+		if !errors.Is(err, casengine.ErrDigestMismatch) {
+			t.Fatalf("expected an error matching %s, got %v", casengine.ErrDigestMismatch, err)
+		}
+
+		_, err = dest.(*Engine).Stat(ctx, corrupt)
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be missing, got %v", corrupt, err)
+		}
+
+		entries, err := ioutil.ReadDir(dest.(*Engine).temp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, entries)
+	})
+}
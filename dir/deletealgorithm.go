@@ -0,0 +1,144 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// DeleteAlgorithm removes every stored blob for algorithm, e.g. when
+// deprecating a hash algorithm, and returns the number of blobs
+// removed.  Blobs are removed with Delete as the store is walked, so
+// ctx may cancel the walk partway through, with deleted counting the
+// blobs removed so far.  Blobs of algorithm Put during the walk may
+// survive it.
+//
+// If the URI Template gives the algorithm its own directory, empty
+// directories left under it (and the algorithm directory itself) are
+// removed afterwards.  Operations wait during that cleanup, so a
+// concurrent Put never has its new directory removed underneath it.
+func (engine *DigestListerEngine) DeleteAlgorithm(ctx context.Context, algorithm digest.Algorithm) (deleted int, err error) {
+	glob, err := engine.Engine.digestGlob(algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	err = engine.walkAlgorithm(ctx, glob, algorithm, func(dig digest.Digest, path string) (err error) {
+		err = engine.Engine.Delete(ctx, dig)
+		if err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	allGlob, err := engine.Engine.digestGlob("")
+	if err != nil {
+		return deleted, err
+	}
+
+	algorithmRoot := globRoot(glob)
+	if algorithmRoot == globRoot(allGlob) {
+		// the algorithm does not have its own directory
+		return deleted, nil
+	}
+
+	end, err := engine.beginExclusive()
+	if err != nil {
+		return deleted, err
+	}
+	defer end()
+
+	engine.removeEmptyTree(algorithmRoot)
+	return deleted, nil
+}
+
+// DeleteAlgorithmPlan is a dry run of DeleteAlgorithm.  It returns
+// the blobs which DeleteAlgorithm would remove, without changing the
+// store.
+func (engine *DigestListerEngine) DeleteAlgorithmPlan(ctx context.Context, algorithm digest.Algorithm) (plan *Plan, err error) {
+	glob, err := engine.Engine.digestGlob(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	plan = &Plan{}
+	err = engine.walkAlgorithm(ctx, glob, algorithm, func(dig digest.Digest, path string) (err error) {
+		info, err := engine.FileSystem.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		plan.add(dig, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// walkAlgorithm calls callback for each stored blob of algorithm
+// matching glob.
+func (engine *DigestListerEngine) walkAlgorithm(ctx context.Context, glob string, algorithm digest.Algorithm, callback func(dig digest.Digest, path string) (err error)) (err error) {
+	return walkGlob(ctx, engine.FileSystem, glob, func(match string) (err error) {
+		if isSidecar(match) {
+			return nil
+		}
+
+		dig, err := engine.getDigest(match)
+		if err != nil {
+			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
+			return nil
+		}
+		if dig.Algorithm() != algorithm {
+			return nil
+		}
+
+		return callback(dig, match)
+	})
+}
+
+// removeEmptyTree removes dir and the directories beneath it,
+// leaving any which are not empty.
+func (engine *Engine) removeEmptyTree(dir string) {
+	entries, err := engine.FileSystem.ReadDir(dir)
+	if err != nil {
+		logrus.Debugf("leaving %s: %s", dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			engine.removeEmptyTree(filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	err = engine.FileSystem.Remove(dir)
+	if err != nil {
+		logrus.Debugf("leaving %s: %s", dir, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDeleteAlgorithm(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(ctx)
+	engine.(*DigestListerEngine).QuickChecksum = true
+
+	var expected []string
+	var planned []digest.Digest
+	var plannedBytes int64
+	for i := 0; i < 10; i++ {
+		content := fmt.Sprintf("blob %d", i)
+		for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+			dig, err := engine.Put(ctx, algorithm, strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if algorithm == digest.SHA256 {
+				expected = append(expected, dig.String())
+			} else {
+				planned = append(planned, dig)
+				plannedBytes += int64(len(content))
+			}
+		}
+	}
+
+	plan, err := engine.(*DigestListerEngine).DeleteAlgorithmPlan(ctx, digest.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, planned, plan.Digests)
+	assert.Equal(t, plannedBytes, plan.Bytes)
+	for _, dig := range planned {
+		_, err = engine.(*DigestListerEngine).Stat(ctx, dig)
+		assert.NoError(t, err)
+	}
+
+	deleted, err := engine.(*DigestListerEngine).DeleteAlgorithm(ctx, digest.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 10, deleted)
+
+	var digests []string
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, expected, digests)
+
+	_, err = os.Stat(filepath.Join(temp, "blobs", "sha512"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = engine.Put(ctx, digest.SHA512, strings.NewReader("Hello, World!"))
+	assert.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = engine.(*DigestListerEngine).DeleteAlgorithm(cancelled, digest.SHA512)
+	assert.Equal(t, context.Canceled, err)
+}
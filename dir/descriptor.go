@@ -0,0 +1,40 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/net/context"
+)
+
+// PutDescriptor is like Put, but it returns an OCI descriptor for the
+// stored blob with the given mediaType, for use when building
+// manifests.
+// https://github.com/opencontainers/image-spec/blob/v1.0.1/descriptor.md
+func (engine *Engine) PutDescriptor(ctx context.Context, mediaType string, algorithm digest.Algorithm, reader io.Reader) (descriptor ocispec.Descriptor, err error) {
+	result, err := engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return descriptor, err
+	}
+
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    result.Digest,
+		Size:      result.Size,
+	}, nil
+}
@@ -16,8 +16,8 @@ package dir
 
 import (
 	"fmt"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/opencontainers/go-digest"
@@ -31,6 +31,11 @@ import (
 // and is required to support Digests.
 type GetDigest func(path string) (digest digest.Digest, err error)
 
+// GetEncoded calculates the encoded portion of the digest
+// corresponding to a given relative path.  It is an optional
+// optimization for Digests calls with a known algorithm.
+type GetEncoded func(path string) (encoded string, err error)
+
 // RegexpGetDigest is a helper structure for regular-expression based
 // GetDigest implementations.
 type RegexpGetDigest struct {
@@ -42,20 +47,26 @@ type DigestListerEngine struct {
 	*Engine
 
 	getDigest GetDigest
+
+	// GetEncoded, if set, is used instead of the getDigest passed to
+	// NewDigestListerEngine when Digests is called with a non-empty
+	// algorithm, which saves re-deriving the algorithm from each
+	// path.
+	GetEncoded GetEncoded
+
+	// ResolvePrefixes makes Get accept digests whose encoded portion
+	// is truncated, like git's short hashes, resolving them with
+	// ResolvePrefix.  This is a convenience for human-facing tools.
+	// It is off by default because a prefix which is unique today may
+	// become ambiguous as blobs are added.
+	ResolvePrefixes bool
 }
 
 // GetDigest implements GetDigest for RegexpGetDigest.
 func (r *RegexpGetDigest) GetDigest(path string) (dig digest.Digest, err error) {
-	matches := make(map[string]string)
-	submatches := r.Regexp.FindStringSubmatch(path)
-	for i, submatchName := range r.Regexp.SubexpNames() {
-		if submatchName == "" {
-			continue
-		}
-		if i > len(submatches) {
-			return "", fmt.Errorf("%q does not match %q", path, r.Regexp.String())
-		}
-		matches[submatchName] = submatches[i]
+	matches, err := r.matches(path)
+	if err != nil {
+		return "", err
 	}
 
 	algorithm, ok := matches["algorithm"]
@@ -71,6 +82,36 @@ func (r *RegexpGetDigest) GetDigest(path string) (dig digest.Digest, err error)
 	return digest.Parse(fmt.Sprintf("%s:%s", algorithm, encoded))
 }
 
+// GetEncoded implements GetEncoded for RegexpGetDigest.
+func (r *RegexpGetDigest) GetEncoded(path string) (encoded string, err error) {
+	matches, err := r.matches(path)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, ok := matches["encoded"]
+	if !ok {
+		return "", fmt.Errorf("no 'encoded' capturing group in %q", r.Regexp.String())
+	}
+
+	return encoded, nil
+}
+
+func (r *RegexpGetDigest) matches(path string) (matches map[string]string, err error) {
+	matches = make(map[string]string)
+	submatches := r.Regexp.FindStringSubmatch(path)
+	for i, submatchName := range r.Regexp.SubexpNames() {
+		if submatchName == "" {
+			continue
+		}
+		if i > len(submatches) {
+			return nil, fmt.Errorf("%q does not match %q", path, r.Regexp.String())
+		}
+		matches[submatchName] = submatches[i]
+	}
+	return matches, nil
+}
+
 // NewDigestListerEngine creates a new CAS-engine instance that can
 // list the digests it contains.  Arguments are the same as for
 // NewEngine, with an additional getDigest used to translate paths to
@@ -87,50 +128,108 @@ func NewDigestListerEngine(ctx context.Context, path string, uri string, getDige
 	}, nil
 }
 
-// Digests implements DigestLister.Digests.
+// Digests implements DigestLister.Digests.  Results are sorted by
+// digest string regardless of the URI Template's path layout, so
+// paging with from is stable across calls.  Every matching path is
+// visited before the first callback.
 func (engine *DigestListerEngine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
 	if size == 0 {
 		return nil
 	}
-	globAlgorithm := algorithm.String()
-	if globAlgorithm == "" {
-		globAlgorithm = "*"
-	}
-	globDigest := digest.Digest(fmt.Sprintf("%s:*", globAlgorithm))
-	glob, err := engine.Engine.getPath(globDigest)
+	glob, err := engine.Engine.digestGlob(algorithm)
 	if err != nil {
 		return err
 	}
 
-	matches, err := filepath.Glob(glob)
+	_, err = engine.FileSystem.Stat(globRoot(glob))
 	if err != nil {
+		if isMissing(err) {
+			return nil
+		}
 		return err
 	}
 
-	offset := 0
-	count := 0
-	for _, match := range matches {
-		digest, err := engine.getDigest(match)
+	digests := []digest.Digest{}
+	err = walkGlob(ctx, engine.FileSystem, glob, func(match string) (err error) {
+		if isSidecar(match) {
+			return nil
+		}
+
+		digest, err := engine.matchDigest(algorithm, match)
 		if err != nil {
 			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
-			continue
+			return nil
 		}
 
 		if algorithm.String() == "" || digest.Algorithm() == algorithm {
 			if prefix == "" || strings.HasPrefix(digest.Encoded(), prefix) {
-				if offset >= from {
-					err = callback(ctx, digest)
-					if err != nil {
-						return err
-					}
-					count++
-					if size != -1 && count >= size {
-						return nil
-					}
-				}
-				offset++
+				digests = append(digests, digest)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(digests); i++ {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = callback(ctx, digests[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
 	}
 	return nil
 }
+
+// matchDigest calculates the digest for a path matched by Digests.
+// Paths which are not where the URI Template would put the computed
+// digest, like files in a sibling directory which happen to be
+// matched by the glob, are rejected.
+func (engine *DigestListerEngine) matchDigest(algorithm digest.Algorithm, path string) (dig digest.Digest, err error) {
+	if engine.GetEncoded == nil || algorithm.String() == "" {
+		dig, err = engine.getDigest(path)
+	} else {
+		var encoded string
+		encoded, err = engine.GetEncoded(path)
+		if err != nil {
+			return "", err
+		}
+
+		err = algorithm.Validate(encoded)
+		if err != nil {
+			return "", err
+		}
+
+		dig = digest.NewDigestFromEncoded(algorithm, encoded)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	expected, err := engine.Engine.globPath(dig)
+	if err != nil {
+		return "", err
+	}
+	if expected != path {
+		return "", fmt.Errorf("%s belongs at %q", dig, expected)
+	}
+
+	return dig, nil
+}
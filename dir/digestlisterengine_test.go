@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 
@@ -72,6 +73,12 @@ func TestDigestListerEngineGood(t *testing.T) {
 	runGet(ctx, t, engine)
 	runAlgorithms(ctx, t, engine)
 	runDigests(ctx, t, engine)
+
+	engine.(*DigestListerEngine).GetEncoded = (&RegexpGetDigest{
+		Regexp: getDigestRegexp,
+	}).GetEncoded
+	runDigests(ctx, t, engine)
+
 	runDelete(ctx, t, engine)
 }
 
@@ -155,3 +162,161 @@ func runDigests(ctx context.Context, t *testing.T, engine casengine.DigestLister
 		}
 	})
 }
+
+// newTestDigestListerEngine creates a DigestListerEngine with the
+// same layout as TestDigestListerEngineGood.
+func newTestDigestListerEngine(ctx context.Context, t testing.TB, temp string) (engine casengine.DigestListerEngine) {
+	if filepath.Separator != '/' {
+		t.Fatalf("full URI not implemented for filepath.Separator %q", filepath.Separator)
+	}
+
+	getDigestRegexp, err := regexp.Compile(`^.*/blobs/(?P<algorithm>[a-z0-9+._-]+)/[a-zA-Z0-9=_-]{1,2}/(?P<encoded>[a-zA-Z0-9=_-]{1,})$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err = NewDigestListerEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		(&RegexpGetDigest{
+			Regexp: getDigestRegexp,
+		}).GetDigest,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return engine
+}
+
+func BenchmarkDigestsAlgorithm(b *testing.B) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, b, temp)
+	defer engine.Close(ctx)
+
+	for i := 0; i < 256; i++ {
+		_, err = engine.Put(ctx, digest.SHA256, strings.NewReader(fmt.Sprintf("blob %d", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	getDigestRegexp := regexp.MustCompile(`^.*/blobs/(?P<algorithm>[a-z0-9+._-]+)/[a-zA-Z0-9=_-]{1,2}/(?P<encoded>[a-zA-Z0-9=_-]{1,})$`)
+	for _, testcase := range []struct {
+		name       string
+		getEncoded GetEncoded
+	}{
+		{
+			name: "GetDigest",
+		},
+		{
+			name: "GetEncoded",
+			getEncoded: (&RegexpGetDigest{
+				Regexp: getDigestRegexp,
+			}).GetEncoded,
+		},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			engine.(*DigestListerEngine).GetEncoded = testcase.getEncoded
+			for i := 0; i < b.N; i++ {
+				err := engine.Digests(ctx, digest.SHA256, "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestsOrder(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	// Putting {encoded} before {algorithm} makes lexical path order
+	// differ from digest order.
+	engine, err := NewDigestListerEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{encoded}/{algorithm}", temp),
+		(&RegexpGetDigest{
+			Regexp: regexp.MustCompile(`^.*/blobs/(?P<encoded>[a-zA-Z0-9=_-]{1,})/(?P<algorithm>[a-z0-9+._-]+)$`),
+		}).GetDigest,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	expected := []string{}
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		for _, content := range []string{"", "Hello, World!", "Goodbye, World!"} {
+			dig, err := engine.Put(ctx, algorithm, strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, dig.String())
+		}
+	}
+	sort.Strings(expected)
+
+	for _, size := range []int{-1, 1, 2, 4} {
+		t.Run(fmt.Sprintf("size %d", size), func(t *testing.T) {
+			digests := []string{}
+			for from := 0; from < len(expected); {
+				page := []string{}
+				err := engine.Digests(ctx, "", "", size, from, func(ctx context.Context, digest digest.Digest) (err error) {
+					page = append(page, digest.String())
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) == 0 {
+					t.Fatalf("empty page from %d", from)
+				}
+				digests = append(digests, page...)
+				from += len(page)
+			}
+
+			assert.Equal(t, expected, digests)
+		})
+	}
+}
+
+func TestDigestsEmptyStore(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(ctx)
+
+	count := 0
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
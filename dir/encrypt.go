@@ -0,0 +1,487 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/counter"
+	"golang.org/x/net/context"
+)
+
+// encryptedChunkSize is the size of the plaintext chunks sealed by
+// EncryptedEngine.
+const encryptedChunkSize = 64 * 1024
+
+// ErrDecryptionFailed is returned when reading an encrypted blob
+// which cannot be authenticated with the engine's key, e.g. because
+// it was corrupted, truncated, or encrypted with a different key.
+var ErrDecryptionFailed = errors.New("blob decryption failed")
+
+// EncryptedEngine is a CAS engine which encrypts blob content at rest
+// with AES-GCM.  Digests are calculated over the plaintext, so blobs
+// are addressed (and stored at the same paths) as they would be by
+// Engine, and Get and Stat return the plaintext and its size.
+//
+// Blobs are stored as a random nonce followed by the plaintext sealed
+// in 64 KiB chunks, each authenticated with its position and whether
+// it is the final chunk, so reordering and truncation are detected.
+// The wrapped Engine is not exposed, so content can only be written
+// and read through the encrypting and decrypting methods.
+// CollisionCheck is not supported, because two encryptions of the
+// same plaintext never match.
+type EncryptedEngine struct {
+	engine *Engine
+
+	aead cipher.AEAD
+}
+
+// NewEncryptedEngine creates a new CAS-engine instance.  The path and
+// uri arguments are the same as for NewEngine.  The key must be 16,
+// 24, or 32 bytes long, selecting AES-128, AES-192, or AES-256.
+func NewEncryptedEngine(ctx context.Context, path string, uri string, key []byte) (engine casengine.Engine, err error) {
+	base, err := NewEngine(ctx, path, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	engine, err = NewEncrypted(base.(*Engine), key)
+	if err != nil {
+		base.Close(ctx)
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// NewEncrypted creates a new EncryptedEngine wrapping engine, e.g.
+// after setting options like Algorithm, TTL, or MaxOpenFiles on it.
+// The key is the same as for NewEncryptedEngine.  The EncryptedEngine
+// takes ownership of engine, which should not be used directly
+// afterwards, because its methods read and write the ciphertext.
+func NewEncrypted(engine *Engine, key []byte) (encrypted *EncryptedEngine, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedEngine{
+		engine: engine,
+		aead:   aead,
+	}, nil
+}
+
+// Get implements Reader.Get, returning the decrypted content.  Reads
+// return an error wrapping ErrDecryptionFailed if the stored blob
+// cannot be authenticated.
+func (engine *EncryptedEngine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	return engine.engine.get(ctx, digest, func(reader io.ReadCloser) io.ReadCloser {
+		return &decryptingReader{
+			ReadCloser: reader,
+			source:     bufio.NewReader(reader),
+			aead:       engine.aead,
+		}
+	})
+}
+
+// GetReadSeeker is like Engine.GetReadSeeker, but it returns the
+// decrypted content.  Seeking only decrypts the chunk containing the
+// new offset, so HTTP Range requests (e.g. through httpfs) do not
+// read the skipped content.  Reads return an error wrapping
+// ErrDecryptionFailed if a chunk cannot be authenticated.
+func (engine *EncryptedEngine) GetReadSeeker(ctx context.Context, digest digest.Digest) (reader io.ReadSeekCloser, err error) {
+	err = engine.engine.checkExpiry(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := engine.engine.GetReadSeeker(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	storedSize, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	size, chunks, err := engine.plaintextSize(storedSize)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", err, digest)
+	}
+
+	return &decryptingReadSeeker{
+		file:   file,
+		aead:   engine.aead,
+		size:   size,
+		chunks: chunks,
+		index:  -1,
+	}, nil
+}
+
+// Stat implements Stater.Stat, returning the size of the plaintext.
+func (engine *EncryptedEngine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	size, err = engine.engine.Stat(ctx, digest)
+	if err != nil {
+		return -1, err
+	}
+
+	size, _, err = engine.plaintextSize(size)
+	if err != nil {
+		return -1, fmt.Errorf("%w: %s", err, digest)
+	}
+
+	return size, nil
+}
+
+// GetInfo is like Engine.GetInfo, but it reports the size of the
+// plaintext.
+func (engine *EncryptedEngine) GetInfo(ctx context.Context, digest digest.Digest) (info *BlobInfo, err error) {
+	size, err := engine.Stat(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Digest: digest,
+		Size:   size,
+		ETag:   casengine.ETag(digest),
+	}, nil
+}
+
+// plaintextSize returns the plaintext size and the number of chunks
+// for a blob whose ciphertext is storedSize bytes.
+func (engine *EncryptedEngine) plaintextSize(storedSize int64) (size int64, chunks int64, err error) {
+	nonceSize := int64(engine.aead.NonceSize())
+	sealedChunkSize := int64(encryptedChunkSize + engine.aead.Overhead())
+	size = storedSize - nonceSize
+	chunks = (size + sealedChunkSize - 1) / sealedChunkSize
+	size -= chunks * int64(engine.aead.Overhead())
+	if chunks == 0 || size < 0 {
+		return -1, 0, fmt.Errorf("%w: the stored blob is too short", ErrDecryptionFailed)
+	}
+
+	return size, chunks, nil
+}
+
+// Exists is like Engine.Exists.
+func (engine *EncryptedEngine) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	return engine.engine.Exists(ctx, digest)
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.
+func (engine *EncryptedEngine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	return engine.engine.Algorithms(ctx, prefix, size, from, callback)
+}
+
+// Put implements Writer.Put.
+func (engine *EncryptedEngine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	result, err := engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// PutInfo is like Engine.PutInfo, but it encrypts the stored content.
+// The returned digest and size are for the plaintext.
+func (engine *EncryptedEngine) PutInfo(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (result *PutResult, err error) {
+	err = engine.engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.engine.operations.Done()
+
+	if engine.engine.CollisionCheck {
+		return nil, fmt.Errorf("CollisionCheck is not supported for encrypted engines")
+	}
+
+	if algorithm.String() == "" {
+		algorithm = engine.engine.Algorithm
+	}
+
+	nonce := make([]byte, engine.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	digester := algorithm.Digester()
+	counter := &counter.Counter{}
+	plaintext := io.TeeReader(reader, io.MultiWriter(digester.Hash(), counter))
+	tempPath, storedSize, checksum, err := engine.engine.writeTemp(&encryptingReader{
+		source:    bufio.NewReader(plaintext),
+		aead:      engine.aead,
+		nonce:     nonce,
+		buffer:    append([]byte{}, nonce...),
+		plaintext: make([]byte, encryptedChunkSize),
+	}, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &PutResult{
+		Digest: digester.Digest(),
+		Size:   int64(counter.Count()),
+	}
+	err = engine.engine.place(tempPath, storedSize, result, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Delete implements Deleter.Delete.
+func (engine *EncryptedEngine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	return engine.engine.Delete(ctx, digest)
+}
+
+// Close implements Closer.Close.
+func (engine *EncryptedEngine) Close(ctx context.Context) (err error) {
+	return engine.engine.Close(ctx)
+}
+
+// chunkNonce returns the nonce for the index'th chunk of a blob.
+func chunkNonce(nonce []byte, index uint64) []byte {
+	chunk := append([]byte{}, nonce...)
+	offset := len(chunk) - 8
+	binary.BigEndian.PutUint64(chunk[offset:], binary.BigEndian.Uint64(chunk[offset:])^index)
+	return chunk
+}
+
+// chunkData returns the additional authenticated data for a chunk.
+func chunkData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// readChunk fills chunk from source, returning the number of bytes
+// read and whether the chunk is the last one.
+func readChunk(source *bufio.Reader, chunk []byte) (n int, final bool, err error) {
+	n, err = io.ReadFull(source, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+
+	_, err = source.Peek(1)
+	if err == io.EOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
+
+// encryptingReader reads plaintext from source and returns the nonce
+// followed by the sealed chunks.
+type encryptingReader struct {
+	source    *bufio.Reader
+	aead      cipher.AEAD
+	nonce     []byte
+	index     uint64
+	buffer    []byte
+	plaintext []byte
+	sealed    []byte
+	done      bool
+}
+
+// Read implements io.Reader.Read.
+func (reader *encryptingReader) Read(p []byte) (n int, err error) {
+	for len(reader.buffer) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+
+		n, final, err := readChunk(reader.source, reader.plaintext)
+		if err != nil {
+			return 0, err
+		}
+
+		reader.sealed = reader.aead.Seal(reader.sealed[:0], chunkNonce(reader.nonce, reader.index), reader.plaintext[:n], chunkData(final))
+		reader.buffer = reader.sealed
+		reader.index++
+		reader.done = final
+	}
+
+	n = copy(p, reader.buffer)
+	reader.buffer = reader.buffer[n:]
+	return n, nil
+}
+
+// decryptingReader reads a nonce and sealed chunks from source and
+// returns the plaintext.
+type decryptingReader struct {
+	io.ReadCloser
+	source     *bufio.Reader
+	aead       cipher.AEAD
+	nonce      []byte
+	index      uint64
+	buffer     []byte
+	ciphertext []byte
+	plaintext  []byte
+	done       bool
+}
+
+// Read implements io.Reader.Read.
+func (reader *decryptingReader) Read(p []byte) (n int, err error) {
+	if reader.nonce == nil {
+		nonce := make([]byte, reader.aead.NonceSize())
+		_, err = io.ReadFull(reader.source, nonce)
+		if err != nil {
+			return 0, fmt.Errorf("%w: reading nonce: %s", ErrDecryptionFailed, err)
+		}
+		reader.nonce = nonce
+		reader.ciphertext = make([]byte, encryptedChunkSize+reader.aead.Overhead())
+	}
+
+	for len(reader.buffer) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+
+		n, final, err := readChunk(reader.source, reader.ciphertext)
+		if err != nil {
+			return 0, err
+		}
+
+		reader.plaintext, err = reader.aead.Open(reader.plaintext[:0], chunkNonce(reader.nonce, reader.index), reader.ciphertext[:n], chunkData(final))
+		if err != nil {
+			return 0, fmt.Errorf("%w: chunk %d: %s", ErrDecryptionFailed, reader.index, err)
+		}
+		reader.buffer = reader.plaintext
+		reader.index++
+		reader.done = final
+	}
+
+	n = copy(p, reader.buffer)
+	reader.buffer = reader.buffer[n:]
+	return n, nil
+}
+
+// decryptingReadSeeker decrypts the chunk containing the current
+// offset from a seekable encrypted blob.
+type decryptingReadSeeker struct {
+	file       io.ReadSeekCloser
+	aead       cipher.AEAD
+	nonce      []byte
+	size       int64
+	chunks     int64
+	offset     int64
+	index      int64
+	ciphertext []byte
+	plaintext  []byte
+}
+
+// Read implements io.Reader.Read.
+func (reader *decryptingReadSeeker) Read(p []byte) (n int, err error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+
+	index := reader.offset / encryptedChunkSize
+	if index != reader.index {
+		err = reader.load(index)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, reader.plaintext[reader.offset-index*encryptedChunkSize:])
+	reader.offset += int64(n)
+	return n, nil
+}
+
+// load decrypts the index'th chunk into plaintext.
+func (reader *decryptingReadSeeker) load(index int64) (err error) {
+	nonceSize := int64(reader.aead.NonceSize())
+	if reader.nonce == nil {
+		nonce := make([]byte, nonceSize)
+		_, err = reader.file.Seek(0, io.SeekStart)
+		if err == nil {
+			_, err = io.ReadFull(reader.file, nonce)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: reading nonce: %s", ErrDecryptionFailed, err)
+		}
+		reader.nonce = nonce
+		reader.ciphertext = make([]byte, encryptedChunkSize+reader.aead.Overhead())
+	}
+
+	sealedChunkSize := int64(len(reader.ciphertext))
+	_, err = reader.file.Seek(nonceSize+index*sealedChunkSize, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.ReadFull(reader.file, reader.ciphertext)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: chunk %d: %s", ErrDecryptionFailed, index, err)
+	}
+
+	reader.index = -1
+	reader.plaintext, err = reader.aead.Open(reader.plaintext[:0], chunkNonce(reader.nonce, uint64(index)), reader.ciphertext[:n], chunkData(index == reader.chunks-1))
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d: %s", ErrDecryptionFailed, index, err)
+	}
+	reader.index = index
+	return nil
+}
+
+// Seek implements io.Seeker.Seek.
+func (reader *decryptingReadSeeker) Seek(offset int64, whence int) (position int64, err error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return reader.offset, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if offset < 0 {
+		return reader.offset, fmt.Errorf("negative position %d", offset)
+	}
+
+	reader.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer.Close.
+func (reader *decryptingReadSeeker) Close() (err error) {
+	return reader.file.Close()
+}
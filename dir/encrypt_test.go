@@ -0,0 +1,422 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestEncryptedEngine(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEncryptedEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		bytes.Repeat([]byte{0x42}, 32),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, testcase := range []struct {
+		name    string
+		content []byte
+	}{
+		{
+			name:    "empty",
+			content: []byte{},
+		},
+		{
+			name:    "small",
+			content: []byte("Hello, World!"),
+		},
+		{
+			name:    "one chunk",
+			content: bytes.Repeat([]byte("a"), encryptedChunkSize),
+		},
+		{
+			name:    "several chunks",
+			content: bytes.Repeat([]byte("Hello, World!"), 2*encryptedChunkSize/13+1),
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			dig, err := engine.Put(ctx, "", bytes.NewReader(testcase.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, digest.FromBytes(testcase.content), dig)
+
+			path, err := engine.(*EncryptedEngine).engine.getPath(dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NotEqual(t, testcase.content, stored)
+			if len(testcase.content) > 0 {
+				assert.False(t, bytes.Contains(stored, testcase.content[:len(testcase.content)/2]))
+			}
+
+			size, err := engine.(*EncryptedEngine).Stat(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(len(testcase.content)), size)
+
+			info, err := engine.(*EncryptedEngine).GetInfo(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(len(testcase.content)), info.Size)
+			assert.Equal(t, dig, info.Digest)
+
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.content, content)
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		content := bytes.Repeat([]byte("Goodbye, World!"), 2*encryptedChunkSize/15+1)
+		dig, err := engine.Put(ctx, "", bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := engine.(*EncryptedEngine).engine.getPath(dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, corrupt := range map[string][]byte{
+			"flipped":                       append(append([]byte{}, stored[:100]...), append([]byte{stored[100] ^ 1}, stored[101:]...)...),
+			"truncated at a chunk boundary": stored[:len(stored)-(len(stored)-12)%(encryptedChunkSize+16)],
+		} {
+			t.Run(name, func(t *testing.T) {
+				err := ioutil.WriteFile(path, corrupt, 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				reader, err := engine.Get(ctx, dig)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer reader.Close()
+
+				_, err = ioutil.ReadAll(reader)
+				if !errors.Is(err, ErrDecryptionFailed) {
+					t.Fatalf("expected an error matching %s, got %v", ErrDecryptionFailed, err)
+				}
+			})
+		}
+	})
+}
+
+func TestEncryptedWritePaths(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{0x42}, 32)
+	content := []byte("Hello, World!")
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEncryptedEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	encrypted := engine.(*EncryptedEngine)
+
+	for _, testcase := range []struct {
+		name string
+		put  func() (dig digest.Digest, err error)
+	}{
+		{
+			name: "Put",
+			put: func() (dig digest.Digest, err error) {
+				return encrypted.Put(ctx, "", bytes.NewReader(content))
+			},
+		},
+		{
+			name: "PutInfo",
+			put: func() (dig digest.Digest, err error) {
+				result, err := encrypted.PutInfo(ctx, "", bytes.NewReader(content))
+				if err != nil {
+					return "", err
+				}
+				assert.Equal(t, int64(len(content)), result.Size)
+				return result.Digest, nil
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			dig, err := testcase.put()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, digest.FromBytes(content), dig)
+
+			path, err := encrypted.engine.getPath(dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.False(t, bytes.Contains(stored, content))
+
+			reader, err := encrypted.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, content, data)
+
+			err = encrypted.Delete(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("Created", func(t *testing.T) {
+		for i, created := range []bool{true, false} {
+			result, err := encrypted.PutInfo(ctx, "", bytes.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, created, result.Created, "Put %d", i)
+		}
+
+		err := encrypted.Delete(ctx, digest.FromBytes(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// the plaintext write paths of the wrapped engine are not exposed
+	for name, ok := range map[string]bool{
+		"PutDescriptor": func() bool {
+			_, ok := engine.(interface {
+				PutDescriptor(ctx context.Context, mediaType string, algorithm digest.Algorithm, reader io.Reader) (descriptor ocispec.Descriptor, err error)
+			})
+			return ok
+		}(),
+		"CopyFrom": func() bool {
+			_, ok := engine.(interface {
+				CopyFrom(ctx context.Context, src casengine.Reader, digest digest.Digest) (err error)
+			})
+			return ok
+		}(),
+		"PutReaderAt": func() bool {
+			_, ok := engine.(interface {
+				PutReaderAt(ctx context.Context, algorithm digest.Algorithm, reader io.ReaderAt, size int64) (dig digest.Digest, err error)
+			})
+			return ok
+		}(),
+	} {
+		assert.False(t, ok, name)
+	}
+}
+
+func TestEncryptedOptions(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	base, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	base.(*Engine).TTL = time.Hour
+	base.(*Engine).now = func() time.Time {
+		return now
+	}
+	base.(*Engine).MaxOpenFiles = 1
+
+	engine, err := NewEncrypted(base.(*Engine), bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("MaxOpenFiles", func(t *testing.T) {
+		reader, err := engine.Get(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = engine.Get(timeoutCtx, dig)
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		reader.Close()
+		reader, err = engine.Get(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Close()
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		_, err := engine.Get(ctx, dig)
+		assert.True(t, errors.Is(err, os.ErrNotExist), fmt.Sprint(err))
+
+		exists, err := engine.Exists(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, exists)
+	})
+}
+
+func TestEncryptedReadSeeker(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEncryptedEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		bytes.Repeat([]byte{0x42}, 32),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	encrypted := engine.(*EncryptedEngine)
+
+	content := make([]byte, 2*encryptedChunkSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	dig, err := engine.Put(ctx, "", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := encrypted.GetReadSeeker(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for _, testcase := range []struct {
+		name   string
+		offset int64
+		whence int
+		length int
+	}{
+		{name: "start", offset: 0, whence: io.SeekStart, length: 10},
+		{name: "across a chunk boundary", offset: encryptedChunkSize - 5, whence: io.SeekStart, length: 10},
+		{name: "final chunk", offset: -50, whence: io.SeekEnd, length: 50},
+		{name: "back to the first chunk", offset: 100, whence: io.SeekStart, length: 2 * encryptedChunkSize},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			position, err := reader.Seek(testcase.offset, testcase.whence)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := make([]byte, testcase.length)
+			_, err = io.ReadFull(reader, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, content[position:position+int64(testcase.length)], data)
+		})
+	}
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(len(content)), size)
+
+	_, err = reader.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
@@ -16,7 +16,10 @@
 package dir
 
 import (
+	"bytes"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -24,21 +27,145 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	"github.com/wking/casengine"
+	"github.com/wking/casengine/counter"
 	"github.com/wking/casengine/read/template"
 	"golang.org/x/net/context"
 )
 
+// algorithms lists the algorithms supported by Put, in the order
+// they are listed by Algorithms.
+var algorithms = []digest.Algorithm{
+	digest.SHA256,
+	digest.SHA384,
+	digest.SHA512,
+}
+
 // Engine is a CAS engine based on the local filesystem.
 type Engine struct {
 	temp   string
 	reader *template.Engine
 
+	mutex      sync.Mutex
+	closed     bool
+	operations sync.WaitGroup
+
+	// exclusive, if not nil, is closed when an in-progress exclusive
+	// operation (see beginExclusive) finishes.  It is guarded by
+	// mutex.
+	exclusive chan struct{}
+
+	stagingMutex sync.Mutex
+	staged       map[string]*stagedBlob
+
+	openFilesOnce sync.Once
+	openFiles     chan struct{}
+
+	// FileSystem is used for storing and enumerating blobs.
+	// NewEngine sets it to OSFileSystem.
+	FileSystem FileSystem
+
 	// Algorithm selects the Algorithm used for Put.
 	Algorithm digest.Algorithm
+
+	// AlgorithmOrder, if set, replaces the default order (SHA-256,
+	// SHA-384, SHA-512) in which Algorithms and PresentAlgorithms list
+	// algorithms, e.g. to list a preferred algorithm first.  Their
+	// prefix, size, and from pagination operates over this order.
+	// Algorithms missing from AlgorithmOrder are not listed.
+	AlgorithmOrder []digest.Algorithm
+
+	// QuickChecksum enables storing a CRC-32C sidecar alongside each
+	// blob written by Put.  See QuickVerify for more details.
+	QuickChecksum bool
+
+	// GzipCache enables storing the gzip-compressed rendition returned
+	// by GetGzip alongside the blob, so it is only compressed once.
+	GzipCache bool
+
+	// SmallBlobSize, if positive, enables a fast path for blobs of at
+	// most SmallBlobSize bytes.  Put buffers such blobs in memory and
+	// writes them directly to their final path, skipping the temporary
+	// file and rename.  A crash during that write can leave a
+	// truncated blob in place, so leave SmallBlobSize at zero when
+	// durability matters more than latency.
+	SmallBlobSize int64
+
+	// VerifySampleRate is the fraction of Get calls, between 0 and 1,
+	// whose readers verify the blob against its digest.  Reading a
+	// sampled blob which does not match returns an error wrapping
+	// ErrVerificationFailed instead of io.EOF.  This catches on-disk
+	// corruption probabilistically with bounded overhead.
+	VerifySampleRate float64
+
+	// ReadNoAtime makes Get open blobs with O_NOATIME, avoiding
+	// access-time updates during bulk reads.  It is ignored on
+	// platforms without O_NOATIME and for blobs which the process does
+	// not own.
+	ReadNoAtime bool
+
+	// ReadSequential makes Get advise the kernel that blobs will be
+	// read sequentially (POSIX_FADV_SEQUENTIAL).  It is ignored on
+	// platforms without posix_fadvise(2).
+	ReadSequential bool
+
+	// StrictDigests makes methods which take a digest return an error
+	// wrapping ErrNonCanonicalDigest for digests which are not in
+	// canonical form, e.g. with uppercase hex.  Otherwise such digests
+	// are normalized, so each blob has a single path.
+	StrictDigests bool
+
+	// CaseInsensitive declares that FileSystem folds case, as the
+	// default macOS and Windows filesystems do.  The encoded portion
+	// of hex digests is always lowercased before it is mapped to a
+	// path (see StrictDigests), but case-sensitive encodings like
+	// base64 may have digests which only differ by case, and so would
+	// share a path, e.g. with the {encoded:2} shard.  With
+	// CaseInsensitive, methods which take such a digest return an
+	// error wrapping ErrCaseCollision instead of reading or writing
+	// another digest's blob.
+	CaseInsensitive bool
+
+	// MaxOpenFiles, if positive, limits the number of blob files
+	// which Get and GetReadSeeker hold open at once, e.g. to stay
+	// under RLIMIT_NOFILE with many parallel readers.  Once the limit
+	// is reached, further calls block until a returned reader is
+	// closed or their context is done.  Set it before the first Get.
+	MaxOpenFiles int
+
+	// CollisionCheck makes Put compare new content byte-for-byte with
+	// any blob already stored under the computed digest, returning
+	// ErrDigestCollision if they differ.
+	CollisionCheck bool
+
+	// TTL, if positive, makes the engine act as a cache whose blobs
+	// expire.  Put records an expiry TTL in the future in a sidecar
+	// (refreshing it if the blob was already stored), Get and Stat
+	// treat blobs past their expiry as missing and remove them, and
+	// ExpireNow removes all expired blobs.  Blobs stored without an
+	// expiry never expire.  With the default zero TTL, no expiries are
+	// written or checked.
+	TTL time.Duration
+
+	// now, if set, replaces time.Now for TTL expiry, e.g. for tests.
+	now func() time.Time
+
+	// observer, if set, is notified of blobs added to or removed from
+	// the store, e.g. by IndexedEngine.
+	observer storeObserver
+
+	// Events, if set, receives an Event after each successful Put or
+	// Delete, e.g. to trigger cache invalidation or replication.
+	// Events are sent without blocking, so a slow consumer cannot
+	// stall operations: if the channel's buffer is full, the event
+	// is dropped with a warning.  Use a buffered channel sized for
+	// the expected bursts.
+	Events chan<- Event
 }
 
 // NewEngine creates a new CAS-engine instance.  The path argument is
@@ -76,20 +203,112 @@ func NewEngine(ctx context.Context, path string, uri string) (engine casengine.E
 		return nil, fmt.Errorf("root path not implemented for filepath.Separator %q", filepath.Separator)
 	}
 
+	eng := &Engine{
+		temp:       temp,
+		reader:     readEngine,
+		FileSystem: OSFileSystem{},
+		Algorithm:  digest.SHA256,
+	}
+
 	readEngine.Client = &http.Client{
-		Transport: http.NewFileTransport(http.Dir("/")),
+		Transport: http.NewFileTransport(&retryFileSystem{
+			FileSystem: &readFileSystem{engine: eng},
+		}),
 	}
 
-	return &Engine{
-		temp:      temp,
-		reader:    readEngine,
-		Algorithm: digest.SHA256,
-	}, nil
+	return eng, nil
 }
 
 // Get implements Reader.Get.
 func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
-	return engine.reader.Get(ctx, digest)
+	return engine.get(ctx, digest, nil)
+}
+
+// get implements Get.  If decode is not nil, it wraps the stored
+// content before sampled verification, e.g. to decrypt it.
+func (engine *Engine) get(ctx context.Context, digest digest.Digest, decode func(reader io.ReadCloser) io.ReadCloser) (reader io.ReadCloser, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
+	digest, err = engine.canonicalDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = engine.checkExpiry(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := engine.acquireFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = engine.reader.Get(ctx, digest)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return nil, engine.getError(digest, err)
+	}
+
+	if decode != nil {
+		reader = decode(reader)
+	}
+
+	reader = engine.sampleVerify(digest, reader)
+	if release == nil {
+		return reader, nil
+	}
+	return &releasingReadCloser{
+		ReadCloser: reader,
+		release:    release,
+	}, nil
+}
+
+// getError translates an error from the read engine's Get.  The file
+// transport reduces filesystem errors to HTTP status codes, so getError
+// stats the blob path to recover errors which pathError translates.
+func (engine *Engine) getError(digest digest.Digest, err error) error {
+	path, pathErr := engine.getPath(digest)
+	if pathErr != nil {
+		return err
+	}
+	_, statErr := engine.FileSystem.Stat(path)
+	if translated := pathError(statErr); translated != statErr {
+		return translated
+	}
+	return err
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	err = engine.begin()
+	if err != nil {
+		return -1, err
+	}
+	defer engine.operations.Done()
+
+	err = engine.checkExpiry(digest)
+	if err != nil {
+		return -1, err
+	}
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return -1, err
+	}
+
+	info, err := engine.FileSystem.Stat(path)
+	if err != nil {
+		return -1, pathError(err)
+	}
+
+	return info.Size(), nil
 }
 
 // Algorithms implements AlgorithmLister.Algorithms.
@@ -99,11 +318,7 @@ func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, f
 	}
 	offset := 0
 	count := 0
-	for _, algorithm := range []digest.Algorithm{
-		digest.SHA256,
-		digest.SHA384,
-		digest.SHA512,
-	} {
+	for _, algorithm := range engine.algorithmOrder() {
 		if prefix == "" || strings.HasPrefix(algorithm.String(), prefix) {
 			if offset >= from {
 				err = callback(ctx, algorithm)
@@ -121,70 +336,364 @@ func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, f
 	return nil
 }
 
+// algorithmOrder returns the order in which algorithms are listed.
+func (engine *Engine) algorithmOrder() (order []digest.Algorithm) {
+	if engine.AlgorithmOrder != nil {
+		return engine.AlgorithmOrder
+	}
+	return algorithms
+}
+
+// PresentAlgorithms is like Algorithms, but it only lists algorithms
+// with at least one stored blob.  Use Algorithms to discover which
+// algorithms Put supports.
+func (engine *Engine) PresentAlgorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+	offset := 0
+	count := 0
+	for _, algorithm := range engine.algorithmOrder() {
+		if prefix == "" || strings.HasPrefix(algorithm.String(), prefix) {
+			present, err := engine.hasBlobs(ctx, algorithm)
+			if err != nil {
+				return err
+			}
+			if !present {
+				continue
+			}
+			if offset >= from {
+				err = callback(ctx, algorithm)
+				if err != nil {
+					return err
+				}
+				count++
+				if size != -1 && count >= size {
+					return nil
+				}
+			}
+			offset++
+		}
+	}
+	return nil
+}
+
+// PutResult holds information about a blob stored by PutInfo.
+type PutResult struct {
+	// Digest is the digest of the stored blob.
+	Digest digest.Digest
+
+	// Size is the size of the stored blob in bytes.
+	Size int64
+
+	// Created is false if the blob was already in the store with
+	// matching content before the Put.
+	Created bool
+
+	// Duration is the wall-clock time spent reading the content and
+	// writing it to the filesystem.  It does not include waiting for
+	// the engine or moving the written blob into place, so it
+	// reflects ingest throughput.  See Rate.
+	Duration time.Duration
+}
+
+// Rate returns the throughput of the Put in bytes per second, or zero
+// if Duration is not positive.
+func (result *PutResult) Rate() (bytesPerSecond float64) {
+	if result.Duration <= 0 {
+		return 0
+	}
+	return float64(result.Size) / result.Duration.Seconds()
+}
+
 // Put implements Writer.Put.
 func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	result, err := engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// PutInfo is like Put, but it returns additional information about
+// the stored blob.  This is useful for deduplication metrics.
+func (engine *Engine) PutInfo(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (result *PutResult, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
 	if algorithm.String() == "" {
 		algorithm = engine.Algorithm
 	}
+
+	start := time.Now()
+	if engine.SmallBlobSize > 0 {
+		data, err := ioutil.ReadAll(io.LimitReader(reader, engine.SmallBlobSize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) > engine.SmallBlobSize {
+			reader = io.MultiReader(bytes.NewReader(data), reader)
+		} else {
+			result, err = engine.putSmall(algorithm, data)
+			if err != nil {
+				return nil, err
+			}
+			if result != nil {
+				result.Duration = time.Since(start)
+				return result, nil
+			}
+			reader = bytes.NewReader(data)
+		}
+	}
+
+	return engine.putTemp(algorithm, reader, start)
+}
+
+// putTemp writes a blob to a temporary file and then renames it into
+// place.  The result's Duration is measured from start.
+func (engine *Engine) putTemp(algorithm digest.Algorithm, reader io.Reader, start time.Time) (result *PutResult, err error) {
 	digester := algorithm.Digester()
 
-	file, err := ioutil.TempFile(engine.temp, "blob-")
+	tempPath, size, checksum, err := engine.writeTemp(reader, digester.Hash())
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	result = &PutResult{
+		Digest:   digester.Digest(),
+		Size:     size,
+		Duration: time.Since(start),
+	}
+	err = engine.place(tempPath, size, result, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// writeTemp copies reader to a new temporary file, also writing the
+// content to hasher.  It returns the temporary file's path, the size
+// of the content, and, if QuickChecksum is set, its CRC-32C checksum.
+func (engine *Engine) writeTemp(reader io.Reader, hasher io.Writer) (path string, size int64, checksum hash.Hash32, err error) {
+	file, err := engine.FileSystem.TempFile(engine.temp, "blob-")
+	if err != nil {
+		return "", -1, nil, err
 	}
 
 	defer func() {
 		if err != nil {
-			err2 := os.Remove(file.Name())
+			err2 := engine.FileSystem.Remove(file.Name())
 			if err2 != nil {
 				logrus.Error(err2)
 			}
 		}
 	}()
 
-	hashingWriter := io.MultiWriter(file, digester.Hash())
+	counter := &counter.Counter{}
+	writers := []io.Writer{file, hasher, counter}
+	if engine.QuickChecksum {
+		checksum = crc32.New(castagnoli)
+		writers = append(writers, checksum)
+	}
+
+	hashingWriter := io.MultiWriter(writers...)
 	_, err = io.Copy(hashingWriter, reader)
 	if err != nil {
-		return "", err
+		file.Close()
+		return "", -1, nil, err
 	}
 	file.Close()
 
-	dig = digester.Digest()
-	path, err := engine.getPath(dig)
+	return file.Name(), int64(counter.Count()), checksum, nil
+}
+
+// place renames a temporary file written by writeTemp to the path for
+// result.Digest, setting result.Created.  storedSize is the size of
+// the temporary file, which differs from result.Size when the content
+// is transformed before it is stored (e.g. by EncryptedEngine).  The
+// temporary file is removed on error.
+func (engine *Engine) place(tempPath string, storedSize int64, result *PutResult, checksum hash.Hash32) (err error) {
+	defer func() {
+		if err != nil {
+			err2 := engine.FileSystem.Remove(tempPath)
+			if err2 != nil {
+				logrus.Error(err2)
+			}
+		}
+	}()
+
+	path, err := engine.getPath(result.Digest)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	err = os.MkdirAll(filepath.Dir(path), 0777)
+	info, err := engine.FileSystem.Stat(path)
+	existed := err == nil
+	result.Created = err != nil || info.Size() != storedSize
+	if err == nil && engine.CollisionCheck {
+		err = checkCollision(engine.FileSystem, result.Digest, tempPath, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	created, err := mkdirAll(engine.FileSystem, filepath.Dir(path), 0777)
 	if err != nil {
-		return "", err
+		return pathError(err)
+	}
+
+	defer func() {
+		if err != nil {
+			removeEmpty(engine.FileSystem, created)
+		}
+	}()
+
+	dir := filepath.Dir(path)
+	if checksum != nil {
+		err = retryMissingDir(engine.FileSystem, dir, &created, func() error {
+			return engine.putChecksum(path, checksum.Sum32())
+		})
+		if err != nil {
+			return pathError(err)
+		}
+
+		// don't leave a sidecar without a blob behind
+		defer func() {
+			if err != nil && !existed {
+				err2 := engine.FileSystem.Remove(path + checksumSuffix)
+				if err2 != nil {
+					logrus.Error(err2)
+				}
+			}
+		}()
 	}
 
-	err = os.Rename(file.Name(), path)
+	err = retryMissingDir(engine.FileSystem, dir, &created, func() error {
+		return engine.putExpiry(path)
+	})
 	if err != nil {
-		return "", err
+		return pathError(err)
 	}
 
-	return dig, nil
+	err = retryMissingDir(engine.FileSystem, dir, &created, func() error {
+		return engine.FileSystem.Rename(tempPath, path)
+	})
+	if err != nil {
+		return pathError(err)
+	}
+
+	engine.added(path)
+	engine.emit(OpPut, result.Digest, result.Size)
+	return nil
 }
 
 // Delete implements Deleter.Delete.
 func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
 	path, err := engine.getPath(digest)
 	if err != nil {
 		return err
 	}
 
-	err = os.Remove(path)
-	if os.IsNotExist(err) {
-		return nil
+	size := int64(-1)
+	if engine.Events != nil {
+		info, err := engine.FileSystem.Stat(path)
+		if err != nil {
+			// nothing to delete, so nothing to report
+			return engine.remove(path)
+		}
+		size = info.Size()
 	}
-	return err
+
+	err = engine.remove(path)
+	if err != nil {
+		return err
+	}
+
+	engine.emit(OpDelete, digest, size)
+	return nil
+}
+
+// DeleteIfSize is like Delete, but it only removes the blob if its
+// stored size is expectedSize.  Otherwise it returns an error wrapping
+// ErrSizeConflict.  Cleanup tools can use this for optimistic
+// concurrency, only deleting blobs which have not been replaced since
+// they were inspected.  Returns an error matching os.ErrNotExist if
+// the blob is not stored.
+func (engine *Engine) DeleteIfSize(ctx context.Context, digest digest.Digest, expectedSize int64) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return err
+	}
+
+	info, err := engine.FileSystem.Stat(path)
+	if err != nil {
+		return pathError(err)
+	}
+
+	if info.Size() != expectedSize {
+		return fmt.Errorf("%w: %s is %d bytes, not %d", ErrSizeConflict, digest, info.Size(), expectedSize)
+	}
+
+	err = engine.remove(path)
+	if err != nil {
+		return err
+	}
+
+	engine.emit(OpDelete, digest, expectedSize)
+	return nil
+}
+
+// remove removes the blob at path and any sidecars.
+func (engine *Engine) remove(path string) (err error) {
+	err = engine.FileSystem.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, suffix := range sidecarSuffixes {
+		err = engine.FileSystem.Remove(path + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	engine.removed(path)
+	return nil
 }
 
-// Close implements Closer.Close.
+// Close implements Closer.Close.  It rejects new operations with
+// ErrClosed and waits for in-flight operations to finish before
+// removing the temporary directory.
 func (engine *Engine) Close(ctx context.Context) (err error) {
-	err = os.RemoveAll(engine.temp)
+	engine.waitForExclusive()
+	if engine.closed {
+		engine.mutex.Unlock()
+		return ErrClosed
+	}
+	engine.closed = true
+	engine.mutex.Unlock()
+
+	engine.operations.Wait()
+
+	err = engine.FileSystem.RemoveAll(engine.temp)
 	if err != nil {
 		return err
 	}
@@ -192,7 +701,87 @@ func (engine *Engine) Close(ctx context.Context) (err error) {
 	return engine.reader.Close(ctx)
 }
 
+// begin registers an in-flight operation, which must call
+// engine.operations.Done when it finishes.  It returns ErrClosed if
+// Close has been called, and waits for any in-progress exclusive
+// operation.
+func (engine *Engine) begin() (err error) {
+	engine.waitForExclusive()
+	defer engine.mutex.Unlock()
+	if engine.closed {
+		return ErrClosed
+	}
+	engine.operations.Add(1)
+	return nil
+}
+
+// waitForExclusive waits until no exclusive operation is in progress
+// and returns with mutex held.
+func (engine *Engine) waitForExclusive() {
+	engine.mutex.Lock()
+	for engine.exclusive != nil {
+		exclusive := engine.exclusive
+		engine.mutex.Unlock()
+		<-exclusive
+		engine.mutex.Lock()
+	}
+}
+
+// beginExclusive starts an operation which must not overlap any
+// other, like Swap.  It waits for in-flight operations to finish and
+// holds off new ones until end is called.  It returns ErrClosed if
+// Close has been called.
+func (engine *Engine) beginExclusive() (end func(), err error) {
+	engine.waitForExclusive()
+	if engine.closed {
+		engine.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	exclusive := make(chan struct{})
+	engine.exclusive = exclusive
+	engine.mutex.Unlock()
+
+	engine.operations.Wait()
+
+	return func() {
+		engine.mutex.Lock()
+		engine.exclusive = nil
+		engine.mutex.Unlock()
+		close(exclusive)
+	}, nil
+}
+
+// hasBlobs returns true if at least one blob is stored for algorithm.
+func (engine *Engine) hasBlobs(ctx context.Context, algorithm digest.Algorithm) (present bool, err error) {
+	glob, err := engine.digestGlob(algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	err = walkGlob(ctx, engine.FileSystem, glob, func(path string) (err error) {
+		if isSidecar(path) {
+			return nil
+		}
+		present = true
+		return errStopWalk
+	})
+	return present, err
+}
+
+// getPath returns the path for a blob, after checking the digest with
+// canonicalDigest.
 func (engine *Engine) getPath(digest digest.Digest) (path string, err error) {
+	digest, err = engine.canonicalDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return engine.globPath(digest)
+}
+
+// globPath is like getPath, but it does not check the digest, so the
+// digest may contain glob wildcards like "sha256:*".
+func (engine *Engine) globPath(digest digest.Digest) (path string, err error) {
 	if filepath.Separator != '/' {
 		return "", fmt.Errorf("getPath not implemented for filepath.Separator %q", filepath.Separator)
 	}
@@ -202,7 +791,11 @@ func (engine *Engine) getPath(digest digest.Digest) (path string, err error) {
 		return "", err
 	}
 
-	if uri.Scheme != "file" || uri.Opaque != "" || uri.User != nil || uri.Host != "" || uri.RawQuery != "" || uri.Fragment != "" {
+	if uri.Scheme != "file" {
+		return "", fmt.Errorf("%w, but %s resolved to %q", ErrUnsupportedScheme, digest, uri)
+	}
+
+	if uri.Opaque != "" || uri.User != nil || uri.Host != "" || uri.RawQuery != "" || uri.Fragment != "" {
 		return "", fmt.Errorf("invalid URI: %q", uri)
 	}
 
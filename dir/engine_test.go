@@ -15,12 +15,15 @@
 package dir
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
@@ -53,6 +56,7 @@ func TestEngineGood(t *testing.T) {
 
 	runPut(ctx, t, engine, temp)
 	runGet(ctx, t, engine)
+	runStat(ctx, t, engine.(casengine.Stater))
 	runAlgorithms(ctx, t, engine)
 	runDelete(ctx, t, engine)
 }
@@ -135,6 +139,20 @@ func runGet(ctx context.Context, t *testing.T, engine casengine.Reader) {
 	})
 }
 
+func runStat(ctx context.Context, t *testing.T, engine casengine.Stater) {
+	t.Run("stat", func(t *testing.T) {
+		size, err := engine.Stat(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, int64(13), size)
+
+		_, err = engine.Stat(ctx, "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
 func runAlgorithms(ctx context.Context, t *testing.T, engine casengine.AlgorithmLister) {
 	t.Run("algorithms", func(t *testing.T) {
 		for _, testcase := range []struct {
@@ -220,3 +238,350 @@ func runDelete(ctx context.Context, t *testing.T, engine casengine.Engine) {
 		}
 	})
 }
+
+func TestPresentAlgorithms(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	listPresent := func() (algorithms []string) {
+		algorithms = []string{}
+		err := engine.(*Engine).PresentAlgorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+			algorithms = append(algorithms, algorithm.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return algorithms
+	}
+
+	assert.Equal(t, []string{}, listPresent())
+
+	_, err = engine.Put(ctx, digest.SHA256, strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"sha256"}, listPresent())
+}
+
+func TestAlgorithmOrder(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	engine.(*Engine).AlgorithmOrder = []digest.Algorithm{digest.SHA512, digest.SHA256, digest.SHA384}
+
+	for _, testcase := range []struct {
+		prefix   string
+		size     int
+		from     int
+		expected []string
+	}{
+		{
+			prefix:   "",
+			size:     -1,
+			from:     0,
+			expected: []string{"sha512", "sha256", "sha384"},
+		},
+		{
+			prefix:   "",
+			size:     1,
+			from:     0,
+			expected: []string{"sha512"},
+		},
+		{
+			prefix:   "",
+			size:     2,
+			from:     1,
+			expected: []string{"sha256", "sha384"},
+		},
+		{
+			prefix:   "sha",
+			size:     -1,
+			from:     2,
+			expected: []string{"sha384"},
+		},
+		{
+			prefix:   "sha3",
+			size:     -1,
+			from:     0,
+			expected: []string{"sha384"},
+		},
+	} {
+		name := fmt.Sprintf("%q,%d,%d", testcase.prefix, testcase.size, testcase.from)
+		t.Run(name, func(t *testing.T) {
+			algorithms := []string{}
+			err := engine.Algorithms(
+				ctx,
+				testcase.prefix,
+				testcase.size,
+				testcase.from,
+				func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+					algorithms = append(algorithms, algorithm.String())
+					return nil
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, testcase.expected, algorithms)
+		})
+	}
+}
+
+func TestPutInfo(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, testcase := range []struct {
+		name    string
+		created bool
+	}{
+		{
+			name:    "first put",
+			created: true,
+		},
+		{
+			name:    "second put",
+			created: false,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			result, err := engine.(*Engine).PutInfo(ctx, "", strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result.Duration = 0 // see TestPutDuration
+			assert.Equal(
+				t,
+				&PutResult{
+					Digest:  "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+					Size:    13,
+					Created: testcase.created,
+				},
+				result,
+			)
+		})
+	}
+}
+
+func TestCloseWaitsForPut(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, writer := io.Pipe()
+	putErr := make(chan error, 1)
+	go func() {
+		_, err := engine.Put(ctx, "", reader)
+		putErr <- err
+	}()
+
+	// Put is in flight once it has read the first chunk.
+	_, err = writer.Write([]byte("Hello, "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeErr := make(chan error, 1)
+	go func() {
+		closeErr <- engine.Close(ctx)
+	}()
+
+	select {
+	case err = <-closeErr:
+		t.Fatalf("Close returned %v before the in-flight Put finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = writer.Write([]byte("World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	err = <-putErr
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-closeErr
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(temp, "blobs", "sha256", "df", "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected an error matching %s, got %v", ErrClosed, err)
+	}
+}
+
+func TestDeleteIfSize(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.(*Engine).DeleteIfSize(ctx, dig, 12)
+	if !errors.Is(err, ErrSizeConflict) {
+		t.Fatalf("expected an error matching %s, got %v", ErrSizeConflict, err)
+	}
+
+	size, err := engine.(*Engine).Stat(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(13), size)
+
+	err = engine.(*Engine).DeleteIfSize(ctx, dig, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.(*Engine).DeleteIfSize(ctx, dig, 13)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+	}
+}
+
+// slowReader sleeps for delay before each Read.
+type slowReader struct {
+	reader io.Reader
+	delay  time.Duration
+}
+
+func (reader *slowReader) Read(p []byte) (n int, err error) {
+	time.Sleep(reader.delay)
+	if len(p) > 5 {
+		p = p[:5]
+	}
+	return reader.reader.Read(p)
+}
+
+func TestPutDuration(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	delay := 10 * time.Millisecond
+	for _, smallBlobSize := range []int64{0, 1024} {
+		t.Run(fmt.Sprintf("small blob size %d", smallBlobSize), func(t *testing.T) {
+			engine.(*Engine).SmallBlobSize = smallBlobSize
+			content := fmt.Sprintf("Hello, World! %d", smallBlobSize)
+
+			// At least four delayed reads: three five-byte chunks and EOF.
+			minimum := 4 * delay
+
+			result, err := engine.(*Engine).PutInfo(ctx, "", &slowReader{
+				reader: strings.NewReader(content),
+				delay:  delay,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Duration < minimum {
+				t.Fatalf("reported duration %s is shorter than %s", result.Duration, minimum)
+			}
+			assert.True(t, result.Rate() > 0)
+			assert.True(t, result.Rate() <= float64(len(content))/minimum.Seconds())
+		})
+	}
+}
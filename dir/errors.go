@@ -0,0 +1,78 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrNameTooLong is returned when a blob path has a component which
+// is too long for the underlying filesystem (ENAMETOOLONG).  Many
+// filesystems limit components to 255 bytes.
+var ErrNameTooLong = errors.New("blob path component too long for the filesystem")
+
+// ErrUnsupportedScheme is returned when a blob's URI Template
+// resolves to a URI which is not a local file: path, e.g. because an
+// https:// template was configured for a dir engine.
+var ErrUnsupportedScheme = errors.New("dir engine requires a file: or relative URI Template")
+
+// ErrSizeConflict is returned by DeleteIfSize when the stored blob
+// does not have the expected size.
+var ErrSizeConflict = errors.New("blob size conflict")
+
+// ErrNonCanonicalDigest is returned for digests which are not in
+// canonical form when StrictDigests is set.
+var ErrNonCanonicalDigest = errors.New("non-canonical digest")
+
+// ErrCaseCollision is returned for digests whose paths could collide
+// with the paths of other digests when CaseInsensitive is set.
+var ErrCaseCollision = errors.New("digest path could collide on a case-insensitive filesystem")
+
+// ErrAmbiguousDigest is returned by ResolvePrefix when a truncated
+// digest matches more than one stored blob.
+var ErrAmbiguousDigest = errors.New("ambiguous digest prefix")
+
+// ErrClosed is returned by operations started after Close.
+var ErrClosed = errors.New("engine is closed")
+
+// nameTooLongError wraps an ENAMETOOLONG error with ErrNameTooLong
+// and advice for avoiding it.  Both errors.Is(err, ErrNameTooLong) and
+// errors.Is(err, syscall.ENAMETOOLONG) match it.
+type nameTooLongError struct {
+	err error
+}
+
+// Error implements error.Error.
+func (err *nameTooLongError) Error() string {
+	return fmt.Sprintf("%s (%s); use a URI Template which splits the digest into shorter path components, e.g. blobs/{algorithm}/{encoded:2}/{encoded}, and avoid long literal segments", ErrNameTooLong, err.err)
+}
+
+// Unwrap returns both ErrNameTooLong and the underlying error.
+func (err *nameTooLongError) Unwrap() []error {
+	return []error{ErrNameTooLong, err.err}
+}
+
+// pathError translates low-level filesystem errors from reading,
+// writing, and removing blob paths into more actionable errors which
+// still wrap the original error.  Errors which it does not recognize
+// are returned unchanged.
+func pathError(err error) error {
+	if errors.Is(err, syscall.ENAMETOOLONG) {
+		return &nameTooLongError{err: err}
+	}
+	return err
+}
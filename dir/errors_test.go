@@ -0,0 +1,141 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPathError(t *testing.T) {
+	t.Run("name too long", func(t *testing.T) {
+		err := pathError(&os.PathError{
+			Op:   "rename",
+			Path: "/some/long/path",
+			Err:  syscall.ENAMETOOLONG,
+		})
+		if !errors.Is(err, ErrNameTooLong) {
+			t.Fatalf("expected %s, got %v", ErrNameTooLong, err)
+		}
+		assert.True(t, errors.Is(err, syscall.ENAMETOOLONG))
+		assert.Regexp(t, `^blob path component too long for the filesystem \(rename /some/long/path: file name too long\); use a URI Template which splits the digest`, err.Error())
+	})
+
+	t.Run("other errors unchanged", func(t *testing.T) {
+		err := pathError(os.ErrPermission)
+		assert.Equal(t, os.ErrPermission, err)
+	})
+}
+
+func TestPutNameTooLong(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}{encoded}{encoded}{encoded}{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err == nil {
+		t.Skip("filesystem accepts 320-byte path components")
+	}
+	if !errors.Is(err, ErrNameTooLong) {
+		t.Fatalf("expected %s, got %v", ErrNameTooLong, err)
+	}
+	assert.True(t, errors.Is(err, syscall.ENAMETOOLONG))
+
+	// with the parent directory missing, lookups fail with ENOENT first
+	err = os.MkdirAll(filepath.Join(temp, "blobs", "sha256"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := digest.FromString("Hello, World!")
+	for _, testcase := range []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "Get",
+			call: func() error {
+				_, err := engine.Get(ctx, hello)
+				return err
+			},
+		},
+		{
+			name: "Stat",
+			call: func() error {
+				_, err := engine.(*Engine).Stat(ctx, hello)
+				return err
+			},
+		},
+		{
+			name: "GetReadSeeker",
+			call: func() error {
+				_, err := engine.(*Engine).GetReadSeeker(ctx, hello)
+				return err
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := testcase.call()
+			assert.True(t, errors.Is(err, ErrNameTooLong), "%v", err)
+			assert.True(t, errors.Is(err, syscall.ENAMETOOLONG), "%v", err)
+		})
+	}
+}
+
+func TestPutUnsupportedScheme(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(ctx, temp, "https://example.com/blobs/{algorithm}/{encoded}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("expected %s, got %v", ErrUnsupportedScheme, err)
+	}
+	assert.Equal(t, `dir engine requires a file: or relative URI Template, but sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f resolved to "https://example.com/blobs/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"`, err.Error())
+}
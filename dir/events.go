@@ -0,0 +1,71 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Op identifies the operation which produced an Event.
+type Op string
+
+const (
+	// OpPut is sent after a blob is stored.  Puts of content which
+	// was already stored also send it.
+	OpPut Op = "put"
+
+	// OpDelete is sent after a stored blob is removed.  Deletes of
+	// blobs which were not stored do not send it.
+	OpDelete Op = "delete"
+)
+
+// Event describes a successful Put or Delete.  See Engine.Events.
+type Event struct {
+	// Op is the operation.
+	Op Op
+
+	// Digest is the digest of the affected blob.
+	Digest digest.Digest
+
+	// Size is the size of the affected blob in bytes.
+	Size int64
+
+	// Time is when the operation completed.
+	Time time.Time
+}
+
+// emit sends an Event to Events, if it is set, dropping the event if
+// the channel is not ready.
+func (engine *Engine) emit(op Op, digest digest.Digest, size int64) {
+	if engine.Events == nil {
+		return
+	}
+
+	event := Event{
+		Op:     op,
+		Digest: digest,
+		Size:   size,
+		Time:   time.Now(),
+	}
+
+	select {
+	case engine.Events <- event:
+	default:
+		logrus.Warnf("dropped %s event for %s: events channel is full", op, digest)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	path, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	engine, err := NewEngine(ctx, path, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	t.Run("received", func(t *testing.T) {
+		events := make(chan Event, 10)
+		engine.(*Engine).Events = events
+		before := time.Now()
+
+		hello, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = engine.(*Engine).DeleteIfSize(ctx, hello, 13)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// deleting a missing blob does not send an event
+		err = engine.Delete(ctx, hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		close(events)
+		var received []Event
+		for event := range events {
+			assert.False(t, event.Time.Before(before))
+			event.Time = time.Time{}
+			received = append(received, event)
+		}
+
+		assert.Equal(t, []Event{
+			{Op: OpPut, Digest: hello, Size: 13},
+			{Op: OpPut, Digest: hello, Size: 13},
+			{Op: OpDelete, Digest: hello, Size: 13},
+		}, received)
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		events := make(chan Event)
+		engine.(*Engine).Events = events
+
+		hello, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = engine.Delete(ctx, hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected event %v", event)
+		default:
+		}
+	})
+}
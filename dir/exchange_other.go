@@ -0,0 +1,28 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package dir
+
+import (
+	"fmt"
+)
+
+// Exchange implements Exchanger.Exchange.  This platform has no
+// atomic exchange, so it always returns an error wrapping
+// ErrExchangeUnsupported.
+func (OSFileSystem) Exchange(oldpath string, newpath string) (err error) {
+	return fmt.Errorf("%w: exchanging %s and %s", ErrExchangeUnsupported, oldpath, newpath)
+}
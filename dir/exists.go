@@ -0,0 +1,53 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// existsBatchWorkers is the number of concurrent stats made by
+// ExistsBatch.
+const existsBatchWorkers = 16
+
+// Exists returns true if the blob for digest is in the store.
+func (engine *Engine) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	_, err = engine.Stat(ctx, digest)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExistsBatch is like Exists, but it checks many digests with up to
+// existsBatchWorkers concurrent stats.  This is useful for validating
+// all the blobs referenced by a manifest.  See casengine.ExistsAll.
+func (engine *Engine) ExistsBatch(ctx context.Context, digests []digest.Digest) (exists map[digest.Digest]bool, err error) {
+	return casengine.ExistsAll(ctx, engine, digests, existsBatchWorkers)
+}
+
+// ExistsBatch is like Exists, but it checks many digests.  Index
+// lookups are cheap, so they are not parallelized.
+func (engine *IndexedEngine) ExistsBatch(ctx context.Context, digests []digest.Digest) (exists map[digest.Digest]bool, err error) {
+	return casengine.ExistsAll(ctx, engine, digests, 1)
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestExistsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	path, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	engine, err := NewEngine(ctx, path, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	expected := map[digest.Digest]bool{}
+	for i := 0; i < 50; i++ {
+		dig, err := engine.Put(ctx, "", strings.NewReader(fmt.Sprintf("blob %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[dig] = true
+		expected[digest.FromString(fmt.Sprintf("missing %d", i))] = false
+	}
+
+	var digests []digest.Digest
+	for dig := range expected {
+		digests = append(digests, dig)
+	}
+
+	exists, err := engine.(*Engine).ExistsBatch(ctx, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, exists)
+}
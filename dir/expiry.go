@@ -0,0 +1,167 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// expirySuffix is appended to a blob's path to locate its expiry
+// sidecar.  See TTL.
+const expirySuffix = ".expires"
+
+// clock returns the current time.
+func (engine *Engine) clock() (now time.Time) {
+	if engine.now != nil {
+		return engine.now()
+	}
+	return time.Now()
+}
+
+// putExpiry stores the expiry sidecar for the blob at path, if TTL
+// is set.
+func (engine *Engine) putExpiry(path string) (err error) {
+	if engine.TTL <= 0 {
+		return nil
+	}
+
+	file, err := engine.FileSystem.TempFile(engine.temp, "expires-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err2 := engine.FileSystem.Remove(file.Name())
+			if err2 != nil {
+				logrus.Error(err2)
+			}
+		}
+	}()
+
+	expires := engine.clock().Add(engine.TTL).UTC()
+	_, err = fmt.Fprintln(file, expires.Format(time.RFC3339Nano))
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return engine.FileSystem.Rename(file.Name(), path+expirySuffix)
+}
+
+// expired returns true if the blob at path has an expiry sidecar
+// which has passed.
+func (engine *Engine) expired(path string) (expired bool, err error) {
+	sidecar, err := engine.FileSystem.OpenFile(path+expirySuffix, os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	data, err := ioutil.ReadAll(sidecar)
+	sidecar.Close()
+	if err != nil {
+		return false, err
+	}
+
+	expires, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return false, fmt.Errorf("invalid expiry sidecar for %s: %s", path, err)
+	}
+
+	return !engine.clock().Before(expires), nil
+}
+
+// checkExpiry returns an error wrapping os.ErrNotExist, after
+// removing the blob, if TTL is set and the blob for digest has
+// expired.
+func (engine *Engine) checkExpiry(digest digest.Digest) (err error) {
+	if engine.TTL <= 0 {
+		return nil
+	}
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return err
+	}
+
+	expired, err := engine.expired(path)
+	if err != nil || !expired {
+		return err
+	}
+
+	logrus.Debugf("removing expired %s", digest)
+	err = engine.remove(path)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%s expired: %w", digest, os.ErrNotExist)
+}
+
+// ExpireNow removes every blob whose TTL expiry has passed, returning
+// the number removed.  Get and Stat remove expired blobs lazily, so
+// this is only needed to reclaim space eagerly, e.g. from a periodic
+// job.  Like Usage, it walks the store and checks ctx for
+// cancellation throughout.
+func (engine *Engine) ExpireNow(ctx context.Context) (removed int, err error) {
+	err = engine.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer engine.operations.Done()
+
+	glob, err := engine.digestGlob("")
+	if err != nil {
+		return 0, err
+	}
+
+	err = walkGlob(ctx, engine.FileSystem, glob, func(match string) (err error) {
+		if !strings.HasSuffix(match, expirySuffix) {
+			return nil
+		}
+
+		path := strings.TrimSuffix(match, expirySuffix)
+		expired, err := engine.expired(path)
+		if err != nil || !expired {
+			return err
+		}
+
+		_, statErr := engine.FileSystem.Stat(path)
+		err = engine.remove(path)
+		if err != nil {
+			return err
+		}
+		if statErr == nil {
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
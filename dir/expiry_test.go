@@ -0,0 +1,117 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+
+	path, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	engine, err := NewEngine(ctx, path, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.(*Engine).now = func() time.Time {
+		return now
+	}
+
+	permanent, err := engine.Put(ctx, "", strings.NewReader("Permanent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.(*Engine).TTL = time.Hour
+	engine.(*Engine).SmallBlobSize = 8 // "small" takes the putSmall path
+	var digests []digest.Digest
+	for _, content := range []string{"Hello, World!", "small"} {
+		dig, err := engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	blobPath, err := engine.(*Engine).getPath(digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Minute)
+	reader, err := engine.Get(ctx, digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+
+	t.Run("lazy", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		_, err := engine.Get(ctx, digests[0])
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+
+		for _, suffix := range []string{"", expirySuffix} {
+			_, err = os.Stat(blobPath + suffix)
+			assert.True(t, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		removed, err := engine.(*Engine).ExpireNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, removed)
+
+		_, err = engine.(*Engine).Stat(ctx, digests[1])
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+
+		count, _, err := engine.(*Engine).Usage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, int64(1), count)
+
+		reader, err := engine.Get(ctx, permanent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Close()
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// File is the subset of *os.File used by Engine.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+
+	// Name returns the name of the file as presented to OpenFile or
+	// created by TempFile.
+	Name() string
+}
+
+// FileSystem abstracts the filesystem operations Engine uses to store
+// and enumerate blobs, e.g. so tests can inject failures.  Get reads
+// blobs through file URIs, so implementations must still operate on
+// the host filesystem, typically by wrapping OSFileSystem.
+type FileSystem interface {
+
+	// OpenFile behaves like os.OpenFile.
+	OpenFile(name string, flag int, perm os.FileMode) (file File, err error)
+
+	// TempFile behaves like ioutil.TempFile.
+	TempFile(dir string, pattern string) (file File, err error)
+
+	// Rename behaves like os.Rename.
+	Rename(oldpath string, newpath string) (err error)
+
+	// Link behaves like os.Link.
+	Link(oldname string, newname string) (err error)
+
+	// Mkdir behaves like os.Mkdir.
+	Mkdir(name string, perm os.FileMode) (err error)
+
+	// Remove behaves like os.Remove.
+	Remove(name string) (err error)
+
+	// RemoveAll behaves like os.RemoveAll.
+	RemoveAll(path string) (err error)
+
+	// Stat behaves like os.Stat.
+	Stat(name string) (info os.FileInfo, err error)
+
+	// ReadDir behaves like os.ReadDir.
+	ReadDir(name string) (entries []os.DirEntry, err error)
+}
+
+// ErrExchangeUnsupported is returned by Exchanger.Exchange, and by
+// Swap, where paths cannot be exchanged atomically.
+var ErrExchangeUnsupported = errors.New("atomic exchange is not supported")
+
+// Exchanger is implemented by FileSystems which can atomically
+// exchange two paths, as Swap requires.  OSFileSystem implements it on
+// Linux.
+type Exchanger interface {
+
+	// Exchange atomically exchanges oldpath and newpath, which must
+	// both exist, so that neither path is ever missing.
+	Exchange(oldpath string, newpath string) (err error)
+}
+
+// OSFileSystem implements FileSystem with the os package.  It is the
+// default FileSystem for engines created by NewEngine.
+type OSFileSystem struct{}
+
+// OpenFile implements FileSystem.OpenFile.
+func (OSFileSystem) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// TempFile implements FileSystem.TempFile.
+func (OSFileSystem) TempFile(dir string, pattern string) (file File, err error) {
+	return ioutil.TempFile(dir, pattern)
+}
+
+// Rename implements FileSystem.Rename.
+func (OSFileSystem) Rename(oldpath string, newpath string) (err error) {
+	return os.Rename(oldpath, newpath)
+}
+
+// Link implements FileSystem.Link.
+func (OSFileSystem) Link(oldname string, newname string) (err error) {
+	return os.Link(oldname, newname)
+}
+
+// Mkdir implements FileSystem.Mkdir.
+func (OSFileSystem) Mkdir(name string, perm os.FileMode) (err error) {
+	return os.Mkdir(name, perm)
+}
+
+// Remove implements FileSystem.Remove.
+func (OSFileSystem) Remove(name string) (err error) {
+	return os.Remove(name)
+}
+
+// RemoveAll implements FileSystem.RemoveAll.
+func (OSFileSystem) RemoveAll(path string) (err error) {
+	return os.RemoveAll(path)
+}
+
+// Stat implements FileSystem.Stat.
+func (OSFileSystem) Stat(name string) (info os.FileInfo, err error) {
+	return os.Stat(name)
+}
+
+// ReadDir implements FileSystem.ReadDir.
+func (OSFileSystem) ReadDir(name string) (entries []os.DirEntry, err error) {
+	return os.ReadDir(name)
+}
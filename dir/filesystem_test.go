@@ -0,0 +1,81 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// failingRenameFileSystem is an OSFileSystem whose renames fail with
+// ENOSPC.
+type failingRenameFileSystem struct {
+	OSFileSystem
+}
+
+func (failingRenameFileSystem) Rename(oldpath string, newpath string) (err error) {
+	return &os.LinkError{
+		Op:  "rename",
+		Old: oldpath,
+		New: newpath,
+		Err: syscall.ENOSPC,
+	}
+}
+
+func TestFileSystemRenameFailure(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).FileSystem = failingRenameFileSystem{}
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected an error matching %s, got %v", syscall.ENOSPC, err)
+	}
+
+	tempFiles, err := ioutil.ReadDir(engine.(*Engine).temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, tempFiles)
+
+	_, err = os.Stat(filepath.Join(temp, "blobs"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected the blobs directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// digestGlob returns a pattern (with filepath.Match syntax) matching
+// the paths of blobs using algorithm, or of all blobs if algorithm is
+// empty.  Path components which come from literal segments of the
+// URI Template, e.g. "blobs" in blobs/{algorithm}/{encoded}, are
+// escaped so they only match themselves, even if they contain
+// characters like "[" which filepath.Match would otherwise treat as
+// wildcards.
+func (engine *Engine) digestGlob(algorithm digest.Algorithm) (glob string, err error) {
+	globAlgorithm := algorithm.String()
+	if globAlgorithm == "" {
+		globAlgorithm = "*"
+	}
+	glob, err = engine.globPath(digest.Digest(fmt.Sprintf("%s:*", globAlgorithm)))
+	if err != nil {
+		return "", err
+	}
+
+	// Digests which differ in every character (and in algorithm, when
+	// algorithm is empty) have paths which only share the components
+	// which do not depend on the digest.
+	samples := []digest.Digest{
+		digest.NewDigestFromEncoded(digest.SHA256, strings.Repeat("0", 2*digest.SHA256.Size())),
+		digest.NewDigestFromEncoded(digest.SHA512, strings.Repeat("f", 2*digest.SHA512.Size())),
+	}
+	if algorithm != "" {
+		if !algorithm.Available() {
+			return glob, nil
+		}
+		samples[0] = digest.NewDigestFromEncoded(algorithm, strings.Repeat("0", 2*algorithm.Size()))
+		samples[1] = digest.NewDigestFromEncoded(algorithm, strings.Repeat("f", 2*algorithm.Size()))
+	}
+
+	components := splitPath(glob)
+	var paths [2][]string
+	for i, sample := range samples {
+		path, err := engine.globPath(sample)
+		if err != nil {
+			return "", err
+		}
+		paths[i] = splitPath(path)
+		if len(paths[i]) != len(components) {
+			// The template's structure depends on the digest, so fall
+			// back to the unescaped pattern.
+			return glob, nil
+		}
+	}
+
+	for i := range components {
+		if paths[0][i] == paths[1][i] {
+			components[i] = escapeMeta(paths[0][i])
+		}
+	}
+
+	root := ""
+	if filepath.IsAbs(glob) {
+		root = string(filepath.Separator)
+	}
+	return root + strings.Join(components, string(filepath.Separator)), nil
+}
+
+// escapeMeta escapes the magic characters recognized by
+// filepath.Match in component.
+func escapeMeta(component string) (escaped string) {
+	if !hasMeta(component) {
+		return component
+	}
+
+	var builder strings.Builder
+	for _, character := range component {
+		if strings.ContainsRune(`*?[\`, character) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(character)
+	}
+	return builder.String()
+}
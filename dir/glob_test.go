@@ -0,0 +1,135 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDigestGlob(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	for _, testcase := range []struct {
+		template  string
+		algorithm digest.Algorithm
+		expected  string
+	}{
+		{
+			template: "blobs/{algorithm}/{encoded}",
+			expected: "blobs/*/*",
+		},
+		{
+			template:  "blobs/{algorithm}/{encoded}",
+			algorithm: digest.SHA256,
+			expected:  "blobs/sha256/*",
+		},
+		{
+			template:  "blobs/{algorithm}/{encoded:2}/{encoded}",
+			algorithm: digest.SHA256,
+			expected:  "blobs/sha256/*/*",
+		},
+		{
+			template: "store[1]/{algorithm}/data/{encoded}",
+			expected: `store\[1]/*/data/*`,
+		},
+	} {
+		t.Run(fmt.Sprintf("%s %q", testcase.template, testcase.algorithm), func(t *testing.T) {
+			engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/%s", temp, testcase.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			glob, err := engine.(*Engine).digestGlob(testcase.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, filepath.Join(temp, testcase.expected), glob)
+		})
+	}
+}
+
+func TestDigestsConstantDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	getDigestRegexp := regexp.MustCompile(`(?P<algorithm>[a-z0-9]+)/data/(?P<encoded>[a-f0-9]+)$`)
+	engine, err := NewDigestListerEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/store[1]/{algorithm}/data/{encoded}", temp),
+		(&RegexpGetDigest{
+			Regexp: getDigestRegexp,
+		}).GetDigest,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	hello, err := engine.Put(ctx, digest.SHA256, strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A sibling of the constant directory, which "store[1]" would
+	// match as a glob, and a sibling file in the constant directory.
+	goodbye := digest.FromString("Goodbye, World!")
+	for _, path := range []string{
+		filepath.Join(temp, "store1", "sha256", "data", goodbye.Encoded()),
+		filepath.Join(temp, "store[1]", "sha256", "data", "README"),
+		filepath.Join(temp, "store[1]", "sha256", "README"),
+	} {
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte("Goodbye, World!"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var digests []digest.Digest
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []digest.Digest{hello}, digests)
+}
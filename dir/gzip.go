@@ -0,0 +1,122 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// gzipSuffix is appended to a blob's path to locate its cached
+// gzip-compressed rendition.
+const gzipSuffix = ".gz"
+
+// GetGzip returns a gzip-compressed rendition of a stored blob, e.g.
+// for serving HTTP requests with 'Accept-Encoding: gzip'.  If
+// GzipCache is set, the rendition is stored alongside the blob on
+// first use and reused by later calls.  Otherwise the blob is
+// compressed on the fly.
+func (engine *Engine) GetGzip(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if engine.GzipCache {
+		file, err := engine.FileSystem.OpenFile(path+gzipSuffix, os.O_RDONLY, 0)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		err = engine.putGzip(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return engine.FileSystem.OpenFile(path+gzipSuffix, os.O_RDONLY, 0)
+	}
+
+	file, err := engine.FileSystem.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		defer file.Close()
+		writer := gzip.NewWriter(pipeWriter)
+		_, err := io.Copy(writer, file)
+		if err == nil {
+			err = writer.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader, nil
+}
+
+// putGzip stores the gzip-compressed rendition of the blob at path.
+func (engine *Engine) putGzip(path string) (err error) {
+	blob, err := engine.FileSystem.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	file, err := engine.FileSystem.TempFile(engine.temp, "gzip-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err2 := engine.FileSystem.Remove(file.Name())
+			if err2 != nil {
+				logrus.Error(err2)
+			}
+		}
+	}()
+
+	writer := gzip.NewWriter(file)
+	_, err = io.Copy(writer, blob)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return engine.FileSystem.Rename(file.Name(), path+gzipSuffix)
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestGetGzip(t *testing.T) {
+	ctx := context.Background()
+
+	for _, testcase := range []struct {
+		name    string
+		cache   bool
+		sidecar bool
+	}{
+		{
+			name:    "cached",
+			cache:   true,
+			sidecar: true,
+		},
+		{
+			name:    "on the fly",
+			cache:   false,
+			sidecar: false,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			temp, err := ioutil.TempDir("", "casengine-dir-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(temp)
+
+			engine, err := NewEngine(
+				ctx,
+				temp,
+				fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).GzipCache = testcase.cache
+
+			dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sidecar := filepath.Join(temp, "blobs", "sha256", "df", dig.Encoded()+gzipSuffix)
+
+			var infos []os.FileInfo
+			for i := 0; i < 2; i++ {
+				assert.Equal(t, "Hello, World!", getGzip(ctx, t, engine.(*Engine), dig))
+
+				info, err := os.Stat(sidecar)
+				if testcase.sidecar {
+					if err != nil {
+						t.Fatal(err)
+					}
+					infos = append(infos, info)
+				} else if !os.IsNotExist(err) {
+					t.Fatalf("expected no gzip sidecar, got %v", err)
+				}
+			}
+
+			if testcase.sidecar {
+				assert.True(t, os.SameFile(infos[0], infos[1]), "gzip sidecar was recreated")
+			}
+
+			err = engine.Delete(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(sidecar)
+			if !os.IsNotExist(err) {
+				t.Fatalf("expected Delete to remove the gzip sidecar, got %v", err)
+			}
+		})
+	}
+}
+
+func getGzip(ctx context.Context, t *testing.T, engine *Engine, digest digest.Digest) (content string) {
+	reader, err := engine.GetGzip(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
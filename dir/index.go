@@ -0,0 +1,440 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// indexCompactMinimum is the smallest number of index records which
+// may trigger compaction.
+const indexCompactMinimum = 1024
+
+// storeObserver is notified of blob changes made by Engine methods,
+// e.g. so IndexedEngine can keep its index current.
+type storeObserver interface {
+
+	// blobAdded is called after a blob is stored at path.
+	blobAdded(path string)
+
+	// blobRemoved is called after the blob at path is removed.
+	blobRemoved(path string)
+
+	// storeReplaced is called after the whole store is replaced, e.g.
+	// by Swap.
+	storeReplaced()
+}
+
+// added notifies the observer, if any, that a blob was stored at
+// path.
+func (engine *Engine) added(path string) {
+	if engine.observer != nil {
+		engine.observer.blobAdded(path)
+	}
+}
+
+// removed notifies the observer, if any, that the blob at path was
+// removed.
+func (engine *Engine) removed(path string) {
+	if engine.observer != nil {
+		engine.observer.blobRemoved(path)
+	}
+}
+
+// replaced notifies the observer, if any, that the whole store was
+// replaced.
+func (engine *Engine) replaced() {
+	if engine.observer != nil {
+		engine.observer.storeReplaced()
+	}
+}
+
+// IndexedEngine is a CAS engine which maintains an on-disk index of
+// the digests it stores, so Exists does not need to touch the blob
+// tree.  The index file is an append-only log with one "put <digest>"
+// or "delete <digest>" record per line, so each change costs a single
+// append.  Once the log holds more than twice as many records as
+// there are indexed digests, it is compacted by rewriting it with one
+// put record per digest.
+//
+// Every Engine method which adds or removes blobs (including Put,
+// CopyFrom, Promote, Merge, Delete, DeleteAlgorithm, TTL expiry, and
+// Relayout) updates the index.  Swap marks the index stale, so it is
+// rebuilt by the next Exists.  Changes made to the blob tree without
+// going through the engine leave the index stale; call Reindex to
+// rebuild it.
+type IndexedEngine struct {
+	*DigestListerEngine
+
+	// path is the index file.
+	path string
+
+	// mutex guards digests, pending, log, records, and stale.
+	mutex sync.Mutex
+
+	// digests holds the indexed digests.
+	digests map[digest.Digest]struct{}
+
+	// pending, if not nil, records changes made while Reindex walks
+	// the blob tree, so they can be applied to the rebuilt index.
+	pending map[digest.Digest]bool
+
+	// log is the index file, opened for appending.
+	log File
+
+	// records is the number of records in the index file.
+	records int
+
+	// stale is set when the index may not match the blob tree, so the
+	// next Exists rebuilds it.
+	stale bool
+}
+
+// NewIndexed creates a new IndexedEngine wrapping engine, with its
+// index stored at path.  If the index is missing or cannot be parsed,
+// it is rebuilt with Reindex.  The IndexedEngine observes engine's
+// changes, so engine should only be wrapped by one IndexedEngine.
+func NewIndexed(ctx context.Context, engine *DigestListerEngine, path string) (indexed *IndexedEngine, err error) {
+	indexed = &IndexedEngine{
+		DigestListerEngine: engine,
+		path:               path,
+	}
+	engine.Engine.observer = indexed
+
+	err = indexed.load()
+	if err == nil {
+		indexed.mutex.Lock()
+		err = indexed.openLog()
+		if err == nil && indexed.needsCompaction() {
+			err = indexed.compact()
+		}
+		indexed.mutex.Unlock()
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("rebuilding the %s index: %s", path, err)
+		}
+		err = indexed.Reindex(ctx)
+		if err != nil {
+			engine.Engine.observer = nil
+			return nil, err
+		}
+	}
+
+	return indexed, nil
+}
+
+// Exists returns true if digest is in the index.  With TTL set,
+// indexed blobs are also checked for expiry.
+func (engine *IndexedEngine) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	digest, err = engine.canonicalDigest(digest)
+	if err != nil {
+		return false, err
+	}
+
+	engine.mutex.Lock()
+	stale := engine.stale
+	engine.mutex.Unlock()
+	if stale {
+		err = engine.Reindex(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	engine.mutex.Lock()
+	_, exists = engine.digests[digest]
+	engine.mutex.Unlock()
+
+	if exists && engine.TTL > 0 {
+		err = engine.checkExpiry(digest)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return exists, nil
+}
+
+// Reindex rebuilds the index from the blob tree.  Changes made by
+// concurrent operations while the tree is walked are applied to the
+// rebuilt index.
+func (engine *IndexedEngine) Reindex(ctx context.Context) (err error) {
+	engine.mutex.Lock()
+	engine.pending = map[digest.Digest]bool{}
+	engine.mutex.Unlock()
+
+	digests := map[digest.Digest]struct{}{}
+	err = engine.DigestListerEngine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests[digest] = struct{}{}
+		return nil
+	})
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	pending := engine.pending
+	engine.pending = nil
+	if err != nil {
+		return err
+	}
+
+	for dig, present := range pending {
+		if present {
+			digests[dig] = struct{}{}
+		} else {
+			delete(digests, dig)
+		}
+	}
+
+	engine.digests = digests
+	err = engine.compact()
+	if err != nil {
+		return err
+	}
+
+	engine.stale = false
+	return nil
+}
+
+// Close implements Closer.Close, also closing the index file.
+func (engine *IndexedEngine) Close(ctx context.Context) (err error) {
+	err = engine.DigestListerEngine.Close(ctx)
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.log != nil {
+		err2 := engine.log.Close()
+		engine.log = nil
+		if err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+// blobAdded implements storeObserver.blobAdded.
+func (engine *IndexedEngine) blobAdded(path string) {
+	engine.update(path, true)
+}
+
+// blobRemoved implements storeObserver.blobRemoved.
+func (engine *IndexedEngine) blobRemoved(path string) {
+	engine.update(path, false)
+}
+
+// storeReplaced implements storeObserver.storeReplaced.
+func (engine *IndexedEngine) storeReplaced() {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	engine.stale = true
+}
+
+// update records the addition or removal of the blob at path.  Paths
+// which are not where the engine stores their digest, like the old
+// paths moved by Relayout, are ignored.  If the record cannot be
+// written, the index is marked stale.
+func (engine *IndexedEngine) update(path string, present bool) {
+	dig, err := engine.DigestForPath(path)
+	if err != nil {
+		return
+	}
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.digests == nil {
+		// still loading, so rebuild once loaded
+		engine.stale = true
+		return
+	}
+
+	if engine.pending != nil {
+		engine.pending[dig] = present
+	}
+
+	_, indexed := engine.digests[dig]
+	if indexed == present {
+		return
+	}
+
+	op := "delete"
+	if present {
+		op = "put"
+		engine.digests[dig] = struct{}{}
+	} else {
+		delete(engine.digests, dig)
+	}
+
+	err = engine.append(op, dig)
+	if err == nil && engine.needsCompaction() {
+		err = engine.compact()
+	}
+	if err != nil {
+		logrus.Warnf("marking the %s index stale: %s", engine.path, err)
+		engine.stale = true
+	}
+}
+
+// append writes a record to the index file.  The caller must hold
+// mutex.
+func (engine *IndexedEngine) append(op string, dig digest.Digest) (err error) {
+	if engine.log == nil {
+		return fmt.Errorf("the %s index is not open", engine.path)
+	}
+
+	_, err = fmt.Fprintf(engine.log, "%s %s\n", op, dig)
+	if err != nil {
+		return err
+	}
+
+	engine.records++
+	return nil
+}
+
+// needsCompaction returns true if the index file has grown enough
+// that it should be compacted.  The caller must hold mutex.
+func (engine *IndexedEngine) needsCompaction() bool {
+	return engine.records > indexCompactMinimum && engine.records > 2*len(engine.digests)
+}
+
+// openLog opens the index file for appending.  The caller must hold
+// mutex.
+func (engine *IndexedEngine) openLog() (err error) {
+	if engine.log != nil {
+		err = engine.log.Close()
+		engine.log = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	engine.log, err = engine.FileSystem.OpenFile(engine.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	return err
+}
+
+// load reads the index file.  Lines with a bare digest, as written
+// by earlier versions, are put records.  The caller must not hold
+// mutex.
+func (engine *IndexedEngine) load() (err error) {
+	file, err := engine.FileSystem.OpenFile(engine.path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	digests := map[digest.Digest]struct{}{}
+	records := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		op := "put"
+		if len(fields) == 2 {
+			op = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) != 1 {
+			return fmt.Errorf("invalid index entry %q", scanner.Text())
+		}
+
+		dig, err := digest.Parse(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid index entry %q: %w", scanner.Text(), err)
+		}
+
+		switch op {
+		case "put":
+			digests[dig] = struct{}{}
+		case "delete":
+			delete(digests, dig)
+		default:
+			return fmt.Errorf("invalid index entry %q", scanner.Text())
+		}
+		records++
+	}
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	engine.digests = digests
+	engine.records = records
+	return nil
+}
+
+// compact atomically replaces the index file with one put record per
+// indexed digest and reopens it for appending.  The caller must hold
+// mutex.
+func (engine *IndexedEngine) compact() (err error) {
+	digests := make([]string, 0, len(engine.digests))
+	for dig := range engine.digests {
+		digests = append(digests, string(dig))
+	}
+	sort.Strings(digests)
+
+	file, err := engine.FileSystem.TempFile(filepath.Dir(engine.path), ".index-")
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, dig := range digests {
+		_, err = fmt.Fprintf(writer, "put %s\n", dig)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		file.Close()
+	} else {
+		err = file.Close()
+	}
+	if err == nil {
+		err = engine.FileSystem.Rename(file.Name(), engine.path)
+	}
+	if err != nil {
+		err2 := engine.FileSystem.Remove(file.Name())
+		if err2 != nil {
+			logrus.Error(err2)
+		}
+		return err
+	}
+
+	engine.records = len(digests)
+	return engine.openLog()
+}
@@ -0,0 +1,461 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func TestIndexedEngine(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	getDigestRegexp, err := TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := NewDigestListerEngine(ctx, temp, "file://"+template, (&RegexpGetDigest{Regexp: getDigestRegexp}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close(ctx)
+
+	indexPath := filepath.Join(temp, "index")
+	engine, err := NewIndexed(ctx, base.(*DigestListerEngine), indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := digest.FromString("Hello, World!")
+	goodbye := digest.FromString("Goodbye, World!")
+
+	assertIndex := func(t *testing.T, expected ...digest.Digest) {
+		for _, dig := range []digest.Digest{hello, goodbye} {
+			exists, err := engine.Exists(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, contains(expected, dig), exists, string(dig))
+		}
+
+		assert.ElementsMatch(t, expected, loadIndex(t, engine))
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		assertIndex(t)
+	})
+
+	t.Run("put", func(t *testing.T) {
+		for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+			_, err := engine.Put(ctx, "", strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		assertIndex(t, hello, goodbye)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err := engine.Delete(ctx, goodbye)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIndex(t, hello)
+	})
+
+	t.Run("append only", func(t *testing.T) {
+		content, err := ioutil.ReadFile(indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, fmt.Sprintf("put %s\nput %s\ndelete %s\n", hello, goodbye, goodbye), string(content))
+	})
+
+	t.Run("reindex", func(t *testing.T) {
+		// Add a blob behind the index's back.
+		path, err := engine.getPath(goodbye)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte("Goodbye, World!"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIndex(t, hello)
+
+		err = engine.Reindex(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIndex(t, hello, goodbye)
+	})
+
+	t.Run("rebuild missing index", func(t *testing.T) {
+		err := os.Remove(indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err = NewIndexed(ctx, base.(*DigestListerEngine), indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIndex(t, hello, goodbye)
+	})
+}
+
+// loadIndex returns the digests recorded in engine's index file.
+func loadIndex(t *testing.T, engine *IndexedEngine) (digests []digest.Digest) {
+	indexed := &IndexedEngine{
+		DigestListerEngine: engine.DigestListerEngine,
+		path:               engine.path,
+	}
+	err := indexed.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digests = []digest.Digest{}
+	for dig := range indexed.digests {
+		digests = append(digests, dig)
+	}
+	return digests
+}
+
+func contains(digests []digest.Digest, dig digest.Digest) bool {
+	for _, d := range digests {
+		if d == dig {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestIndexed creates an IndexedEngine in a store directory under
+// temp, with the index in temp.
+func newTestIndexed(ctx context.Context, t *testing.T, temp string, template string) (engine *IndexedEngine) {
+	store := filepath.Join(temp, "store")
+	err := os.MkdirAll(store, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template = filepath.Join(store, template)
+	getDigestRegexp, err := TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := NewDigestListerEngine(ctx, store, "file://"+template, (&RegexpGetDigest{Regexp: getDigestRegexp}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err = NewIndexed(ctx, base.(*DigestListerEngine), filepath.Join(temp, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestIndexedEngineMutators(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestIndexed(ctx, t, temp, "blobs/{algorithm}/{encoded:2}/{encoded}")
+	defer engine.Close(ctx)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time {
+		return now
+	}
+
+	source, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "url")
+	}))
+	defer server.Close()
+
+	assertExists := func(t *testing.T, dig digest.Digest, expected bool) {
+		exists, err := engine.Exists(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, exists, string(dig))
+		assert.Equal(t, expected, contains(loadIndex(t, engine), dig), string(dig))
+	}
+
+	for _, testcase := range []struct {
+		name    string
+		content string
+		put     func(content string) (err error)
+	}{
+		{
+			name:    "PutDescriptor",
+			content: "descriptor",
+			put: func(content string) (err error) {
+				_, err = engine.PutDescriptor(ctx, "text/plain", "", strings.NewReader(content))
+				return err
+			},
+		},
+		{
+			name:    "CopyFrom",
+			content: "copy",
+			put: func(content string) (err error) {
+				dig, err := source.Put(ctx, "", strings.NewReader(content))
+				if err != nil {
+					return err
+				}
+				return engine.CopyFrom(ctx, source, dig)
+			},
+		},
+		{
+			name:    "PutURL",
+			content: "url",
+			put: func(content string) (err error) {
+				_, err = engine.PutURL(ctx, server.Client(), server.URL)
+				return err
+			},
+		},
+		{
+			name:    "Stage and Promote",
+			content: "staged",
+			put: func(content string) (err error) {
+				stagingID, dig, err := engine.Stage(ctx, "", strings.NewReader(content))
+				if err != nil {
+					return err
+				}
+				return engine.Promote(ctx, stagingID, dig)
+			},
+		},
+		{
+			name:    "Merge",
+			content: "merge",
+			put: func(content string) (err error) {
+				_, err = source.Put(ctx, "", strings.NewReader(content))
+				if err != nil {
+					return err
+				}
+				_, err = engine.Merge(ctx, source)
+				return err
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			dig := digest.FromString(testcase.content)
+			assertExists(t, dig, false)
+			err := testcase.put(testcase.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertExists(t, dig, true)
+		})
+	}
+
+	t.Run("DeleteAlgorithm", func(t *testing.T) {
+		dig := digest.FromString("descriptor")
+		_, err := engine.DeleteAlgorithm(ctx, digest.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertExists(t, dig, false)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		engine.TTL = time.Hour
+		defer func() {
+			engine.TTL = 0
+		}()
+
+		lazy, err := engine.Put(ctx, "", strings.NewReader("lazy"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		eager, err := engine.Put(ctx, "", strings.NewReader("eager"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertExists(t, lazy, true)
+		assertExists(t, eager, true)
+
+		now = now.Add(2 * time.Hour)
+		_, err = engine.Get(ctx, lazy)
+		assert.True(t, errors.Is(err, os.ErrNotExist), fmt.Sprint(err))
+		assertExists(t, lazy, false)
+
+		_, err = engine.ExpireNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, contains(loadIndex(t, engine), eager))
+	})
+
+	t.Run("Swap", func(t *testing.T) {
+		replacementPath := filepath.Join(temp, "replacement")
+		err := os.Mkdir(replacementPath, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replacement, err := NewEngine(ctx, replacementPath, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", replacementPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dig, err := replacement.Put(ctx, "", strings.NewReader("swapped"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = replacement.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		existing, err := engine.Put(ctx, "", strings.NewReader("existing"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = engine.Swap(ctx, replacementPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertExists(t, dig, true)
+		assertExists(t, existing, false)
+	})
+}
+
+func TestIndexedEngineRelayout(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestIndexed(ctx, t, temp, "objects/{algorithm}/{encoded:4}/{encoded}")
+	defer engine.Close(ctx)
+
+	store := filepath.Join(temp, "store")
+	fromTemplate := filepath.Join(store, "blobs/{algorithm}/{encoded:2}/{encoded}")
+	re, err := TemplateRegexp(fromTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := NewDigestListerEngine(ctx, store, "file://"+fromTemplate, (&RegexpGetDigest{Regexp: re}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close(ctx)
+
+	dig, err := from.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := engine.Exists(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, exists)
+
+	err = engine.Relayout(ctx, from.(*DigestListerEngine), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err = engine.Exists(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, exists)
+	assert.Equal(t, []digest.Digest{dig}, loadIndex(t, engine))
+}
+
+func TestIndexedEngineCompaction(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestIndexed(ctx, t, temp, "blobs/{algorithm}/{encoded:2}/{encoded}")
+	defer engine.Close(ctx)
+
+	hello, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < indexCompactMinimum; i++ {
+		dig, err := engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = engine.Delete(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(engine.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Count(string(content), "\n")
+	assert.True(t, lines <= indexCompactMinimum+1, fmt.Sprintf("%d index records", lines))
+	assert.Equal(t, []digest.Digest{hello}, loadIndex(t, engine))
+
+	// the compacted index is still appended to
+	goodbye, err := engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []digest.Digest{hello, goodbye}, loadIndex(t, engine))
+}
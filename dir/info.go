@@ -0,0 +1,51 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	// Digest is the blob's digest.
+	Digest digest.Digest
+
+	// Size is the blob's size in bytes.
+	Size int64
+
+	// ETag is a strong HTTP entity tag for the blob, derived from
+	// Digest (see casengine.ETag).  Blobs are immutable, so it never
+	// needs revalidating against the content.
+	ETag string
+}
+
+// GetInfo is like Stat, but it returns a BlobInfo, e.g. for serving
+// conditional HTTP requests.  Returns an error matching
+// os.ErrNotExist (see errors.Is) if the digest is not found.
+func (engine *Engine) GetInfo(ctx context.Context, digest digest.Digest) (info *BlobInfo, err error) {
+	size, err := engine.Stat(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Digest: digest,
+		Size:   size,
+		ETag:   casengine.ETag(digest),
+	}, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// PutURL fetches uri and stores the response body with Put, using
+// http.DefaultClient if client is nil.  The URI is not
+// content-addressed, so nothing is verified; PutURL returns the
+// digest computed by Put.
+func (engine *Engine) PutURL(ctx context.Context, client *http.Client, uri string) (dig digest.Digest, err error) {
+	request, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return "", err
+	}
+	request = request.WithContext(ctx)
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	logrus.Debugf("requesting %s", request.URL)
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%s not found: %w", uri, os.ErrNotExist)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requested %s but got %s", uri, response.Status)
+	}
+
+	return engine.Put(ctx, "", response.Body)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPutURL(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hello" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Hello, World!")
+	}))
+	defer server.Close()
+
+	t.Run("good", func(t *testing.T) {
+		dig, err := engine.(*Engine).PutURL(ctx, nil, server.URL+"/hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f", dig.String())
+
+		data, err := ioutil.ReadFile(filepath.Join(temp, "blobs", "sha256", "df", dig.Encoded()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Hello, World!", string(data))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := engine.(*Engine).PutURL(ctx, nil, server.URL+"/missing")
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+	})
+}
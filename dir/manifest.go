@@ -0,0 +1,89 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"os"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// manifestMediaType is the media type of descriptors from Manifest.
+// The store does not record blob media types.
+const manifestMediaType = "application/octet-stream"
+
+// DescriptorCallback templates a Manifest callback used for
+// processing blob descriptors.
+type DescriptorCallback func(ctx context.Context, descriptor ocispec.Descriptor) (err error)
+
+// Manifest calls callback with a descriptor (digest and size, with an
+// application/octet-stream media type) for each stored blob, e.g. for
+// inventory or export.  Like Digests, results are streamed in lexical
+// path order, so large stores are never held in memory.
+//
+// With verify, each blob's content is read and checked against its
+// digest first.  Blobs which fail verification are skipped, and
+// Manifest continues with the rest of the store before returning the
+// joined errors, which wrap ErrVerificationFailed.  Errors returned by
+// callback abort the walk immediately.
+func (engine *DigestListerEngine) Manifest(ctx context.Context, verify bool, callback DescriptorCallback) (err error) {
+	glob, err := engine.Engine.digestGlob("")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	err = walkGlob(ctx, engine.FileSystem, glob, func(match string) (err error) {
+		if isSidecar(match) {
+			return nil
+		}
+
+		info, err := engine.FileSystem.Stat(match)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		digest, err := engine.getDigest(match)
+		if err != nil {
+			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
+			return nil
+		}
+
+		if verify {
+			err = engine.verifyPath(digest, match)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+		}
+
+		return callback(ctx, ocispec.Descriptor{
+			MediaType: manifestMediaType,
+			Digest:    digest,
+			Size:      info.Size(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
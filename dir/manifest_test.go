@@ -0,0 +1,110 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestManifest(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(ctx)
+
+	var digests []digest.Digest
+	for _, content := range []string{"Hello, World!", "Goodbye, World!", ""} {
+		dig, err := engine.Put(ctx, digest.SHA256, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	path, err := engine.(*DigestListerEngine).getPath(digests[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte("Goodbye, Wxrld!"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := ocispec.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    digests[0],
+		Size:      13,
+	}
+	goodbye := ocispec.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    digests[1],
+		Size:      15,
+	}
+	empty := ocispec.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    digests[2],
+		Size:      0,
+	}
+
+	for _, testcase := range []struct {
+		verify   bool
+		expected []ocispec.Descriptor
+	}{
+		{
+			verify:   false,
+			expected: []ocispec.Descriptor{hello, empty, goodbye},
+		},
+		{
+			verify:   true,
+			expected: []ocispec.Descriptor{hello, empty},
+		},
+	} {
+		name := "without verification"
+		if testcase.verify {
+			name = "with verification"
+		}
+		t.Run(name, func(t *testing.T) {
+			var descriptors []ocispec.Descriptor
+			err := engine.(*DigestListerEngine).Manifest(ctx, testcase.verify, func(ctx context.Context, descriptor ocispec.Descriptor) (err error) {
+				descriptors = append(descriptors, descriptor)
+				return nil
+			})
+			if testcase.verify {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Fatalf("expected an error matching %s, got %v", ErrVerificationFailed, err)
+				}
+				assert.Contains(t, err.Error(), digests[1].String())
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, descriptors)
+		})
+	}
+}
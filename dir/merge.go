@@ -0,0 +1,141 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// MergeReport summarizes the result of a Merge.
+type MergeReport struct {
+	// Copied holds digests which were copied from the other store.
+	Copied []digest.Digest
+
+	// Identical holds digests which were present in both stores with
+	// matching content.
+	Identical []digest.Digest
+
+	// Conflicts holds digests whose content differed between the two
+	// stores, or whose content in the other store did not match the
+	// digest.  Either indicates corruption somewhere.
+	Conflicts []digest.Digest
+}
+
+// Merge copies blobs from other which are missing from this store.
+// For digests present in both stores, Merge compares the content and
+// reports any differences as conflicts without modifying either
+// store.  Content is streamed throughout.
+//
+// The other engine must also implement DigestLister, because Merge
+// needs to enumerate its blobs.
+func (engine *Engine) Merge(ctx context.Context, other casengine.Reader) (report *MergeReport, err error) {
+	lister, ok := other.(casengine.DigestLister)
+	if !ok {
+		return nil, fmt.Errorf("cannot merge from %T, which does not implement DigestLister", other)
+	}
+
+	report = &MergeReport{}
+	err = lister.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		local, err := engine.Get(ctx, digest)
+		if errors.Is(err, os.ErrNotExist) {
+			copied, err := engine.mergeCopy(ctx, other, digest)
+			if err != nil {
+				return err
+			}
+			if copied {
+				report.Copied = append(report.Copied, digest)
+			} else {
+				report.Conflicts = append(report.Conflicts, digest)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer local.Close()
+
+		remote, err := other.Get(ctx, digest)
+		if err != nil {
+			return err
+		}
+		defer remote.Close()
+
+		equal, err := equalReaders(local, remote)
+		if err != nil {
+			return err
+		}
+		if equal {
+			report.Identical = append(report.Identical, digest)
+		} else {
+			report.Conflicts = append(report.Conflicts, digest)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// mergeCopy copies digest from other into this store, returning false
+// if the content retrieved from other did not match digest.  The
+// content is verified before it is placed (see CopyFrom), so
+// mismatched content never lands in this store.
+func (engine *Engine) mergeCopy(ctx context.Context, other casengine.Reader, digest digest.Digest) (copied bool, err error) {
+	err = engine.CopyFrom(ctx, other, digest)
+	if errors.Is(err, casengine.ErrDigestMismatch) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// equalReaders streams both readers, returning true if they produce
+// identical content.
+func equalReaders(a io.Reader, b io.Reader) (equal bool, err error) {
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		nA, errA := io.ReadFull(a, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+
+		nB, errB := io.ReadFull(b, bufB)
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+
+		if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
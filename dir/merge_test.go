@@ -0,0 +1,176 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	other, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(ctx)
+
+	for _, body := range []string{"Hello, World!", ""} {
+		_, err = engine.Put(ctx, "", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, body := range []string{"Hello, World!", "", "Goodbye, World!"} {
+		_, err = other.Put(ctx, "", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(temp, "blobs", "sha256", "df", "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	err = ioutil.WriteFile(path, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := engine.(*Engine).Merge(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(
+		t,
+		&MergeReport{
+			Copied: []digest.Digest{
+				"sha256:fb62f02acda7d74177a701a1ce006e6bacd90c7d4d7ab481692c1da47c81076b",
+			},
+			Identical: []digest.Digest{
+				"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+			Conflicts: []digest.Digest{
+				"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			},
+		},
+		report,
+	)
+
+	reader, err := engine.Get(ctx, report.Copied[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	bodyOut, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Goodbye, World!", string(bodyOut))
+}
+
+func TestMergeCorrupt(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	enginePath := filepath.Join(temp, "engine")
+	otherPath := filepath.Join(temp, "other")
+	engines := []casengine.DigestListerEngine{}
+	for _, path := range []string{enginePath, otherPath} {
+		err = os.Mkdir(path, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", path)
+		getDigestRegexp, err := TemplateRegexp(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err := NewDigestListerEngine(ctx, path, "file://"+template, (&RegexpGetDigest{Regexp: getDigestRegexp}).GetDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+		engines = append(engines, engine)
+	}
+	engine, other := engines[0], engines[1]
+
+	dig, err := other.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := other.(*DigestListerEngine).getPath(dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := engine.(*DigestListerEngine).Merge(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &MergeReport{Conflicts: []digest.Digest{dig}}, report)
+
+	// neither the requested digest nor the digest of the corrupt
+	// content was stored
+	digests := []digest.Digest{}
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, digests)
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mkdirAll is like os.MkdirAll, but it also returns the directories
+// it created, from shallowest to deepest, so a failed Put can remove
+// them with removeEmpty.
+func mkdirAll(fs FileSystem, path string, perm os.FileMode) (created []string, err error) {
+	var missing []string
+	for dir := path; ; {
+		info, err := fs.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return nil, &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		missing = append(missing, dir)
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		err = fs.Mkdir(missing[i], perm)
+		if err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			removeEmpty(fs, created)
+			return nil, err
+		}
+		created = append(created, missing[i])
+	}
+
+	return created, nil
+}
+
+// retryMissingDir calls op, which creates an entry in dir.  A
+// concurrent Put which failed after creating dir may remove it with
+// removeEmpty between our mkdirAll and op, so if op fails because dir
+// is missing, retryMissingDir recreates it, appending the directories
+// it creates to created, and calls op once more.
+func retryMissingDir(fs FileSystem, dir string, created *[]string, op func() error) (err error) {
+	err = op()
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	recreated, err2 := mkdirAll(fs, dir, 0777)
+	if err2 != nil {
+		return err
+	}
+	*created = append(*created, recreated...)
+	logrus.Debugf("recreated %s after it was removed by a concurrent operation", dir)
+
+	return op()
+}
+
+// removeEmpty removes directories returned by mkdirAll, deepest
+// first, stopping at the first one which is not empty (e.g. because
+// a concurrent Put stored a blob there).
+func removeEmpty(fs FileSystem, created []string) {
+	for i := len(created) - 1; i >= 0; i-- {
+		err := fs.Remove(created[i])
+		if err != nil {
+			logrus.Debugf("leaving %s: %s", created[i], err)
+			return
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestMkdirAll(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	err = os.Mkdir(filepath.Join(temp, "a"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := mkdirAll(OSFileSystem{}, filepath.Join(temp, "a", "b", "c"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			filepath.Join(temp, "a", "b"),
+			filepath.Join(temp, "a", "b", "c"),
+		},
+		created,
+	)
+
+	removeEmpty(OSFileSystem{}, created)
+	_, err = os.Stat(filepath.Join(temp, "a", "b"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(temp, "a"))
+	assert.Nil(t, err)
+}
+
+func TestPutRenameFailureCleanup(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	// The parent directories are short, but the 256-byte final
+	// component makes the rename fail on most filesystems.
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}{encoded}{encoded}{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err == nil {
+		t.Skip("filesystem accepts 256-byte path components")
+	}
+
+	_, err = os.Stat(filepath.Join(temp, "blobs"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected the blobs directory to be removed, got %v", err)
+	}
+}
+
+// racingFileSystem interleaves a failing Put and a successful Put
+// into the same directory: the failing Put's rename waits until the
+// successful Put is about to rename, and the successful Put's rename
+// waits until the failing Put has removed the directory.
+type racingFileSystem struct {
+	OSFileSystem
+	failPath    string
+	succeedPath string
+	ready       chan struct{}
+	readyOnce   sync.Once
+	cleaned     chan struct{}
+	cleanedOnce sync.Once
+}
+
+func (fs *racingFileSystem) Rename(oldpath string, newpath string) (err error) {
+	switch newpath {
+	case fs.failPath:
+		<-fs.ready
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.ENOSPC}
+	case fs.succeedPath:
+		fs.readyOnce.Do(func() {
+			close(fs.ready)
+		})
+		<-fs.cleaned
+	}
+	return fs.OSFileSystem.Rename(oldpath, newpath)
+}
+
+func (fs *racingFileSystem) Remove(name string) (err error) {
+	err = fs.OSFileSystem.Remove(name)
+	if name == filepath.Dir(fs.failPath) {
+		fs.cleanedOnce.Do(func() {
+			close(fs.cleaned)
+		})
+	}
+	return err
+}
+
+func TestPutConcurrentCleanup(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/shard/{encoded}", temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	shard := filepath.Join(temp, "blobs", "sha256", "shard")
+	fs := &racingFileSystem{
+		failPath:    filepath.Join(shard, digest.FromString("fail").Encoded()),
+		succeedPath: filepath.Join(shard, digest.FromString("succeed").Encoded()),
+		ready:       make(chan struct{}),
+		cleaned:     make(chan struct{}),
+	}
+	engine.(*Engine).FileSystem = fs
+
+	failed := make(chan error, 1)
+	go func() {
+		_, err := engine.Put(ctx, "", strings.NewReader("fail"))
+		failed <- err
+	}()
+
+	// wait for the failing Put to create the shard directory
+	for {
+		_, err = os.Stat(shard)
+		if err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("succeed"))
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(<-failed, syscall.ENOSPC))
+
+	_, err = os.Stat(filepath.Join(shard, dig.Encoded()))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// MultiLayoutEngine is a CAS engine which makes each blob available
+// under several URI Template layouts at once, e.g. during a migration
+// window between two shard layouts.  It only exposes methods which
+// are aware of every layout; the wrapped Engines' other methods (e.g.
+// DeleteIfSize or CopyFrom) would only act on the first layout.
+type MultiLayoutEngine struct {
+	// primary is the engine for the first layout, where blobs are
+	// written.
+	primary *Engine
+
+	// layouts holds engines for the layouts after the first.
+	layouts []*Engine
+}
+
+// NewMultiLayoutEngine creates a new CAS-engine instance.  The path
+// argument is the same as for NewEngine.  Blobs are written under the
+// first of the uris, and hard-linked into place for the others, so
+// every layout must be on the same filesystem.  Get and Stat try each
+// layout in order, and Delete removes the blob from all of them.
+func NewMultiLayoutEngine(ctx context.Context, path string, uris []string) (engine casengine.Engine, err error) {
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("at least one URI Template is required")
+	}
+
+	engines := make([]*Engine, 0, len(uris))
+	defer func() {
+		if err != nil {
+			for _, eng := range engines {
+				eng.Close(ctx)
+			}
+		}
+	}()
+
+	for _, uri := range uris {
+		eng, err := NewEngine(ctx, path, uri)
+		if err != nil {
+			return nil, err
+		}
+		engines = append(engines, eng.(*Engine))
+	}
+
+	return &MultiLayoutEngine{
+		primary: engines[0],
+		layouts: engines[1:],
+	}, nil
+}
+
+// Get implements Reader.Get.
+func (engine *MultiLayoutEngine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	reader, err = engine.primary.Get(ctx, digest)
+	for _, layout := range engine.layouts {
+		if !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		reader, err = layout.Get(ctx, digest)
+	}
+	return reader, err
+}
+
+// Stat implements Stater.Stat.
+func (engine *MultiLayoutEngine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	size, err = engine.primary.Stat(ctx, digest)
+	for _, layout := range engine.layouts {
+		if !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		size, err = layout.Stat(ctx, digest)
+	}
+	return size, err
+}
+
+// Exists implements Exister.Exists.
+func (engine *MultiLayoutEngine) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	exists, err = engine.primary.Exists(ctx, digest)
+	for _, layout := range engine.layouts {
+		if err != nil || exists {
+			break
+		}
+		exists, err = layout.Exists(ctx, digest)
+	}
+	return exists, err
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.
+func (engine *MultiLayoutEngine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	return engine.primary.Algorithms(ctx, prefix, size, from, callback)
+}
+
+// Put implements Writer.Put.
+func (engine *MultiLayoutEngine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	result, err := engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// PutInfo is like Engine.PutInfo, but it also links the stored blob
+// into place for each additional layout.
+func (engine *MultiLayoutEngine) PutInfo(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (result *PutResult, err error) {
+	result, err = engine.primary.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := engine.primary.getPath(result.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layout := range engine.layouts {
+		err = layout.link(path, result.Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Delete implements Deleter.Delete.
+func (engine *MultiLayoutEngine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	for _, layout := range engine.layouts {
+		err = layout.Delete(ctx, digest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return engine.primary.Delete(ctx, digest)
+}
+
+// Close implements Closer.Close.
+func (engine *MultiLayoutEngine) Close(ctx context.Context) (err error) {
+	for _, layout := range engine.layouts {
+		err2 := layout.Close(ctx)
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}
+
+	err2 := engine.primary.Close(ctx)
+	if err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
+
+// link hard-links the blob at source to the path for digest, unless
+// that path already exists.
+func (engine *Engine) link(source string, digest digest.Digest) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return err
+	}
+
+	if path == source {
+		return nil
+	}
+
+	_, err = engine.FileSystem.Stat(path)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	created, err := mkdirAll(engine.FileSystem, filepath.Dir(path), 0777)
+	if err != nil {
+		return pathError(err)
+	}
+
+	err = retryMissingDir(engine.FileSystem, filepath.Dir(path), &created, func() error {
+		return engine.FileSystem.Link(source, path)
+	})
+	if err != nil && !os.IsExist(err) {
+		removeEmpty(engine.FileSystem, created)
+		return pathError(err)
+	}
+
+	engine.added(path)
+	return nil
+}
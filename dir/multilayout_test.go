@@ -0,0 +1,153 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestMultiLayoutEngine(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	uris := []string{
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+		fmt.Sprintf("file://%s/objects/{algorithm}/{encoded:4}/{encoded}", temp),
+	}
+
+	engine, err := NewMultiLayoutEngine(ctx, temp, uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		filepath.Join(temp, "blobs", "sha256", "df", dig.Encoded()),
+		filepath.Join(temp, "objects", "sha256", "dffd", dig.Encoded()),
+	}
+
+	for i, uri := range uris {
+		t.Run(uri, func(t *testing.T) {
+			layout, err := NewEngine(ctx, temp, uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer layout.Close(ctx)
+
+			reader, err := layout.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(content))
+
+			_, err = os.Stat(paths[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	exister := engine.(casengine.Exister)
+	exists, err := exister.Exists(ctx, dig)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = os.Remove(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err = exister.Exists(ctx, dig)
+	assert.NoError(t, err)
+	assert.True(t, exists, "found in the second layout")
+
+	err = engine.Delete(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		_, err = os.Stat(path)
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", path, err)
+		}
+	}
+
+	exists, err = exister.Exists(ctx, dig)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// methods which would only act on the first layout are not exposed
+	for name, ok := range map[string]bool{
+		"DeleteIfSize": func() bool {
+			_, ok := engine.(interface {
+				DeleteIfSize(ctx context.Context, digest digest.Digest, expectedSize int64) (err error)
+			})
+			return ok
+		}(),
+		"CopyFrom": func() bool {
+			_, ok := engine.(interface {
+				CopyFrom(ctx context.Context, src casengine.Reader, digest digest.Digest) (err error)
+			})
+			return ok
+		}(),
+		"PutReaderAt": func() bool {
+			_, ok := engine.(interface {
+				PutReaderAt(ctx context.Context, algorithm digest.Algorithm, reader io.ReaderAt, size int64) (dig digest.Digest, err error)
+			})
+			return ok
+		}(),
+		"Stage": func() bool {
+			_, ok := engine.(interface {
+				Stage(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (stagingID string, dig digest.Digest, err error)
+			})
+			return ok
+		}(),
+		"GetReadSeeker": func() bool {
+			_, ok := engine.(interface {
+				GetReadSeeker(ctx context.Context, digest digest.Digest) (reader io.ReadSeekCloser, err error)
+			})
+			return ok
+		}(),
+	} {
+		assert.False(t, ok, name)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// OCILayoutEngine is a CAS engine which stores blobs in an OCI image
+// layout.
+// https://github.com/opencontainers/image-spec/blob/v1.0.1/image-layout.md
+type OCILayoutEngine struct {
+	*DigestListerEngine
+
+	// root is the image layout's root directory.
+	root string
+
+	// markerMutex guards markerWritten.
+	markerMutex sync.Mutex
+
+	// markerWritten is true once the oci-layout file is known to
+	// exist.
+	markerWritten bool
+}
+
+// NewOCILayout creates a new CAS-engine instance storing blobs under
+// path/blobs/{algorithm}/{encoded}, as the OCI image layout requires.
+// The first successful Put writes the oci-layout marker file, unless
+// one already exists.
+func NewOCILayout(ctx context.Context, path string) (engine casengine.DigestListerEngine, err error) {
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded}", path)
+	getDigestRegexp, err := TemplateRegexp(template)
+	if err != nil {
+		return nil, err
+	}
+
+	getDigest := &RegexpGetDigest{Regexp: getDigestRegexp}
+	base, err := NewDigestListerEngine(ctx, path, "file://"+template, getDigest.GetDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	lister := base.(*DigestListerEngine)
+	lister.GetEncoded = getDigest.GetEncoded
+	return &OCILayoutEngine{
+		DigestListerEngine: lister,
+		root:               path,
+	}, nil
+}
+
+// Put implements Writer.Put.
+func (engine *OCILayoutEngine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	result, err := engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// PutInfo is like Engine.PutInfo, but it also writes the oci-layout
+// marker file.
+func (engine *OCILayoutEngine) PutInfo(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (result *PutResult, err error) {
+	result, err = engine.Engine.PutInfo(ctx, algorithm, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = engine.writeMarker()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// writeMarker creates the oci-layout file if it does not already
+// exist.
+func (engine *OCILayoutEngine) writeMarker() (err error) {
+	engine.markerMutex.Lock()
+	defer engine.markerMutex.Unlock()
+
+	if engine.markerWritten {
+		return nil
+	}
+
+	data, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(engine.root, ocispec.ImageLayoutFile)
+	file, err := engine.FileSystem.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		if os.IsExist(err) {
+			engine.markerWritten = true
+			return nil
+		}
+		return pathError(err)
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		engine.FileSystem.Remove(path)
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		engine.FileSystem.Remove(path)
+		return err
+	}
+
+	engine.markerWritten = true
+	return nil
+}
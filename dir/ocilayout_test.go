@@ -0,0 +1,83 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestOCILayout(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewOCILayout(ctx, temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = os.Stat(filepath.Join(temp, "oci-layout"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected no oci-layout before the first Put, got %v", err)
+	}
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marker, err := ioutil.ReadFile(filepath.Join(temp, "oci-layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{"imageLayoutVersion": "1.0.0"}`, string(marker))
+
+	content, err := ioutil.ReadFile(filepath.Join(temp, "blobs", "sha256", dig.Encoded()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello, World!", string(content))
+
+	digests := []digest.Digest{}
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []digest.Digest{
+		"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		"sha256:fb62f02acda7d74177a701a1ce006e6bacd90c7d4d7ab481692c1da47c81076b",
+	}, digests)
+}
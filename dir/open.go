@@ -0,0 +1,60 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readFileSystem implements http.FileSystem for the file transport
+// used by Get, opening blobs with the engine's ReadNoAtime and
+// ReadSequential options.
+type readFileSystem struct {
+	engine *Engine
+}
+
+// Open implements http.FileSystem.Open.
+func (fs *readFileSystem) Open(name string) (file http.File, err error) {
+	name = filepath.FromSlash(path.Clean("/" + name))
+
+	flag := os.O_RDONLY
+	if fs.engine.ReadNoAtime {
+		flag |= noatimeFlag
+	}
+
+	osFile, err := os.OpenFile(name, flag, 0)
+	if err != nil && flag != os.O_RDONLY && errors.Is(err, os.ErrPermission) {
+		// O_NOATIME is only allowed for the file's owner.
+		osFile, err = os.OpenFile(name, os.O_RDONLY, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.engine.ReadSequential {
+		err = adviseSequential(osFile)
+		if err != nil {
+			logrus.Debugf("failed to advise sequential reads for %s: %s", name, err)
+		}
+	}
+
+	return osFile, nil
+}
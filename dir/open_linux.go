@@ -0,0 +1,31 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// noatimeFlag is the open flag used for ReadNoAtime.
+const noatimeFlag = syscall.O_NOATIME
+
+// adviseSequential advises the kernel that file will be read
+// sequentially.
+func adviseSequential(file *os.File) (err error) {
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
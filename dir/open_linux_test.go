@@ -0,0 +1,78 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fdinfoFlags = regexp.MustCompile(`(?m)^flags:\s+([0-7]+)$`)
+
+func TestReadFileSystemNoAtime(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	path := filepath.Join(temp, "blob")
+	err = ioutil.WriteFile(path, []byte("Hello, World!"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, noAtime := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noatime %t", noAtime), func(t *testing.T) {
+			fs := &readFileSystem{
+				engine: &Engine{
+					ReadNoAtime:    noAtime,
+					ReadSequential: true,
+				},
+			}
+
+			file, err := fs.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			fdinfo, err := ioutil.ReadFile(fmt.Sprintf("/proc/self/fdinfo/%d", file.(*os.File).Fd()))
+			if err != nil {
+				t.Skip(err)
+			}
+
+			match := fdinfoFlags.FindSubmatch(fdinfo)
+			if match == nil {
+				t.Fatalf("no flags in %q", fdinfo)
+			}
+
+			flags, err := strconv.ParseInt(string(match[1]), 8, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, noAtime, flags&syscall.O_NOATIME != 0)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestGetReadOptions(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range []struct {
+		noAtime    bool
+		sequential bool
+	}{
+		{},
+		{
+			noAtime:    true,
+			sequential: true,
+		},
+	} {
+		t.Run(fmt.Sprintf("noatime %t, sequential %t", options.noAtime, options.sequential), func(t *testing.T) {
+			engine.(*Engine).ReadNoAtime = options.noAtime
+			engine.(*Engine).ReadSequential = options.sequential
+
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(content))
+		})
+	}
+}
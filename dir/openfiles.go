@@ -0,0 +1,76 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// acquireFile waits for one of the MaxOpenFiles slots, returning a
+// function which releases it.  With no limit, it returns a nil
+// release immediately.
+func (engine *Engine) acquireFile(ctx context.Context) (release func(), err error) {
+	if engine.MaxOpenFiles <= 0 {
+		return nil, nil
+	}
+
+	engine.openFilesOnce.Do(func() {
+		engine.openFiles = make(chan struct{}, engine.MaxOpenFiles)
+	})
+
+	select {
+	case engine.openFiles <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-engine.openFiles
+		})
+	}, nil
+}
+
+// releasingReadCloser releases its MaxOpenFiles slot when it is
+// closed.
+type releasingReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer.Close.
+func (reader *releasingReadCloser) Close() (err error) {
+	err = reader.ReadCloser.Close()
+	reader.release()
+	return err
+}
+
+// releasingReadSeekCloser is like releasingReadCloser, but it can
+// seek.
+type releasingReadSeekCloser struct {
+	io.ReadSeekCloser
+	release func()
+}
+
+// Close implements io.Closer.Close.
+func (reader *releasingReadSeekCloser) Close() (err error) {
+	err = reader.ReadSeekCloser.Close()
+	reader.release()
+	return err
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestMaxOpenFiles(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	maxOpenFiles := 2
+	engine.(*Engine).MaxOpenFiles = maxOpenFiles
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		var open, maxOpen int32
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reader, err := engine.Get(ctx, dig)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				current := atomic.AddInt32(&open, 1)
+				for {
+					previous := atomic.LoadInt32(&maxOpen)
+					if current <= previous || atomic.CompareAndSwapInt32(&maxOpen, previous, current) {
+						break
+					}
+				}
+
+				content, err := ioutil.ReadAll(reader)
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&open, -1)
+				reader.Close()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if string(content) != "Hello, World!" {
+					errs <- fmt.Errorf("unexpected content %q", content)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Error(err)
+		}
+		assert.True(t, maxOpen <= int32(maxOpenFiles), "%d readers were open at once", maxOpen)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		var readers []interface{ Close() error }
+		for i := 0; i < maxOpenFiles; i++ {
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			readers = append(readers, reader)
+		}
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := engine.Get(cancelCtx, dig)
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		readers[0].Close()
+		reader, err := engine.Get(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Close()
+		readers[1].Close()
+	})
+}
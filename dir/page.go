@@ -0,0 +1,77 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// DigestsPage is like Digests, but it pages with an opaque
+// continuation token instead of a numeric offset.  Pass an empty
+// token for the first page, and the returned nextToken for later
+// pages.  An empty nextToken means there are no more results.
+//
+// The token records the last path visited, so each page resumes the
+// directory walk where the previous page stopped instead of
+// re-walking the store from the beginning.  Because of this, results
+// are in lexical path order, which may differ from the digest order
+// used by Digests.
+func (engine *DigestListerEngine) DigestsPage(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, token string, callback casengine.DigestCallback) (nextToken string, err error) {
+	if size == 0 {
+		return token, nil
+	}
+	glob, err := engine.Engine.digestGlob(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	count := 0
+	err = walkGlobAfter(ctx, engine.FileSystem, glob, token, func(match string) (err error) {
+		if isSidecar(match) {
+			return nil
+		}
+
+		digest, err := engine.matchDigest(algorithm, match)
+		if err != nil {
+			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
+			return nil
+		}
+
+		if algorithm.String() == "" || digest.Algorithm() == algorithm {
+			if prefix == "" || strings.HasPrefix(digest.Encoded(), prefix) {
+				err = callback(ctx, digest)
+				if err != nil {
+					return err
+				}
+				count++
+				if size != -1 && count >= size {
+					nextToken = match
+					return errStopWalk
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return nextToken, nil
+}
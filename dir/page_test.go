@@ -0,0 +1,90 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDigestsPage(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(ctx)
+
+	for i := 0; i < 32; i++ {
+		algorithm := digest.SHA256
+		if i%4 == 0 {
+			algorithm = digest.SHA512
+		}
+		_, err = engine.Put(ctx, algorithm, strings.NewReader(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, algorithm := range []digest.Algorithm{"", digest.SHA256, digest.SHA512} {
+		expected := []string{}
+		err = engine.Digests(ctx, algorithm, "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+			expected = append(expected, digest.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range []int{-1, 1, 3, 7} {
+			t.Run(fmt.Sprintf("%q,%d", algorithm, size), func(t *testing.T) {
+				digests := []string{}
+				token := ""
+				for pages := 0; ; pages++ {
+					if pages > len(expected) {
+						t.Fatalf("too many pages")
+					}
+
+					token, err = engine.(*DigestListerEngine).DigestsPage(ctx, algorithm, "", size, token, func(ctx context.Context, digest digest.Digest) (err error) {
+						digests = append(digests, digest.String())
+						return nil
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if token == "" {
+						break
+					}
+				}
+
+				sort.Strings(digests)
+				assert.Equal(t, expected, digests)
+			})
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// PathForDigest returns the filesystem path where the engine stores
+// the blob with the given digest, by expanding the engine's URI
+// Template.  The blob does not need to exist.
+func (engine *Engine) PathForDigest(digest digest.Digest) (path string, err error) {
+	return engine.getPath(digest)
+}
+
+// DigestForPath is the inverse of PathForDigest, using the GetDigest
+// passed to NewDigestListerEngine.  Relative paths are resolved
+// against the path passed to NewDigestListerEngine.  Returns an error
+// if the path is not where the engine would store the resulting
+// digest, e.g. for sidecar files or paths outside the layout.
+func (engine *DigestListerEngine) DigestForPath(path string) (dig digest.Digest, err error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(engine.temp), path)
+	}
+	path = filepath.Clean(path)
+
+	dig, err = engine.getDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	expected, err := engine.getPath(dig)
+	if err != nil {
+		return "", err
+	}
+
+	if expected != path {
+		return "", fmt.Errorf("%s is stored at %s, not %s", dig, expected, path)
+	}
+
+	return dig, nil
+}
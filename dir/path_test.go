@@ -0,0 +1,90 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPathForDigest(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	re, err := TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewDigestListerEngine(ctx, temp, "file://"+template, (&RegexpGetDigest{Regexp: re}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, dig := range []digest.Digest{
+		"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"sha512:374d794a95cdcfd8b35993185fef9ba368f160d8daf432d08ba9f1ed1e5abe6cc69291e0fa2fe0006a52570ef18c19def4e617c33ce52ef0a6e5fbe318cb0387",
+	} {
+		t.Run(dig.String(), func(t *testing.T) {
+			path, err := engine.(*DigestListerEngine).PathForDigest(dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, filepath.Join(temp, "blobs", dig.Algorithm().String(), dig.Encoded()[:2], dig.Encoded()), path)
+
+			roundTrip, err := engine.(*DigestListerEngine).DigestForPath(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, dig, roundTrip)
+
+			relative, err := filepath.Rel(temp, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roundTrip, err = engine.(*DigestListerEngine).DigestForPath(relative)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, dig, roundTrip)
+		})
+	}
+
+	for _, path := range []string{
+		"blobs/sha256/00/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		"blobs/sha256/df/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f.crc32c",
+		"other/sha256/df/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+	} {
+		t.Run(path, func(t *testing.T) {
+			_, err := engine.(*DigestListerEngine).DigestForPath(path)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// Plan describes the blobs which a destructive operation would
+// remove, as returned by its dry-run variant (e.g. DeletePlan for
+// Delete).  Relayout takes a dryRun argument instead, because it
+// moves blobs rather than removing them.
+type Plan struct {
+	// Digests lists the blobs which would be removed.
+	Digests []digest.Digest
+
+	// Bytes is the total size of those blobs, which would be
+	// reclaimed.  Sidecars are not included.
+	Bytes int64
+}
+
+// add records a blob which would be removed.
+func (plan *Plan) add(digest digest.Digest, size int64) {
+	plan.Digests = append(plan.Digests, digest)
+	plan.Bytes += size
+}
+
+// DeletePlan is a dry run of Delete for each of digests.  It returns
+// the stored blobs which Delete would remove, without changing the
+// store.  Digests which are not stored are skipped, because deleting
+// them is a no-op.
+func (engine *Engine) DeletePlan(ctx context.Context, digests ...digest.Digest) (plan *Plan, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
+	plan = &Plan{}
+	seen := map[digest.Digest]bool{}
+	for _, digest := range digests {
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+
+		path, err := engine.getPath(digest)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := engine.FileSystem.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, pathError(err)
+		}
+		plan.add(digest, info.Size())
+	}
+
+	return plan, nil
+}
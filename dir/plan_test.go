@@ -0,0 +1,66 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDeletePlan(t *testing.T) {
+	ctx := context.Background()
+
+	path, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	engine, err := NewEngine(ctx, path, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	var digests []digest.Digest
+	for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+		dig, err := engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	plan, err := engine.(*Engine).DeletePlan(ctx, digests[0], digest.FromString("missing"), digests[1], digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Plan{
+		Digests: digests,
+		Bytes:   28,
+	}, plan)
+
+	for _, dig := range digests {
+		_, err = engine.(*Engine).Stat(ctx, dig)
+		assert.NoError(t, err)
+	}
+}
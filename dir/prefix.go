@@ -0,0 +1,74 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// Get implements Reader.Get.  If ResolvePrefixes is set, truncated
+// digests are resolved with ResolvePrefix first.
+func (engine *DigestListerEngine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	if engine.ResolvePrefixes {
+		digest, err = engine.ResolvePrefix(ctx, digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return engine.Engine.Get(ctx, digest)
+}
+
+// ResolvePrefix returns the unique stored digest whose encoded
+// portion starts with the encoded portion of prefix, e.g.
+// sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f
+// for sha256:dffd60.  Digests which are not truncated, including
+// digests with unavailable algorithms, are returned unchanged.
+// Returns an error matching os.ErrNotExist if no stored digest
+// matches, and an error wrapping ErrAmbiguousDigest if several do.
+func (engine *DigestListerEngine) ResolvePrefix(ctx context.Context, prefix digest.Digest) (dig digest.Digest, err error) {
+	algorithm := prefix.Algorithm()
+	encoded := strings.ToLower(prefix.Encoded())
+	if !algorithm.Available() || len(encoded) >= 2*algorithm.Size() {
+		return prefix, nil
+	}
+	if encoded == "" {
+		return "", fmt.Errorf("%w: %q has an empty encoded portion", ErrAmbiguousDigest, prefix)
+	}
+
+	var matches []digest.Digest
+	err = engine.Digests(ctx, algorithm, encoded, 2, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		matches = append(matches, digest)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no stored digest matches %s: %w", prefix, os.ErrNotExist)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s matches several digests, including %s and %s", ErrAmbiguousDigest, prefix, matches[0], matches[1])
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestResolvePrefixes(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	getDigestRegexp, err := TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewDigestListerEngine(ctx, temp, "file://"+template, (&RegexpGetDigest{Regexp: getDigestRegexp}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	// sha256:dffd6021... and sha256:dff1dae5... share the dff prefix.
+	for _, content := range []string{"Hello, World!", "Goodbye, World!", "blob 166"} {
+		_, err = engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hello := digest.FromString("Hello, World!")
+
+	t.Run("off by default", func(t *testing.T) {
+		_, err := engine.Get(ctx, "sha256:dffd")
+		assert.Error(t, err)
+	})
+
+	engine.(*DigestListerEngine).ResolvePrefixes = true
+
+	for _, testcase := range []struct {
+		prefix   digest.Digest
+		expected string
+		err      error
+	}{
+		{
+			prefix:   "sha256:dffd",
+			expected: "Hello, World!",
+		},
+		{
+			prefix:   "sha256:DFFD60",
+			expected: "Hello, World!",
+		},
+		{
+			prefix:   "sha256:fb",
+			expected: "Goodbye, World!",
+		},
+		{
+			prefix:   hello,
+			expected: "Hello, World!",
+		},
+		{
+			prefix: "sha256:dff",
+			err:    ErrAmbiguousDigest,
+		},
+		{
+			prefix: "sha256:",
+			err:    ErrAmbiguousDigest,
+		},
+		{
+			prefix: "sha256:00",
+			err:    os.ErrNotExist,
+		},
+	} {
+		t.Run(string(testcase.prefix), func(t *testing.T) {
+			reader, err := engine.Get(ctx, testcase.prefix)
+			if testcase.err != nil {
+				if !errors.Is(err, testcase.err) {
+					t.Fatalf("expected an error matching %s, got %v", testcase.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, string(content))
+		})
+	}
+}
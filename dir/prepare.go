@@ -0,0 +1,77 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// Prepare creates the directories which the engine's URI Template
+// shares between all blobs of each of the given algorithms, e.g.
+// blobs/sha256 for blobs/{algorithm}/{encoded:2}/{encoded}.  Later
+// Puts then only need to create the directories which depend on the
+// digest, which keeps the first Puts of a bursty ingest fast.
+func (engine *Engine) Prepare(ctx context.Context, algorithms []digest.Algorithm) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	for _, algorithm := range algorithms {
+		dir, err := engine.algorithmDir(algorithm)
+		if err != nil {
+			return err
+		}
+
+		_, err = mkdirAll(engine.FileSystem, dir, 0777)
+		if err != nil {
+			return pathError(err)
+		}
+	}
+
+	return nil
+}
+
+// algorithmDir returns the deepest directory shared by the paths of
+// all blobs using algorithm.
+func (engine *Engine) algorithmDir(algorithm digest.Algorithm) (dir string, err error) {
+	if !algorithm.Available() {
+		return "", fmt.Errorf("algorithm %q is not available", algorithm)
+	}
+
+	// Digests which differ in every character have paths which share
+	// only the directories which do not depend on the encoded value.
+	var paths [2][]string
+	for i, character := range []string{"0", "f"} {
+		path, err := engine.getPath(digest.NewDigestFromEncoded(algorithm, strings.Repeat(character, 2*algorithm.Size())))
+		if err != nil {
+			return "", err
+		}
+		paths[i] = strings.Split(filepath.Dir(path), string(filepath.Separator))
+	}
+
+	common := 0
+	for common < len(paths[0]) && common < len(paths[1]) && paths[0][common] == paths[1][common] {
+		common++
+	}
+
+	return filepath.Join(string(filepath.Separator), filepath.Join(paths[0][:common]...)), nil
+}
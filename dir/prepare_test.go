@@ -0,0 +1,132 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// mkdirCountingFileSystem counts Mkdir calls.
+type mkdirCountingFileSystem struct {
+	OSFileSystem
+	mkdirs []string
+}
+
+func (fs *mkdirCountingFileSystem) Mkdir(name string, perm os.FileMode) (err error) {
+	fs.mkdirs = append(fs.mkdirs, name)
+	return fs.OSFileSystem.Mkdir(name, perm)
+}
+
+func TestPrepare(t *testing.T) {
+	ctx := context.Background()
+
+	for _, testcase := range []struct {
+		template string
+		expected []string
+	}{
+		{
+			template: "blobs/{algorithm}/{encoded:2}/{encoded}",
+			expected: []string{"blobs/sha256", "blobs/sha512"},
+		},
+		{
+			template: "blobs/{algorithm}/{encoded}",
+			expected: []string{"blobs/sha256", "blobs/sha512"},
+		},
+		{
+			template: "{algorithm}-blobs/{encoded}",
+			expected: []string{"sha256-blobs", "sha512-blobs"},
+		},
+	} {
+		t.Run(testcase.template, func(t *testing.T) {
+			temp, err := ioutil.TempDir("", "casengine-dir-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(temp)
+
+			engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/%s", temp, testcase.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			err = engine.(*Engine).Prepare(ctx, []digest.Algorithm{digest.SHA256, digest.SHA512})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, dir := range testcase.expected {
+				info, err := os.Stat(filepath.Join(temp, dir))
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, info.IsDir())
+			}
+		})
+	}
+
+	t.Run("put after prepare", func(t *testing.T) {
+		temp, err := ioutil.TempDir("", "casengine-dir-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(temp)
+
+		engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+
+		err = engine.(*Engine).Prepare(ctx, []digest.Algorithm{digest.SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs := &mkdirCountingFileSystem{}
+		engine.(*Engine).FileSystem = fs
+		_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{filepath.Join(temp, "blobs", "sha256", "df")}, fs.mkdirs)
+	})
+
+	t.Run("unavailable algorithm", func(t *testing.T) {
+		temp, err := ioutil.TempDir("", "casengine-dir-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(temp)
+
+		engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", temp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+
+		err = engine.(*Engine).Prepare(ctx, []digest.Algorithm{"md5"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// ReadableDigests is like Digests, but it stats each blob immediately
+// before passing it to callback and skips blobs which are no longer
+// present, e.g. because a concurrent garbage collector deleted them
+// after they were enumerated.  This costs a stat per digest, but
+// consumers like manifest builders are less likely to reference a
+// vanishing blob.  The size and from arguments count readable digests
+// only.
+func (engine *DigestListerEngine) ReadableDigests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	count := 0
+	done := false
+	err = engine.Digests(ctx, algorithm, prefix, -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		if done {
+			return nil
+		}
+
+		_, err = engine.Stat(ctx, digest)
+		if err != nil {
+			if isMissing(err) {
+				logrus.Debugf("skipping unreadable %s (%s)", digest, err)
+				return nil
+			}
+			return err
+		}
+
+		if from > 0 {
+			from--
+			return nil
+		}
+
+		err = callback(ctx, digest)
+		if err != nil {
+			return err
+		}
+		count++
+		done = size != -1 && count >= size
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestReadableDigests(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	re, err := TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewDigestListerEngine(ctx, temp, "file://"+template, (&RegexpGetDigest{Regexp: re}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	digests := []digest.Digest{}
+	for _, content := range []string{"Hello, World!", "Goodbye, World!", ""} {
+		dig, err := engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	// Sorted: dffd... ("Hello, World!"), e3b0... (""), fb62... ("Goodbye, World!").
+	hello, empty, goodbye := digests[0], digests[2], digests[1]
+
+	for _, testcase := range []struct {
+		name     string
+		size     int
+		from     int
+		expected []digest.Digest
+	}{
+		{
+			name:     "all",
+			size:     -1,
+			expected: []digest.Digest{hello, goodbye},
+		},
+		{
+			name:     "size",
+			size:     2,
+			expected: []digest.Digest{hello, goodbye},
+		},
+		{
+			name:     "from",
+			size:     -1,
+			from:     1,
+			expected: []digest.Digest{empty, goodbye},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, err := engine.Put(ctx, "", strings.NewReader(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listed := []digest.Digest{}
+			err = engine.(*DigestListerEngine).ReadableDigests(ctx, "", "", testcase.size, testcase.from, func(ctx context.Context, dig digest.Digest) (err error) {
+				if dig == hello {
+					// Simulate a garbage collector removing a blob after
+					// enumeration but before it is read.
+					err = engine.Delete(ctx, empty)
+					if err != nil {
+						return err
+					}
+				}
+				listed = append(listed, dig)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, listed)
+		})
+	}
+}
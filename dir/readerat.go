@@ -0,0 +1,135 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// readerAtChunkSize is the size of the ranges read by PutReaderAt.
+const readerAtChunkSize = 1024 * 1024
+
+// PutReaderAt is like Put, but it reads the size bytes of content from
+// reader in ranges, with up to GOMAXPROCS ranges in flight at once.
+// The digest algorithms supported by go-digest (SHA-256, SHA-384, and
+// SHA-512) cannot be computed over ranges independently, so the
+// ranges are hashed and written serially in order; the parallel reads
+// keep slow storage busy while the hash catches up.
+func (engine *Engine) PutReaderAt(ctx context.Context, algorithm digest.Algorithm, reader io.ReaderAt, size int64) (dig digest.Digest, err error) {
+	if size < 0 {
+		return "", fmt.Errorf("invalid size %d", size)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result, err := engine.PutInfo(ctx, algorithm, newParallelReader(ctx, reader, size, runtime.GOMAXPROCS(0)))
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// readerAtChunk is a range read by parallelReader.
+type readerAtChunk struct {
+	data []byte
+	err  error
+}
+
+// parallelReader is an io.Reader which reads ranges of an io.ReaderAt
+// concurrently and returns them in order.
+type parallelReader struct {
+	ctx     context.Context
+	chunks  <-chan chan *readerAtChunk
+	current []byte
+	err     error
+}
+
+// newParallelReader creates a parallelReader for the size bytes of
+// reader, with up to concurrency ranges in flight.  Cancelling ctx
+// stops further reads.
+func newParallelReader(ctx context.Context, reader io.ReaderAt, size int64, concurrency int) (parallel *parallelReader) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	chunks := make(chan chan *readerAtChunk, concurrency)
+	go func() {
+		defer close(chunks)
+		for offset := int64(0); offset < size; offset += readerAtChunkSize {
+			length := size - offset
+			if length > readerAtChunkSize {
+				length = readerAtChunkSize
+			}
+
+			chunk := make(chan *readerAtChunk, 1)
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(offset int64, length int64) {
+				data := make([]byte, length)
+				n, err := reader.ReadAt(data, offset)
+				if int64(n) == length {
+					err = nil
+				} else if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				chunk <- &readerAtChunk{data: data[:n], err: err}
+			}(offset, length)
+		}
+	}()
+
+	return &parallelReader{
+		ctx:    ctx,
+		chunks: chunks,
+	}
+}
+
+// Read implements io.Reader.Read.
+func (reader *parallelReader) Read(p []byte) (n int, err error) {
+	for len(reader.current) == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+
+		chunk, ok := <-reader.chunks
+		if !ok {
+			// The producer also stops early if ctx is cancelled, which
+			// must not look like a complete read.
+			reader.err = reader.ctx.Err()
+			if reader.err == nil {
+				reader.err = io.EOF
+			}
+			continue
+		}
+
+		result := <-chunk
+		reader.current = result.data
+		reader.err = result.err
+	}
+
+	n = copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPutReaderAt(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, size := range []int{0, 13, readerAtChunkSize, 3*readerAtChunkSize + 17} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			data := make([]byte, size)
+			rand.New(rand.NewSource(int64(size))).Read(data)
+
+			dig, err := engine.(*Engine).PutReaderAt(ctx, "", bytes.NewReader(data), int64(size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, digest.FromBytes(data), dig)
+
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, data, content)
+		})
+	}
+
+	t.Run("short reader", func(t *testing.T) {
+		_, err := engine.(*Engine).PutReaderAt(ctx, "", bytes.NewReader([]byte("Hello, World!")), 2*readerAtChunkSize)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		data := make([]byte, 4*readerAtChunkSize)
+		_, err := engine.(*Engine).PutReaderAt(cancelled, "", bytes.NewReader(data), int64(len(data)))
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func BenchmarkPutReaderAt(b *testing.B) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	data := make([]byte, 16*readerAtChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	b.SetBytes(int64(len(data)))
+
+	for _, testcase := range []struct {
+		name string
+		put  func() (err error)
+	}{
+		{
+			name: "serial",
+			put: func() (err error) {
+				_, err = engine.Put(ctx, "", bytes.NewReader(data))
+				return err
+			},
+		},
+		{
+			name: "reader at",
+			put: func() (err error) {
+				_, err = engine.(*Engine).PutReaderAt(ctx, "", bytes.NewReader(data), int64(len(data)))
+				return err
+			},
+		},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := testcase.put()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// RelayoutMove describes a blob moved (or, for dry runs, which would
+// be moved) by Relayout.
+type RelayoutMove struct {
+	// Digest is the digest of the moved blob.
+	Digest digest.Digest
+
+	// From is the blob's path under the old layout.
+	From string
+
+	// To is the blob's path under the new layout.
+	To string
+}
+
+// RelayoutCallback is called by Relayout for each moved blob.
+type RelayoutCallback func(ctx context.Context, move *RelayoutMove) (err error)
+
+// templateExpression matches the URI Template expressions supported
+// by TemplateRegexp.
+var templateExpression = regexp.MustCompile(`{(algorithm|encoded)(:[0-9]+)?}`)
+
+// TemplateRegexp returns a regular expression which matches paths
+// created by expanding template, for use with RegexpGetDigest.  Only
+// {algorithm}, {encoded}, and {encoded:N} expressions are supported.
+func TemplateRegexp(template string) (re *regexp.Regexp, err error) {
+	var builder strings.Builder
+	builder.WriteString("^")
+	captured := map[string]bool{}
+	last := 0
+	for _, match := range templateExpression.FindAllStringSubmatchIndex(template, -1) {
+		literal := template[last:match[0]]
+		if strings.ContainsAny(literal, "{}") {
+			return nil, fmt.Errorf("unsupported URI Template expression in %q", template)
+		}
+		builder.WriteString(regexp.QuoteMeta(literal))
+		last = match[1]
+
+		name := template[match[2]:match[3]]
+		pattern := "[a-z0-9+._-]+"
+		if name == "encoded" {
+			pattern = "[a-zA-Z0-9=_-]+"
+		}
+		if match[4] >= 0 {
+			pattern = fmt.Sprintf("%s{1,%s}", pattern[:len(pattern)-1], template[match[4]+1:match[5]])
+		} else if !captured[name] {
+			pattern = fmt.Sprintf("(?P<%s>%s)", name, pattern)
+			captured[name] = true
+		}
+		builder.WriteString(pattern)
+	}
+
+	literal := template[last:]
+	if strings.ContainsAny(literal, "{}") {
+		return nil, fmt.Errorf("unsupported URI Template expression in %q", template)
+	}
+	builder.WriteString(regexp.QuoteMeta(literal))
+	builder.WriteString("$")
+
+	for _, name := range []string{"algorithm", "encoded"} {
+		if !captured[name] {
+			return nil, fmt.Errorf("URI Template %q has no {%s} expression", template, name)
+		}
+	}
+
+	return regexp.Compile(builder.String())
+}
+
+// Relayout moves every blob listed by from to the path given by this
+// engine's URI Template.  Both engines should share the same root
+// path, so blobs can be renamed into place without copying.  Each
+// blob is verified against its digest before it is moved, and
+// sidecars are moved along with their blobs.
+//
+// Blobs are moved with one rename each, and a blob is only listed by
+// from until it has been moved, so an interrupted Relayout may be
+// resumed by calling it again.  If dryRun is true, callback is called
+// for each blob which would be moved, but nothing is changed.
+// Directories emptied by the move are removed.
+func (engine *Engine) Relayout(ctx context.Context, from *DigestListerEngine, dryRun bool, callback RelayoutCallback) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	return from.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		oldPath, err := from.getPath(digest)
+		if err != nil {
+			return err
+		}
+
+		newPath, err := engine.getPath(digest)
+		if err != nil {
+			return err
+		}
+
+		if oldPath == newPath {
+			return nil
+		}
+
+		move := &RelayoutMove{
+			Digest: digest,
+			From:   oldPath,
+			To:     newPath,
+		}
+
+		if !dryRun {
+			err = engine.relayoutBlob(move)
+			if err != nil {
+				return err
+			}
+		}
+
+		if callback == nil {
+			return nil
+		}
+		return callback(ctx, move)
+	})
+}
+
+// relayoutBlob moves a single blob and its sidecars.
+func (engine *Engine) relayoutBlob(move *RelayoutMove) (err error) {
+	err = engine.verifyPath(move.Digest, move.From)
+	if err != nil {
+		return err
+	}
+
+	_, err = engine.FileSystem.Stat(move.To)
+	if err == nil {
+		// A previous Relayout or a Put already stored the blob under the
+		// new layout, so we only need to remove the old copy.
+		err = engine.verifyPath(move.Digest, move.To)
+		if err != nil {
+			return err
+		}
+		err = engine.remove(move.From)
+		if err != nil {
+			return err
+		}
+		engine.removeEmptyParents(filepath.Dir(move.From))
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	_, err = mkdirAll(engine.FileSystem, filepath.Dir(move.To), 0777)
+	if err != nil {
+		return pathError(err)
+	}
+
+	// Sidecars go first, so the blob itself is not moved until it is
+	// complete under the new layout.
+	for _, suffix := range sidecarSuffixes {
+		err = engine.FileSystem.Rename(move.From+suffix, move.To+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return pathError(err)
+		}
+	}
+
+	logrus.Debugf("moving %s to %s", move.From, move.To)
+	err = engine.FileSystem.Rename(move.From, move.To)
+	if err != nil {
+		return pathError(err)
+	}
+
+	engine.added(move.To)
+
+	engine.removeEmptyParents(filepath.Dir(move.From))
+	return nil
+}
+
+// verifyPath checks the content at path against digest.
+func (engine *Engine) verifyPath(digest digest.Digest, path string) (err error) {
+	file, err := engine.FileSystem.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	verifier := digest.Verifier()
+	_, err = io.Copy(verifier, file)
+	if err != nil {
+		return err
+	}
+
+	if !verifier.Verified() {
+		return fmt.Errorf("%w: %s at %s", ErrVerificationFailed, digest, path)
+	}
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents, stopping at the
+// engine's root path or the first directory which is not empty.
+func (engine *Engine) removeEmptyParents(dir string) {
+	root := filepath.Dir(engine.temp)
+	var parents []string
+	for ; dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+	}
+	removeEmpty(engine.FileSystem, parents)
+}
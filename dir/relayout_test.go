@@ -0,0 +1,155 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestTemplateRegexp(t *testing.T) {
+	for _, testcase := range []struct {
+		template string
+		path     string
+		expected digest.Digest
+	}{
+		{
+			template: "/a/blobs/{algorithm}/{encoded:2}/{encoded}",
+			path:     "/a/blobs/sha256/df/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			expected: "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		},
+		{
+			template: "/a/{encoded}.{algorithm}",
+			path:     "/a/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f.sha256",
+			expected: "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		},
+	} {
+		t.Run(testcase.template, func(t *testing.T) {
+			re, err := TemplateRegexp(testcase.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dig, err := (&RegexpGetDigest{Regexp: re}).GetDigest(testcase.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, dig)
+		})
+	}
+
+	for _, template := range []string{
+		"/a/{encoded}",
+		"/a/{algorithm}/{+encoded}",
+	} {
+		t.Run(template, func(t *testing.T) {
+			_, err := TemplateRegexp(template)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRelayout(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	fromTemplate := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	re, err := TemplateRegexp(fromTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := NewDigestListerEngine(ctx, temp, "file://"+fromTemplate, (&RegexpGetDigest{Regexp: re}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close(ctx)
+	from.(*DigestListerEngine).QuickChecksum = true
+
+	digests := []digest.Digest{}
+	for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+		dig, err := from.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	to, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/objects/{algorithm}/{encoded:4}/{encoded}", temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close(ctx)
+
+	relayout := func(dryRun bool) (moved []digest.Digest) {
+		moved = []digest.Digest{}
+		err := to.(*Engine).Relayout(ctx, from.(*DigestListerEngine), dryRun, func(ctx context.Context, move *RelayoutMove) (err error) {
+			moved = append(moved, move.Digest)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return moved
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		assert.ElementsMatch(t, digests, relayout(true))
+		for _, dig := range digests {
+			_, err := to.(*Engine).Stat(ctx, dig)
+			if !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be missing from the new layout, got %v", dig, err)
+			}
+		}
+	})
+
+	t.Run("real", func(t *testing.T) {
+		assert.ElementsMatch(t, digests, relayout(false))
+		for _, dig := range digests {
+			size, err := to.(*Engine).Stat(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, size > 0)
+
+			err = to.(*Engine).QuickVerify(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err = os.Stat(filepath.Join(temp, "blobs"))
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected the old layout to be removed, got %v", err)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		assert.Equal(t, []digest.Digest{}, relayout(false))
+	})
+}
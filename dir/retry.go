@@ -0,0 +1,75 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// openAttempts bounds the number of times retryFileSystem tries to
+// open a file.
+const openAttempts = 3
+
+// openRetryDelay is the delay before the first retry.  It doubles for
+// each subsequent retry.
+const openRetryDelay = 10 * time.Millisecond
+
+// retryErrnos lists transient errors which are worth retrying.  EMFILE
+// and ENFILE can clear as other goroutines close their files under
+// heavy concurrent load.
+var retryErrnos = []syscall.Errno{
+	syscall.EINTR,
+	syscall.EAGAIN,
+	syscall.EMFILE,
+	syscall.ENFILE,
+}
+
+// retryFileSystem wraps an http.FileSystem, retrying Open calls which
+// fail with transient errors.  The file transport used by Get
+// translates open failures into HTTP error responses, which loses the
+// errno, so the retry happens here instead of at the transport level.
+type retryFileSystem struct {
+	http.FileSystem
+}
+
+// Open implements http.FileSystem.Open.
+func (fs *retryFileSystem) Open(name string) (file http.File, err error) {
+	delay := openRetryDelay
+	for attempt := 1; ; attempt++ {
+		file, err = fs.FileSystem.Open(name)
+		if err == nil || attempt >= openAttempts || !isRetryable(err) {
+			return file, err
+		}
+
+		logrus.Warnf("retrying open of %s after attempt %d failed: %s", name, attempt, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isRetryable returns true if err wraps one of retryErrnos.
+func isRetryable(err error) bool {
+	for _, errno := range retryErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
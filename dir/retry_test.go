@@ -0,0 +1,129 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// flakyFileSystem fails the first failures Open calls with errno.
+type flakyFileSystem struct {
+	http.FileSystem
+	failures int
+	errno    syscall.Errno
+	opens    int
+}
+
+func (fs *flakyFileSystem) Open(name string) (file http.File, err error) {
+	fs.opens++
+	if fs.opens <= fs.failures {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.errno}
+	}
+	return fs.FileSystem.Open(name)
+}
+
+func TestGetRetry(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		failures int
+		errno    syscall.Errno
+		opens    int
+		success  bool
+	}{
+		{
+			name:     "fails once",
+			failures: 1,
+			errno:    syscall.EMFILE,
+			opens:    2,
+			success:  true,
+		},
+		{
+			name:     "keeps failing",
+			failures: openAttempts,
+			errno:    syscall.EINTR,
+			opens:    openAttempts,
+			success:  false,
+		},
+		{
+			name:     "not retryable",
+			failures: 1,
+			errno:    syscall.EACCES,
+			opens:    1,
+			success:  false,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			fs := &flakyFileSystem{
+				FileSystem: http.Dir("/"),
+				failures:   testcase.failures,
+				errno:      testcase.errno,
+			}
+			engine.(*Engine).reader.Client = &http.Client{
+				Transport: http.NewFileTransport(&retryFileSystem{
+					FileSystem: fs,
+				}),
+			}
+
+			reader, err := engine.Get(ctx, dig)
+			assert.Equal(t, testcase.opens, fs.opens)
+			if !testcase.success {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(content))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// GetReadSeeker is like Get, but the returned reader can seek, e.g.
+// to serve HTTP Range requests without reading the skipped content.
+// Because seeking makes streaming verification impossible, the
+// reader is never verified (see VerifySampleRate).
+func (engine *Engine) GetReadSeeker(ctx context.Context, digest digest.Digest) (reader io.ReadSeekCloser, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
+	path, err := engine.getPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := engine.acquireFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := (&readFileSystem{engine: engine}).Open(path)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return nil, pathError(err)
+	}
+
+	if release == nil {
+		return file, nil
+	}
+	return &releasingReadSeekCloser{
+		ReadSeekCloser: file,
+		release:        release,
+	}, nil
+}
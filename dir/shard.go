@@ -0,0 +1,102 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// ShardStats describes how blob paths are spread across directories
+// by a URI Template's sharding, e.g. {encoded:2}.
+type ShardStats struct {
+	// Blobs is the number of blobs.
+	Blobs int64
+
+	// Directories is the number of distinct directories which
+	// directly hold blobs.
+	Directories int64
+}
+
+// BlobsPerDirectory returns the average number of blobs in each
+// directory, or zero if there are no directories.
+func (stats *ShardStats) BlobsPerDirectory() (average float64) {
+	if stats.Directories == 0 {
+		return 0
+	}
+	return float64(stats.Blobs) / float64(stats.Directories)
+}
+
+// ShardStats reports the directory fan-out of the engine's URI
+// Template, so operators can tune shard depth.  If digests is nil,
+// the stored blobs are counted by walking the store, which reads
+// directory entries but no blob content or metadata.  Otherwise
+// paths are computed for the given digests without touching the
+// filesystem, so an engine created with a candidate template (and no
+// blobs) can evaluate a sample of digests from another store.
+func (engine *Engine) ShardStats(ctx context.Context, digests []digest.Digest) (stats *ShardStats, err error) {
+	err = engine.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.operations.Done()
+
+	stats = &ShardStats{}
+	directories := map[string]bool{}
+	count := func(path string) {
+		stats.Blobs++
+		directory := filepath.Dir(path)
+		if !directories[directory] {
+			directories[directory] = true
+			stats.Directories++
+		}
+	}
+
+	if digests != nil {
+		seen := map[digest.Digest]bool{}
+		for _, digest := range digests {
+			if seen[digest] {
+				continue
+			}
+			seen[digest] = true
+
+			path, err := engine.getPath(digest)
+			if err != nil {
+				return nil, err
+			}
+			count(path)
+		}
+		return stats, nil
+	}
+
+	glob, err := engine.digestGlob("")
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkGlob(ctx, engine.FileSystem, glob, func(path string) (err error) {
+		if !isSidecar(path) {
+			count(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
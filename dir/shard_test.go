@@ -0,0 +1,98 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestShardStats(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:1}/{encoded}", temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).QuickChecksum = true
+
+	var digests []digest.Digest
+	for i := 0; i < 100; i++ {
+		dig, err := engine.Put(ctx, "", strings.NewReader(fmt.Sprintf("blob %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, dig)
+	}
+
+	// count the directories which actually hold blobs
+	var directories int64
+	err = filepath.Walk(filepath.Join(temp, "blobs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && filepath.Dir(filepath.Dir(path)) == filepath.Join(temp, "blobs") {
+			directories++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stored blobs", func(t *testing.T) {
+		stats, err := engine.(*Engine).ShardStats(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, &ShardStats{Blobs: 100, Directories: directories}, stats)
+		assert.Equal(t, 100/float64(directories), stats.BlobsPerDirectory())
+	})
+
+	t.Run("sample with candidate template", func(t *testing.T) {
+		candidatePath := filepath.Join(temp, "candidate")
+		err := os.Mkdir(candidatePath, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		candidate, err := NewEngine(ctx, candidatePath, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", candidatePath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer candidate.Close(ctx)
+
+		stats, err := candidate.(*Engine).ShardStats(ctx, append(digests, digests[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, &ShardStats{Blobs: 100, Directories: 1}, stats)
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// DigestsSince calls callback for each stored blob whose modification
+// time is after since, e.g. for incremental backups.  Blobs are
+// immutable, so the modification time approximates when the blob was
+// added.  Like Digests, results are streamed in lexical path order,
+// and ctx is checked for cancellation as the store is walked.
+func (engine *DigestListerEngine) DigestsSince(ctx context.Context, since time.Time, callback casengine.DigestCallback) (err error) {
+	glob, err := engine.Engine.digestGlob("")
+	if err != nil {
+		return err
+	}
+
+	return walkGlob(ctx, engine.FileSystem, glob, func(match string) (err error) {
+		if isSidecar(match) {
+			return nil
+		}
+
+		info, err := engine.FileSystem.Stat(match)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.ModTime().After(since) {
+			return nil
+		}
+
+		digest, err := engine.getDigest(match)
+		if err != nil {
+			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
+			return nil
+		}
+
+		return callback(ctx, digest)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDigestsSince(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(ctx)
+
+	// Backdate the earlier blobs rather than sleeping, so the test does
+	// not depend on the filesystem's timestamp resolution.
+	since := time.Now().Add(-time.Minute)
+	for _, content := range []string{"", "Hello, World!"} {
+		dig, err := engine.Put(ctx, digest.SHA256, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := engine.(*DigestListerEngine).getPath(dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		old := since.Add(-time.Hour)
+		err = os.Chtimes(path, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = engine.Put(ctx, digest.SHA256, strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digests := []string{}
+	err = engine.(*DigestListerEngine).DigestsSince(ctx, since, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(
+		t,
+		[]string{
+			"sha256:fb62f02acda7d74177a701a1ce006e6bacd90c7d4d7ab481692c1da47c81076b",
+		},
+		digests,
+	)
+}
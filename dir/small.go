@@ -0,0 +1,100 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// putSmall writes a buffered blob directly to its final path with
+// O_EXCL.  It returns a nil result without an error if the path
+// already exists, in which case the caller should fall back to
+// putTemp, which handles deduplication, collision checks, and
+// replacing corrupt blobs.
+func (engine *Engine) putSmall(algorithm digest.Algorithm, data []byte) (result *PutResult, err error) {
+	result = &PutResult{
+		Digest:  algorithm.FromBytes(data),
+		Size:    int64(len(data)),
+		Created: true,
+	}
+
+	path, err := engine.getPath(result.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := mkdirAll(engine.FileSystem, filepath.Dir(path), 0777)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	defer func() {
+		if err != nil {
+			removeEmpty(engine.FileSystem, created)
+		}
+	}()
+
+	dir := filepath.Dir(path)
+	if engine.QuickChecksum {
+		err = retryMissingDir(engine.FileSystem, dir, &created, func() error {
+			return engine.putChecksum(path, crc32.Checksum(data, castagnoli))
+		})
+		if err != nil {
+			return nil, pathError(err)
+		}
+	}
+
+	err = retryMissingDir(engine.FileSystem, dir, &created, func() error {
+		return engine.putExpiry(path)
+	})
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	var file File
+	err = retryMissingDir(engine.FileSystem, dir, &created, func() (err error) {
+		file, err = engine.FileSystem.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		return err
+	})
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, nil
+		}
+		return nil, pathError(err)
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+	} else {
+		err = file.Close()
+	}
+	if err != nil {
+		err2 := engine.FileSystem.Remove(path)
+		if err2 != nil {
+			logrus.Error(err2)
+		}
+		return nil, err
+	}
+
+	engine.added(path)
+	engine.emit(OpPut, result.Digest, result.Size)
+	return result, nil
+}
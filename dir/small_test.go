@@ -0,0 +1,133 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPutSmallBlobSize(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).SmallBlobSize = 13
+
+	for _, content := range []string{
+		"",
+		"Hello, World",
+		"Hello, World!",
+		"Hello, World!!",
+		strings.Repeat("Hello, World!", 1000),
+	} {
+		t.Run(fmt.Sprintf("%d bytes", len(content)), func(t *testing.T) {
+			for _, created := range []bool{true, false} {
+				result, err := engine.(*Engine).PutInfo(ctx, "", strings.NewReader(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				result.Duration = 0 // see TestPutDuration
+				assert.Equal(
+					t,
+					&PutResult{
+						Digest:  digest.FromString(content),
+						Size:    int64(len(content)),
+						Created: created,
+					},
+					result,
+				)
+			}
+
+			reader, err := engine.Get(ctx, digest.FromString(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, content, string(data))
+		})
+	}
+}
+
+func BenchmarkPutSmall(b *testing.B) {
+	ctx := context.Background()
+
+	for _, testcase := range []struct {
+		name          string
+		smallBlobSize int64
+	}{
+		{
+			name:          "temporary file",
+			smallBlobSize: 0,
+		},
+		{
+			name:          "direct",
+			smallBlobSize: 4096,
+		},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			temp, err := ioutil.TempDir("", "casengine-dir-test-")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(temp)
+
+			engine, err := NewEngine(
+				ctx,
+				temp,
+				fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).SmallBlobSize = testcase.smallBlobSize
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = engine.Put(ctx, "", strings.NewReader(fmt.Sprintf("blob %d", i)))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Snapshot recreates the engine's blob tree (blobs and their
+// sidecars) under destPath, which must not already contain them.
+// Paths relative to the path passed to NewEngine are preserved, so an
+// engine created at destPath with the same URI Template serves the
+// snapshot.
+//
+// Files are hard-linked, so the snapshot is cheap and shares storage
+// with the original.  Blobs are never modified in place, so later
+// Puts and Deletes on either side do not affect the other.  Hard
+// links require destPath to be on the same filesystem as the store.
+// If linking fails with EXDEV (a different filesystem) or EPERM (a
+// filesystem without hard links), the file is copied instead.
+func (engine *Engine) Snapshot(ctx context.Context, destPath string) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	// NewEngine creates the temporary directory in its path argument.
+	root := filepath.Dir(engine.temp)
+
+	glob, err := engine.digestGlob("")
+	if err != nil {
+		return err
+	}
+
+	return walkGlob(ctx, engine.FileSystem, glob, func(path string) (err error) {
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("cannot snapshot %s, which is outside of %s", path, root)
+		}
+		if strings.HasPrefix(relative, ".casengine-") {
+			// A temporary directory which happens to match the glob.
+			return nil
+		}
+
+		dest := filepath.Join(destPath, relative)
+		_, err = mkdirAll(engine.FileSystem, filepath.Dir(dest), 0777)
+		if err != nil {
+			return pathError(err)
+		}
+
+		err = engine.FileSystem.Link(path, dest)
+		if errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EPERM) {
+			logrus.Debugf("copying %s to %s after failing to link: %s", path, dest, err)
+			err = engine.copyFile(path, dest)
+		}
+		return pathError(err)
+	})
+}
+
+// copyFile copies source to a new file at dest.
+func (engine *Engine) copyFile(source string, dest string) (err error) {
+	reader, err := engine.FileSystem.OpenFile(source, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := engine.FileSystem.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+	if err != nil {
+		writer.Close()
+	} else {
+		err = writer.Close()
+	}
+	if err != nil {
+		err2 := engine.FileSystem.Remove(dest)
+		if err2 != nil {
+			logrus.Error(err2)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// crossDeviceFileSystem is an OSFileSystem whose links fail with
+// EXDEV, as they would across filesystems.
+type crossDeviceFileSystem struct {
+	OSFileSystem
+}
+
+func (crossDeviceFileSystem) Link(oldname string, newname string) (err error) {
+	return &os.LinkError{
+		Op:  "link",
+		Old: oldname,
+		New: newname,
+		Err: syscall.EXDEV,
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	for _, testcase := range []struct {
+		name       string
+		fileSystem FileSystem
+		linked     bool
+	}{
+		{
+			name:       "link",
+			fileSystem: OSFileSystem{},
+			linked:     true,
+		},
+		{
+			name:       "copy fallback",
+			fileSystem: crossDeviceFileSystem{},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			temp, err := ioutil.TempDir("", "casengine-dir-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(temp)
+
+			originalPath := filepath.Join(temp, "original")
+			snapshotPath := filepath.Join(temp, "snapshot")
+			for _, path := range []string{originalPath, snapshotPath} {
+				err = os.Mkdir(path, 0777)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			template := "blobs/{algorithm}/{encoded:2}/{encoded}"
+			original, err := NewEngine(ctx, originalPath, fmt.Sprintf("file://%s/%s", originalPath, template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer original.Close(ctx)
+			original.(*Engine).FileSystem = testcase.fileSystem
+			original.(*Engine).QuickChecksum = true
+
+			var digests []digest.Digest
+			for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+				dig, err := original.Put(ctx, "", strings.NewReader(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				digests = append(digests, dig)
+			}
+
+			err = original.(*Engine).Snapshot(ctx, snapshotPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = original.Delete(ctx, digests[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			snapshot, err := NewEngine(ctx, snapshotPath, fmt.Sprintf("file://%s/%s", snapshotPath, template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer snapshot.Close(ctx)
+
+			for i, content := range []string{"Hello, World!", "Goodbye, World!"} {
+				reader, err := snapshot.Get(ctx, digests[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := ioutil.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, content, string(data))
+			}
+
+			_, err = os.Stat(filepath.Join(snapshotPath, "blobs", "sha256", "df", digests[0].Encoded()+checksumSuffix))
+			assert.NoError(t, err)
+
+			relative := filepath.Join("blobs", "sha256", digests[1].Encoded()[:2], digests[1].Encoded())
+			originalInfo, err := os.Stat(filepath.Join(originalPath, relative))
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshotInfo, err := os.Stat(filepath.Join(snapshotPath, relative))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.linked, os.SameFile(originalInfo, snapshotInfo))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// stagedBlob holds information about a blob written by Stage.
+type stagedBlob struct {
+	path     string
+	result   PutResult
+	checksum hash.Hash32
+}
+
+// Stage writes a blob to a quarantine area outside the live store,
+// for example while ingesting untrusted content.  The staged blob is
+// not visible to Get or Digests until it is moved into place with
+// Promote.  Staged blobs which are never promoted are discarded by
+// Close.
+func (engine *Engine) Stage(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (stagingID string, dig digest.Digest, err error) {
+	err = engine.begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer engine.operations.Done()
+
+	if algorithm.String() == "" {
+		algorithm = engine.Algorithm
+	}
+
+	digester := algorithm.Digester()
+	path, size, checksum, err := engine.writeTemp(reader, digester.Hash())
+	if err != nil {
+		return "", "", err
+	}
+
+	staged := &stagedBlob{
+		path: path,
+		result: PutResult{
+			Digest: digester.Digest(),
+			Size:   size,
+		},
+		checksum: checksum,
+	}
+	stagingID = filepath.Base(path)
+
+	engine.stagingMutex.Lock()
+	if engine.staged == nil {
+		engine.staged = map[string]*stagedBlob{}
+	}
+	engine.staged[stagingID] = staged
+	engine.stagingMutex.Unlock()
+
+	logrus.Debugf("staged %s as %s", staged.result.Digest, stagingID)
+	return stagingID, staged.result.Digest, nil
+}
+
+// Promote moves a blob written by Stage into the live store if its
+// digest is expected.  Otherwise the staged blob is discarded and
+// Promote returns an error wrapping casengine.ErrDigestMismatch.
+// Either way, stagingID may not be used again.  Returns an error
+// matching os.ErrNotExist for unknown staging IDs.
+func (engine *Engine) Promote(ctx context.Context, stagingID string, expected digest.Digest) (err error) {
+	err = engine.begin()
+	if err != nil {
+		return err
+	}
+	defer engine.operations.Done()
+
+	engine.stagingMutex.Lock()
+	staged, ok := engine.staged[stagingID]
+	delete(engine.staged, stagingID)
+	engine.stagingMutex.Unlock()
+	if !ok {
+		return fmt.Errorf("staged blob %q not found: %w", stagingID, os.ErrNotExist)
+	}
+
+	if staged.result.Digest != expected {
+		err2 := engine.FileSystem.Remove(staged.path)
+		if err2 != nil {
+			logrus.Error(err2)
+		}
+		return fmt.Errorf("%w: staged %s, but expected %s", casengine.ErrDigestMismatch, staged.result.Digest, expected)
+	}
+
+	return engine.place(staged.path, staged.result.Size, &staged.result, staged.checksum)
+}
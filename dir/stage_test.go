@@ -0,0 +1,103 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestStagePromote(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	expected := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	t.Run("good", func(t *testing.T) {
+		stagingID, dig, err := engine.(*Engine).Stage(ctx, "", strings.NewReader("Hello, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, dig)
+
+		_, err = engine.(*Engine).Stat(ctx, expected)
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected the staged blob to be hidden, got %v", err)
+		}
+
+		err = engine.(*Engine).Promote(ctx, stagingID, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := engine.(*Engine).Stat(ctx, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, int64(13), size)
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		stagingID, dig, err := engine.(*Engine).Stage(ctx, "", strings.NewReader("Goodbye, World!"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = engine.(*Engine).Promote(ctx, stagingID, expected)
+		if !errors.Is(err, casengine.ErrDigestMismatch) {
+			t.Fatalf("expected an error matching %s, got %v", casengine.ErrDigestMismatch, err)
+		}
+
+		_, err = engine.(*Engine).Stat(ctx, dig)
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be discarded, got %v", dig, err)
+		}
+
+		err = engine.(*Engine).Promote(ctx, stagingID, dig)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+
+		entries, err := ioutil.ReadDir(engine.(*Engine).temp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, entries)
+	})
+}
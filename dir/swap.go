@@ -0,0 +1,79 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Swap replaces the entire store with the directory at replacement,
+// which should be a sibling of the path passed to NewEngine (renames
+// do not cross filesystems) and may be populated by another Engine
+// beforehand.  Swap waits for in-flight operations to finish and
+// holds off new ones until the swap completes, so no operation sees a
+// mix of old and new content.  On success the replacement directory
+// is exchanged into place, the old content is removed, and the
+// replacement path no longer exists.
+//
+// The engine's temporary directory (and any Staged blobs in it) moves
+// into the new store.  The exchange itself is atomic, so other
+// processes reading the store directly always find either the old or
+// the new store at the store path.  The engine's FileSystem must
+// implement Exchanger; if it does not, or if the platform cannot
+// exchange paths atomically, Swap returns an error wrapping
+// ErrExchangeUnsupported and leaves the store unchanged.
+func (engine *Engine) Swap(ctx context.Context, replacement string) (err error) {
+	exchanger, ok := engine.FileSystem.(Exchanger)
+	if !ok {
+		return fmt.Errorf("%w: %T does not implement Exchanger", ErrExchangeUnsupported, engine.FileSystem)
+	}
+
+	end, err := engine.beginExclusive()
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	// NewEngine creates the temporary directory in its path argument.
+	root := filepath.Dir(engine.temp)
+	movedTemp := filepath.Join(replacement, filepath.Base(engine.temp))
+	err = engine.FileSystem.Rename(engine.temp, movedTemp)
+	if err != nil {
+		return err
+	}
+
+	err = exchanger.Exchange(replacement, root)
+	if err != nil {
+		undoErr := engine.FileSystem.Rename(movedTemp, engine.temp)
+		if undoErr != nil {
+			return fmt.Errorf("%w (and failed to restore the temporary directory: %s)", err, undoErr)
+		}
+		return err
+	}
+
+	// The replacement path now holds the previous store.
+	err = engine.FileSystem.RemoveAll(replacement)
+	if err != nil {
+		logrus.Warnf("failed to remove the previous store at %s: %s", replacement, err)
+	}
+
+	engine.replaced()
+	logrus.Debugf("swapped %s into %s", replacement, root)
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestSwap(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	storePath := filepath.Join(temp, "store")
+	replacementPath := filepath.Join(temp, "replacement")
+	for _, path := range []string{storePath, replacementPath} {
+		err = os.Mkdir(path, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	template := "blobs/{algorithm}/{encoded:2}/{encoded}"
+	engine, err := NewEngine(ctx, storePath, fmt.Sprintf("file://%s/%s", storePath, template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	hello, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replacement, err := NewEngine(ctx, replacementPath, fmt.Sprintf("file://%s/%s", replacementPath, template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goodbye, err := replacement.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = replacement.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.(*Engine).Swap(ctx, replacementPath)
+	if errors.Is(err, ErrExchangeUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Get(ctx, hello)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	reader, err := engine.Get(ctx, goodbye)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Goodbye, World!", string(data))
+
+	// the temporary directory moved with the store, so Put still works
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	assert.NoError(t, err)
+
+	entries, err := ioutil.ReadDir(temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"store"}, names)
+
+	err = engine.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.(*Engine).Swap(ctx, replacementPath)
+	assert.Equal(t, ErrClosed, err)
+}
+
+// noExchangeFileSystem hides OSFileSystem's Exchange method.
+type noExchangeFileSystem struct {
+	FileSystem
+}
+
+func TestSwapUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	storePath := filepath.Join(temp, "store")
+	replacementPath := filepath.Join(temp, "replacement")
+	for _, path := range []string{storePath, replacementPath} {
+		err = os.Mkdir(path, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine, err := NewEngine(ctx, storePath, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded}", storePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	hello, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.(*Engine).FileSystem = noExchangeFileSystem{FileSystem: OSFileSystem{}}
+	err = engine.(*Engine).Swap(ctx, replacementPath)
+	assert.True(t, errors.Is(err, ErrExchangeUnsupported))
+
+	exists, err := engine.(*Engine).Exists(ctx, hello)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = os.Stat(replacementPath)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Usage returns the number of stored blobs and their total size in
+// bytes.  Sidecars are not included.  Blobs are counted as the
+// store is walked, so memory use does not grow with the number of
+// blobs, and ctx is checked for cancellation throughout.  Blobs
+// added or removed during the walk may or may not be counted.
+func (engine *Engine) Usage(ctx context.Context) (blobCount int64, totalBytes int64, err error) {
+	err = engine.begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer engine.operations.Done()
+
+	glob, err := engine.digestGlob("")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = walkGlob(ctx, engine.FileSystem, glob, func(path string) (err error) {
+		if isSidecar(path) {
+			return nil
+		}
+
+		info, err := engine.FileSystem.Stat(path)
+		if err != nil {
+			if isMissing(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		blobCount++
+		totalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return blobCount, totalBytes, nil
+}
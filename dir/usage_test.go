@@ -0,0 +1,90 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+	engine.(*Engine).QuickChecksum = true
+
+	blobCount, totalBytes, err := engine.(*Engine).Usage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(0), blobCount)
+	assert.Equal(t, int64(0), totalBytes)
+
+	for _, blob := range []struct {
+		algorithm digest.Algorithm
+		content   string
+	}{
+		{
+			algorithm: digest.SHA256,
+			content:   "Hello, World!",
+		},
+		{
+			algorithm: digest.SHA256,
+			content:   "Goodbye, World!",
+		},
+		{
+			algorithm: digest.SHA512,
+			content:   "Hello, World!",
+		},
+	} {
+		_, err = engine.Put(ctx, blob.algorithm, strings.NewReader(blob.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blobCount, totalBytes, err = engine.(*Engine).Usage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(3), blobCount)
+	assert.Equal(t, int64(13+15+13), totalBytes)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = engine.(*Engine).Usage(cancelled)
+	assert.Equal(t, context.Canceled, err)
+}
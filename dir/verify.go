@@ -0,0 +1,67 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrVerificationFailed is returned when reading a blob sampled for
+// verification (see VerifySampleRate) whose content does not match
+// its digest.
+var ErrVerificationFailed = errors.New("blob content does not match its digest")
+
+// verifyingReader checks its content against digest, returning an
+// error wrapping ErrVerificationFailed instead of io.EOF on mismatch.
+type verifyingReader struct {
+	io.ReadCloser
+	digest   digest.Digest
+	verifier digest.Verifier
+}
+
+// Read implements io.Reader.Read.
+func (reader *verifyingReader) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	reader.verifier.Write(p[:n])
+	if err == io.EOF && !reader.verifier.Verified() {
+		logrus.Errorf("stored blob %s does not match its digest", reader.digest)
+		return n, fmt.Errorf("%w: %s", ErrVerificationFailed, reader.digest)
+	}
+	return n, err
+}
+
+// sampleVerify wraps reader in a verifyingReader for a VerifySampleRate
+// fraction of calls.
+func (engine *Engine) sampleVerify(digest digest.Digest, reader io.ReadCloser) io.ReadCloser {
+	if engine.VerifySampleRate <= 0 || !digest.Algorithm().Available() {
+		return reader
+	}
+
+	if rand.Float64() >= engine.VerifySampleRate {
+		return reader
+	}
+
+	return &verifyingReader{
+		ReadCloser: reader,
+		digest:     digest,
+		verifier:   digest.Verifier(),
+	}
+}
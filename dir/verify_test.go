@@ -0,0 +1,113 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestVerifySampleRate(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine, err := NewEngine(
+		ctx,
+		temp,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	good, err := engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt, err := engine.Put(ctx, "", strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := engine.(*Engine).getPath(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(path, []byte("Goodbye, World?"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		rate     float64
+		verified bool
+	}{
+		{
+			rate:     1,
+			verified: true,
+		},
+		{
+			rate:     0,
+			verified: false,
+		},
+	} {
+		t.Run(fmt.Sprintf("%g", testcase.rate), func(t *testing.T) {
+			engine.(*Engine).VerifySampleRate = testcase.rate
+
+			reader, err := engine.Get(ctx, good)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(data))
+
+			reader, err = engine.Get(ctx, corrupt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = ioutil.ReadAll(reader)
+			reader.Close()
+			if testcase.verified {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Fatalf("expected an error matching %s, got %v", ErrVerificationFailed, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, "Goodbye, World?", string(data))
+			}
+		})
+	}
+}
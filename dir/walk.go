@@ -0,0 +1,186 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// errStopWalk may be returned by a walkGlob callback to stop the walk
+// without walkGlob returning an error.
+var errStopWalk = errors.New("stop walk")
+
+// walkGlob calls callback for each path matching pattern (with
+// filepath.Match syntax) in lexical order.  Unlike filepath.Glob,
+// matches are passed to callback as they are found, and ctx is
+// checked for cancellation before each directory read and match.
+// Missing directories are treated as having no matches.
+func walkGlob(ctx context.Context, fs FileSystem, pattern string, callback func(path string) (err error)) (err error) {
+	return walkGlobAfter(ctx, fs, pattern, "", callback)
+}
+
+// walkGlobAfter is like walkGlob, but if after is not empty, it only
+// calls callback for matches which sort after it.  Directories which
+// cannot contain such matches are not read.
+func walkGlobAfter(ctx context.Context, fs FileSystem, pattern string, after string, callback func(path string) (err error)) (err error) {
+	root := string(filepath.Separator)
+	if !filepath.IsAbs(pattern) {
+		root = "."
+	}
+
+	components := splitPath(pattern)
+	var afterComponents []string
+	if after != "" {
+		afterComponents = splitPath(after)
+		if len(afterComponents) != len(components) {
+			return fmt.Errorf("%q cannot match %q", after, pattern)
+		}
+	}
+
+	err = walkComponents(ctx, fs, root, components, afterComponents, callback)
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+func splitPath(path string) (components []string) {
+	return strings.Split(strings.Trim(path, string(filepath.Separator)), string(filepath.Separator))
+}
+
+// walkComponents walks the remaining pattern components under dir.
+// If after is not nil, it holds the corresponding components of a
+// path which has already been visited, and only later paths are
+// walked.
+func walkComponents(ctx context.Context, fs FileSystem, dir string, components []string, after []string, callback func(path string) (err error)) (err error) {
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	component := components[0]
+	last := len(components) == 1
+
+	if !hasMeta(component) {
+		var next []string
+		if after != nil {
+			if component < after[0] || (last && component == after[0]) {
+				return nil
+			}
+			if component == after[0] {
+				next = after[1:]
+			}
+		}
+
+		path := filepath.Join(dir, component)
+		if last {
+			_, err = fs.Stat(path)
+			if err != nil {
+				if isMissing(err) {
+					return nil
+				}
+				return err
+			}
+			return callback(path)
+		}
+		return walkComponents(ctx, fs, path, components[1:], next, callback)
+	}
+
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		if isMissing(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		var next []string
+		if after != nil {
+			if entry.Name() < after[0] || (last && entry.Name() == after[0]) {
+				continue
+			}
+			if entry.Name() == after[0] {
+				next = after[1:]
+			}
+		}
+
+		matched, err := filepath.Match(component, entry.Name())
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if last {
+			err = callback(path)
+		} else {
+			err = walkComponents(ctx, fs, path, components[1:], next, callback)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// globRoot returns the longest directory prefix of pattern which
+// contains no magic characters.
+func globRoot(pattern string) (root string) {
+	root = string(filepath.Separator)
+	if !filepath.IsAbs(pattern) {
+		root = "."
+	}
+
+	components := splitPath(pattern)
+	for _, component := range components[:len(components)-1] {
+		if hasMeta(component) {
+			break
+		}
+		root = filepath.Join(root, component)
+	}
+	return root
+}
+
+// hasMeta reports whether component contains any of the magic
+// characters recognized by filepath.Match.
+func hasMeta(component string) bool {
+	magicChars := `*?[`
+	if filepath.Separator != '\\' {
+		magicChars = `*?[\`
+	}
+	return strings.ContainsAny(component, magicChars)
+}
+
+// isMissing returns true for errors which mean a walked path does not
+// exist as a directory.
+func isMissing(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
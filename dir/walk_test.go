@@ -0,0 +1,152 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestWalkGlob(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	for _, path := range []string{"a/x/1", "a/y/2", "b/x/3", "a/x/skip/4"} {
+		path = filepath.Join(temp, filepath.FromSlash(path))
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte{}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, testcase := range []struct {
+		pattern  string
+		expected []string
+	}{
+		{
+			pattern:  "*/*/*",
+			expected: []string{"a/x/1", "a/x/skip", "a/y/2", "b/x/3"},
+		},
+		{
+			pattern:  "a/x/*",
+			expected: []string{"a/x/1", "a/x/skip"},
+		},
+		{
+			pattern:  "*/y/2",
+			expected: []string{"a/y/2"},
+		},
+		{
+			pattern:  "missing/*/*",
+			expected: []string{},
+		},
+	} {
+		t.Run(testcase.pattern, func(t *testing.T) {
+			matches := []string{}
+			err := walkGlob(ctx, OSFileSystem{}, filepath.Join(temp, filepath.FromSlash(testcase.pattern)), func(path string) (err error) {
+				relative, err := filepath.Rel(temp, path)
+				if err != nil {
+					return err
+				}
+				matches = append(matches, filepath.ToSlash(relative))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, testcase.expected, matches)
+		})
+	}
+}
+
+func TestDigestsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	temp, err := ioutil.TempDir("", "casengine-dir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	engine := newTestDigestListerEngine(ctx, t, temp)
+	defer engine.Close(context.Background())
+
+	for i := 0; i < 512; i++ {
+		_, err = engine.Put(ctx, "", strings.NewReader(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := 0
+	start := time.Now()
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		count++
+		cancel()
+		return nil
+	})
+	duration := time.Since(start)
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, count)
+	assert.True(t, duration < time.Second, "took %s to return after cancellation", duration)
+}
+
+func TestGlobRoot(t *testing.T) {
+	for _, testcase := range []struct {
+		pattern  string
+		expected string
+	}{
+		{
+			pattern:  "/a/b/*/c",
+			expected: "/a/b",
+		},
+		{
+			pattern:  "/a/b/c",
+			expected: "/a/b",
+		},
+		{
+			pattern:  "a/*",
+			expected: "a",
+		},
+		{
+			pattern:  "*/b",
+			expected: ".",
+		},
+	} {
+		t.Run(testcase.pattern, func(t *testing.T) {
+			assert.Equal(t, filepath.FromSlash(testcase.expected), globRoot(filepath.FromSlash(testcase.pattern)))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"github.com/opencontainers/go-digest"
+)
+
+// ETag returns an HTTP entity tag for the blob with the given digest.
+// Blob content is immutable, so the digest is a strong validator: two
+// responses with the same ETag are byte-for-byte identical.
+// https://tools.ietf.org/html/rfc7232#section-2.3
+func ETag(digest digest.Digest) (etag string) {
+	return `"` + digest.String() + `"`
+}
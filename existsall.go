@@ -0,0 +1,71 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// ExistsAll calls exister.Exists for each of digests, with at most
+// workers calls in flight at once.  The returned map holds results
+// for every successful check, even if err is not nil.  Duplicate
+// digests are only checked once.  If any check fails, err joins the
+// per-digest errors, each of which names its digest.
+func ExistsAll(ctx context.Context, exister Exister, digests []digest.Digest, workers int) (exists map[digest.Digest]bool, err error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mutex sync.Mutex
+	var errs []error
+	exists = map[digest.Digest]bool{}
+	queue := make(chan digest.Digest)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dig := range queue {
+				present, err := exister.Exists(ctx, dig)
+				mutex.Lock()
+				if err == nil {
+					exists[dig] = present
+				} else {
+					errs = append(errs, fmt.Errorf("%s: %w", dig, err))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	seen := map[digest.Digest]bool{}
+	for _, dig := range digests {
+		if seen[dig] {
+			continue
+		}
+		seen[dig] = true
+		queue <- dig
+	}
+	close(queue)
+	wg.Wait()
+
+	return exists, errors.Join(errs...)
+}
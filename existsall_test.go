@@ -0,0 +1,59 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// mapExister is an Exister backed by a map, which fails for digests
+// mapped to false.
+type mapExister map[digest.Digest]bool
+
+var errExists = errors.New("exists failed")
+
+func (exister mapExister) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	ok, known := exister[digest]
+	if known && !ok {
+		return false, errExists
+	}
+	return known, nil
+}
+
+func TestExistsAll(t *testing.T) {
+	ctx := context.Background()
+	hello := digest.FromString("Hello, World!")
+	goodbye := digest.FromString("Goodbye, World!")
+	broken := digest.FromString("broken")
+	exister := mapExister{
+		hello:  true,
+		broken: false,
+	}
+
+	exists, err := ExistsAll(ctx, exister, []digest.Digest{hello, goodbye, broken, hello}, 2)
+	if !errors.Is(err, errExists) {
+		t.Fatalf("expected an error matching %s, got %v", errExists, err)
+	}
+	assert.Contains(t, err.Error(), broken.String())
+	assert.Equal(t, map[digest.Digest]bool{
+		hello:   true,
+		goodbye: false,
+	}, exists)
+}
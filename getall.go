@@ -0,0 +1,73 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// GetAll calls reader.Get for each of digests, with at most workers
+// calls in flight at once.  The returned map holds readers for every
+// successful Get, even if err is not nil, and callers are responsible
+// for closing them.  Duplicate digests are only
+// fetched once.  If any Get fails, err joins the per-digest
+// errors, each of which names its digest.
+func GetAll(ctx context.Context, reader Reader, digests []digest.Digest, workers int) (readers map[digest.Digest]io.ReadCloser, err error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mutex sync.Mutex
+	var errs []error
+	readers = map[digest.Digest]io.ReadCloser{}
+	queue := make(chan digest.Digest)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dig := range queue {
+				rawReader, err := reader.Get(ctx, dig)
+				mutex.Lock()
+				if err == nil {
+					readers[dig] = rawReader
+				} else {
+					errs = append(errs, fmt.Errorf("%s: %w", dig, err))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	seen := map[digest.Digest]bool{}
+	for _, dig := range digests {
+		if seen[dig] {
+			continue
+		}
+		seen[dig] = true
+		queue <- dig
+	}
+	close(queue)
+	wg.Wait()
+
+	return readers, errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestGetAll(t *testing.T) {
+	ctx := context.Background()
+	blobs := map[string]string{}
+	reader := mapReader{}
+	digests := []digest.Digest{}
+	for _, content := range []string{"Hello, World!", "Goodbye, World!", ""} {
+		dig := digest.FromString(content)
+		reader[dig] = []byte(content)
+		blobs[dig.String()] = content
+		digests = append(digests, dig)
+	}
+	missing := digest.FromString("missing")
+	digests = append(digests, missing, digests[0])
+
+	readers, err := GetAll(ctx, reader, digests, 2)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+	}
+	assert.Contains(t, err.Error(), missing.String())
+
+	contents := map[string]string{}
+	for dig, rawReader := range readers {
+		data, err := ioutil.ReadAll(rawReader)
+		rawReader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[dig.String()] = string(data)
+	}
+	assert.Equal(t, blobs, contents)
+}
@@ -0,0 +1,364 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpfs exposes a CAS engine as an http.FileSystem, so blobs
+// can be served with http.FileServer, or directly as an http.Handler
+// which adds strong ETags.  Blobs are available at
+// /{algorithm}/{encoded}.  Directory listings are denied.  When the
+// engine is a casengine.Writer, the http.Handler also accepts blob
+// uploads (see ServeHTTP).
+package httpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/counter"
+	"golang.org/x/net/context"
+)
+
+// ReadSeekGetter is implemented by engines which can return seekable
+// blob readers, like the dir engine.
+type ReadSeekGetter interface {
+
+	// GetReadSeeker is like casengine.Reader.Get, but the returned
+	// reader can seek.
+	GetReadSeeker(ctx context.Context, digest digest.Digest) (reader io.ReadSeekCloser, err error)
+}
+
+// FileSystem implements http.FileSystem and http.Handler for a CAS
+// engine.
+type FileSystem struct {
+	ctx    context.Context
+	reader casengine.Reader
+}
+
+// New creates a new http.FileSystem serving blobs from reader.  The
+// context is used for engine calls made for files returned by Open;
+// ServeHTTP uses each request's context instead, so disconnected
+// clients cancel their engine calls.  If
+// reader implements casengine.Stater, it is used to size blobs.
+// Otherwise blobs are read once to determine their size.  If reader
+// implements ReadSeekGetter, seeks (e.g. for HTTP Range requests) seek
+// the blob reader directly.  Otherwise each seek re-fetches the blob
+// from the start and discards the content before the new offset.
+func New(ctx context.Context, reader casengine.Reader) (fileSystem *FileSystem) {
+	return &FileSystem{
+		ctx:    ctx,
+		reader: reader,
+	}
+}
+
+// Open implements http.FileSystem.Open.
+func (fileSystem *FileSystem) Open(name string) (file http.File, err error) {
+	dig, err := parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileSystem.open(fileSystem.ctx, dig)
+}
+
+// ServeHTTP implements http.Handler.  It serves blobs like
+// http.FileServer, but sets a strong ETag (see casengine.ETag), so
+// requests with a matching If-None-Match get a 304 Not Modified
+// response without reading or sizing the blob.  Engines which
+// implement casengine.Exister are checked for the blob first, and
+// other engines are trusted to have it, because the ETag is derived
+// from the requested digest.  PUT and POST requests are
+// handled by put.
+func (fileSystem *FileSystem) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPut || request.Method == http.MethodPost {
+		fileSystem.put(writer, request)
+		return
+	}
+
+	dig, err := parse(request.URL.Path)
+	if err != nil {
+		serveError(writer, err)
+		return
+	}
+
+	etag := casengine.ETag(dig)
+	if (request.Method == http.MethodGet || request.Method == http.MethodHead) && etagMatch(request.Header.Get("If-None-Match"), etag) {
+		exister, ok := fileSystem.reader.(casengine.Exister)
+		if ok {
+			exists, err := exister.Exists(request.Context(), dig)
+			if err != nil {
+				serveError(writer, err)
+				return
+			}
+			if !exists {
+				serveError(writer, os.ErrNotExist)
+				return
+			}
+		}
+
+		writer.Header().Set("ETag", etag)
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, err := fileSystem.open(request.Context(), dig)
+	if err != nil {
+		serveError(writer, err)
+		return
+	}
+	defer file.Close()
+
+	writer.Header().Set("ETag", etag)
+	http.ServeContent(writer, request, dig.Encoded(), time.Time{}, file)
+}
+
+// etagMatch returns true if an If-None-Match header matches etag,
+// using the weak comparison RFC 7232 requires for If-None-Match.
+func etagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parse returns the digest for a blob path.
+func parse(name string) (dig digest.Digest, err error) {
+	name = path.Clean("/" + name)
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(parts) < 2 {
+		return "", os.ErrPermission
+	}
+	if len(parts) > 2 {
+		return "", os.ErrNotExist
+	}
+
+	dig, err = digest.Parse(fmt.Sprintf("%s:%s", parts[0], parts[1]))
+	if err != nil {
+		return "", os.ErrNotExist
+	}
+
+	return dig, nil
+}
+
+// serveError writes an error response like http.FileServer's.
+func serveError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(writer, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(writer, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(writer, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// open returns a file for the blob with the given digest, which
+// makes its engine calls with ctx.
+func (fileSystem *FileSystem) open(ctx context.Context, dig digest.Digest) (file *blobFile, err error) {
+	size, err := fileSystem.size(ctx, dig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blobFile{
+		ctx:    ctx,
+		reader: fileSystem.reader,
+		digest: dig,
+		size:   size,
+	}, nil
+}
+
+func (fileSystem *FileSystem) size(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	stater, ok := fileSystem.reader.(casengine.Stater)
+	if ok {
+		return stater.Stat(ctx, digest)
+	}
+
+	reader, err := fileSystem.reader.Get(ctx, digest)
+	if err != nil {
+		return -1, err
+	}
+	defer reader.Close()
+
+	counter := &counter.Counter{}
+	_, err = io.Copy(counter, reader)
+	if err != nil {
+		return -1, err
+	}
+
+	return int64(counter.Count()), nil
+}
+
+// blobFile implements http.File for a blob.  Seeking is supported by
+// seeking the reader from ReadSeekGetter, if available, or by
+// re-fetching the blob and discarding content before the requested
+// offset.
+type blobFile struct {
+	ctx    context.Context
+	reader casengine.Reader
+	digest digest.Digest
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (file *blobFile) Read(p []byte) (n int, err error) {
+	if file.offset >= file.size {
+		return 0, io.EOF
+	}
+
+	if file.body == nil {
+		body, err := file.get()
+		if err != nil {
+			return 0, err
+		}
+		file.body = body
+	}
+
+	n, err = file.body.Read(p)
+	file.offset += int64(n)
+	return n, err
+}
+
+// get returns a reader for the blob, positioned at offset.
+func (file *blobFile) get() (body io.ReadCloser, err error) {
+	getter, ok := file.reader.(ReadSeekGetter)
+	if ok {
+		seeker, err := getter.GetReadSeeker(file.ctx, file.digest)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = seeker.Seek(file.offset, io.SeekStart)
+		if err != nil {
+			seeker.Close()
+			return nil, err
+		}
+
+		return seeker, nil
+	}
+
+	body, err = file.reader.Get(file.ctx, file.digest)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.CopyN(ioutil.Discard, body, file.offset)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// Seek implements io.Seeker.
+func (file *blobFile) Seek(offset int64, whence int) (position int64, err error) {
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = file.offset + offset
+	case io.SeekEnd:
+		position = file.size + offset
+	default:
+		return file.offset, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if position < 0 {
+		return file.offset, fmt.Errorf("negative position %d", position)
+	}
+
+	seeker, ok := file.body.(io.Seeker)
+	if ok && position != file.offset {
+		_, err = seeker.Seek(position, io.SeekStart)
+		if err != nil {
+			return file.offset, err
+		}
+	} else if position != file.offset && file.body != nil {
+		err = file.body.Close()
+		file.body = nil
+		if err != nil {
+			return file.offset, err
+		}
+	}
+
+	file.offset = position
+	return position, nil
+}
+
+// Close implements io.Closer.
+func (file *blobFile) Close() (err error) {
+	if file.body == nil {
+		return nil
+	}
+
+	err = file.body.Close()
+	file.body = nil
+	return err
+}
+
+// Readdir implements http.File.Readdir.  Blobs are not directories.
+func (file *blobFile) Readdir(count int) (infos []os.FileInfo, err error) {
+	return nil, fmt.Errorf("%s is not a directory", file.digest)
+}
+
+// Stat implements http.File.Stat.
+func (file *blobFile) Stat() (info os.FileInfo, err error) {
+	return &blobInfo{
+		digest: file.digest,
+		size:   file.size,
+	}, nil
+}
+
+// blobInfo implements os.FileInfo for a blob.
+type blobInfo struct {
+	digest digest.Digest
+	size   int64
+}
+
+func (info *blobInfo) Name() string {
+	return info.digest.Encoded()
+}
+
+func (info *blobInfo) Size() int64 {
+	return info.size
+}
+
+func (info *blobInfo) Mode() os.FileMode {
+	return 0444
+}
+
+func (info *blobInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (info *blobInfo) IsDir() bool {
+	return false
+}
+
+func (info *blobInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,447 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpfs
+
+import (
+	"bytes"
+	_ "crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func TestFileServer(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.FileServer(New(ctx, engine)))
+	defer server.Close()
+
+	for _, testcase := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{
+			path:   "/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			status: http.StatusOK,
+			body:   "Hello, World!",
+		},
+		{
+			path:   "/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			status: http.StatusNotFound,
+		},
+		{
+			path:   "/sha256/not-a-digest",
+			status: http.StatusNotFound,
+		},
+		{
+			path:   "/",
+			status: http.StatusForbidden,
+		},
+		{
+			path:   "/sha256/",
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(testcase.path, func(t *testing.T) {
+			response, err := http.Get(server.URL + testcase.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			assert.Equal(t, testcase.status, response.StatusCode)
+			if testcase.status != http.StatusOK {
+				return
+			}
+
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, testcase.body, string(body))
+			assert.Equal(t, "13", response.Header.Get("Content-Length"))
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(New(ctx, engine))
+	defer server.Close()
+
+	path := "/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"
+	etag := `"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"`
+
+	for _, testcase := range []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		status      int
+		body        string
+	}{
+		{
+			name:   "unconditional",
+			path:   path,
+			status: http.StatusOK,
+			body:   "Hello, World!",
+		},
+		{
+			name:        "matching If-None-Match",
+			path:        path,
+			ifNoneMatch: etag,
+			status:      http.StatusNotModified,
+		},
+		{
+			name:        "other If-None-Match",
+			path:        path,
+			ifNoneMatch: `"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`,
+			status:      http.StatusOK,
+			body:        "Hello, World!",
+		},
+		{
+			name:   "missing",
+			path:   "/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "directory",
+			path:   "/sha256/",
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request, err := http.NewRequest("GET", server.URL+testcase.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testcase.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", testcase.ifNoneMatch)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			assert.Equal(t, testcase.status, response.StatusCode)
+			if testcase.status == http.StatusOK || testcase.status == http.StatusNotModified {
+				assert.Equal(t, etag, response.Header.Get("ETag"))
+			}
+
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testcase.status != http.StatusNotFound && testcase.status != http.StatusForbidden {
+				assert.Equal(t, testcase.body, string(body))
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-httpfs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	dirEngine, err := dir.NewEngine(ctx, temp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dirEngine.Close(ctx)
+
+	encryptedTemp, err := ioutil.TempDir("", "casengine-httpfs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(encryptedTemp)
+
+	encryptedEngine, err := dir.NewEncryptedEngine(ctx, encryptedTemp, fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", encryptedTemp), bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encryptedEngine.Close(ctx)
+
+	memoryEngine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memoryEngine.Close(ctx)
+
+	for _, testcase := range []struct {
+		name       string
+		engine     casengine.Engine
+		seekGetter bool
+	}{
+		{
+			name:       "ReadSeekGetter",
+			engine:     dirEngine,
+			seekGetter: true,
+		},
+		{
+			name:       "encrypted ReadSeekGetter",
+			engine:     encryptedEngine,
+			seekGetter: true,
+		},
+		{
+			name:   "plain Reader",
+			engine: memoryEngine,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, isSeekGetter := testcase.engine.(ReadSeekGetter)
+			assert.Equal(t, testcase.seekGetter, isSeekGetter)
+
+			_, err := testcase.engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := httptest.NewServer(New(ctx, testcase.engine))
+			defer server.Close()
+
+			request, err := http.NewRequest("GET", server.URL+"/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Range", "bytes=7-11")
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+			assert.Equal(t, "bytes 7-11/13", response.Header.Get("Content-Range"))
+
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "World", string(body))
+		})
+	}
+}
+
+// countingReader is a casengine.Reader which is not a Stater and
+// counts its Gets.
+type countingReader struct {
+	reader casengine.Reader
+	gets   int
+}
+
+func (reader *countingReader) Get(ctx context.Context, digest digest.Digest) (readCloser io.ReadCloser, err error) {
+	reader.gets++
+	return reader.reader.Get(ctx, digest)
+}
+
+func TestHandlerNotModified(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := &countingReader{reader: engine}
+	handler := New(ctx, reader)
+	path := "/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"
+	etag := `"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"`
+
+	for _, testcase := range []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+		read        bool
+	}{
+		{
+			name:        "matching",
+			ifNoneMatch: etag,
+			status:      http.StatusNotModified,
+		},
+		{
+			name:        "weak match in a list",
+			ifNoneMatch: `"other", W/` + etag,
+			status:      http.StatusNotModified,
+		},
+		{
+			name:        "wildcard",
+			ifNoneMatch: "*",
+			status:      http.StatusNotModified,
+		},
+		{
+			name:        "other",
+			ifNoneMatch: `"other"`,
+			status:      http.StatusOK,
+			read:        true,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			reader.gets = 0
+			request := httptest.NewRequest("GET", path, nil)
+			request.Header.Set("If-None-Match", testcase.ifNoneMatch)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testcase.status, recorder.Code)
+			assert.Equal(t, etag, recorder.Header().Get("ETag"))
+			assert.Equal(t, testcase.read, reader.gets > 0)
+		})
+	}
+
+	t.Run("missing with an Exister", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", nil)
+		request.Header.Set("If-None-Match", `"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`)
+		recorder := httptest.NewRecorder()
+		New(ctx, &existerReader{Reader: engine}).ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+// existerReader adds casengine.Exister to a casengine.Reader.
+type existerReader struct {
+	casengine.Reader
+}
+
+func (reader *existerReader) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	readCloser, err := reader.Get(ctx, digest)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	readCloser.Close()
+	return true, nil
+}
+
+// requestKey marks contexts derived from a request's context.
+type requestKey struct{}
+
+// contextReader records whether each engine call was made with a
+// context derived from the request.
+type contextReader struct {
+	casengine.Reader
+	calls []bool
+}
+
+func (reader *contextReader) Get(ctx context.Context, digest digest.Digest) (readCloser io.ReadCloser, err error) {
+	reader.calls = append(reader.calls, ctx.Value(requestKey{}) != nil)
+	return reader.Reader.Get(ctx, digest)
+}
+
+func (reader *contextReader) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	reader.calls = append(reader.calls, ctx.Value(requestKey{}) != nil)
+	return true, nil
+}
+
+func TestHandlerRequestContext(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"
+	for _, testcase := range []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{
+			name:   "GET",
+			status: http.StatusOK,
+		},
+		{
+			name:        "If-None-Match",
+			ifNoneMatch: `"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"`,
+			status:      http.StatusNotModified,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			reader := &contextReader{Reader: engine}
+			request := httptest.NewRequest("GET", path, nil)
+			request = request.WithContext(context.WithValue(request.Context(), requestKey{}, true))
+			if testcase.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", testcase.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+			New(ctx, reader).ServeHTTP(recorder, request)
+
+			assert.Equal(t, testcase.status, recorder.Code)
+			assert.NotEmpty(t, reader.calls)
+			for i, fromRequest := range reader.calls {
+				assert.True(t, fromRequest, "call %d", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+)
+
+// errContentLength is returned when an upload's body does not match
+// its Content-Length.
+var errContentLength = errors.New("request body does not match Content-Length")
+
+// put streams a PUT or POST request body into the engine's Put.
+// Uploads go to / (for the engine's default algorithm) or to
+// /{algorithm}.  If the request has a Content-Length, the body must
+// match it, and a mismatch fails the Put before the engine commits the
+// blob.  Successful uploads get a 201 Created response with the new
+// blob's path in Location, its digest in ETag (see casengine.ETag),
+// and the digest followed by a newline as the body.  Engines which do
+// not implement casengine.Writer get 405 Method Not Allowed.
+func (fileSystem *FileSystem) put(writer http.ResponseWriter, request *http.Request) {
+	engine, ok := fileSystem.reader.(casengine.Writer)
+	if !ok {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+request.URL.Path), "/")
+	if strings.Contains(name, "/") {
+		http.Error(writer, "404 page not found", http.StatusNotFound)
+		return
+	}
+	algorithm := digest.Algorithm(name)
+	if algorithm != "" && !algorithm.Available() {
+		http.Error(writer, fmt.Sprintf("400 Bad Request: unsupported algorithm %q", algorithm), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = request.Body
+	if request.ContentLength >= 0 {
+		body = &lengthReader{reader: body, length: request.ContentLength}
+	}
+
+	dig, err := engine.Put(request.Context(), algorithm, body)
+	if err != nil {
+		if errors.Is(err, errContentLength) {
+			http.Error(writer, fmt.Sprintf("400 Bad Request: %s", err), http.StatusBadRequest)
+			return
+		}
+		serveError(writer, err)
+		return
+	}
+
+	writer.Header().Set("Location", fmt.Sprintf("/%s/%s", dig.Algorithm(), dig.Encoded()))
+	writer.Header().Set("ETag", casengine.ETag(dig))
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(writer, dig)
+}
+
+// lengthReader returns an error wrapping errContentLength if reader
+// does not hold exactly length bytes.  net/http's server already stops
+// reading at the Content-Length, but a short body only surfaces there
+// as io.ErrUnexpectedEOF (a 500 instead of a 400), and handlers called
+// directly (e.g. with httptest.NewRequest) get no enforcement at all.
+// lengthReader fails the engine's read itself, so Put aborts before
+// the engine commits the blob in both cases.
+type lengthReader struct {
+	reader io.Reader
+	length int64
+	count  int64
+}
+
+// Read implements io.Reader.Read.
+func (reader *lengthReader) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+	reader.count += int64(n)
+	if reader.count > reader.length {
+		return n, fmt.Errorf("%w: read more than %d bytes", errContentLength, reader.length)
+	}
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && reader.count != reader.length {
+		return n, fmt.Errorf("%w: read %d of %d bytes", errContentLength, reader.count, reader.length)
+	}
+	return n, err
+}
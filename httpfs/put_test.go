@@ -0,0 +1,264 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func TestPut(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	server := httptest.NewServer(New(ctx, engine))
+	defer server.Close()
+
+	for _, testcase := range []struct {
+		method string
+		path   string
+		status int
+		digest string
+	}{
+		{
+			method: "POST",
+			path:   "/",
+			status: http.StatusCreated,
+			digest: "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		},
+		{
+			method: "PUT",
+			path:   "/sha512",
+			status: http.StatusCreated,
+			digest: "sha512:374d794a95cdcfd8b35993185fef9ba368f160d8daf432d08ba9f1ed1e5abe6cc69291e0fa2fe0006a52570ef18c19def4e617c33ce52ef0a6e5fbe318cb0387",
+		},
+		{
+			method: "POST",
+			path:   "/md5",
+			status: http.StatusBadRequest,
+		},
+		{
+			method: "PUT",
+			path:   "/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			status: http.StatusNotFound,
+		},
+	} {
+		t.Run(testcase.method+" "+testcase.path, func(t *testing.T) {
+			request, err := http.NewRequest(testcase.method, server.URL+testcase.path, strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			assert.Equal(t, testcase.status, response.StatusCode)
+			if testcase.status != http.StatusCreated {
+				return
+			}
+
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.digest+"\n", string(body))
+			assert.Equal(t, `"`+testcase.digest+`"`, response.Header.Get("ETag"))
+
+			location := response.Header.Get("Location")
+			assert.Equal(t, "/"+strings.Replace(testcase.digest, ":", "/", 1), location)
+
+			getResponse, err := http.Get(server.URL + location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer getResponse.Body.Close()
+
+			assert.Equal(t, http.StatusOK, getResponse.StatusCode)
+			content, err := ioutil.ReadAll(getResponse.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(content))
+		})
+	}
+}
+
+func TestPutContentLength(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	fileSystem := New(ctx, engine)
+
+	for _, testcase := range []struct {
+		name   string
+		length int64
+		status int
+	}{
+		{
+			name:   "matching",
+			length: 13,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "unknown",
+			length: -1,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "short body",
+			length: 20,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "long body",
+			length: 5,
+			status: http.StatusBadRequest,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", strings.NewReader("Hello, World!"))
+			request.ContentLength = testcase.length
+			recorder := httptest.NewRecorder()
+			fileSystem.ServeHTTP(recorder, request)
+			assert.Equal(t, testcase.status, recorder.Code)
+		})
+	}
+
+	count := 0
+	err = engine.Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestPutShortBody(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	server := httptest.NewServer(New(ctx, engine))
+	defer server.Close()
+
+	// net/http clients refuse to send short bodies, so write the
+	// request by hand.
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 20\r\n\r\nHello, World!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.(*net.TCPConn).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	_, err = engine.Get(ctx, digest.FromString("Hello, World!"))
+	assert.True(t, errors.Is(err, os.ErrNotExist), fmt.Sprint(err))
+}
+
+func TestPutReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	readOnly := struct{ casengine.Reader }{Reader: engine}
+	request := httptest.NewRequest("POST", "/", strings.NewReader("Hello, World!"))
+	recorder := httptest.NewRecorder()
+	New(ctx, readOnly).ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, "GET, HEAD", recorder.Header().Get("Allow"))
+}
+
+// contextWriter records the context passed to Put.
+type contextWriter struct {
+	casengine.Reader
+	ctx context.Context
+}
+
+// Put implements casengine.Writer.Put.
+func (writer *contextWriter) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	writer.ctx = ctx
+	return "", ctx.Err()
+}
+
+func TestPutRequestContext(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	writer := &contextWriter{Reader: engine}
+	requestContext, cancel := context.WithCancel(ctx)
+	cancel()
+	request := httptest.NewRequest("POST", "/", strings.NewReader("Hello, World!")).WithContext(requestContext)
+	recorder := httptest.NewRecorder()
+	New(ctx, writer).ServeHTTP(recorder, request)
+	assert.Equal(t, requestContext, writer.ctx)
+	assert.NotEqual(t, http.StatusCreated, recorder.Code)
+}
@@ -26,7 +26,8 @@ import (
 type Reader interface {
 
 	// Get returns a reader for retrieving a blob from the store.
-	// Returns os.ErrNotExist if the digest is not found.
+	// Returns an error matching os.ErrNotExist (see errors.Is) if the
+	// digest is not found.
 	//
 	// Implementations are *not* required to verify that the returned
 	// reader content matches the requested digest.  Callers that need
@@ -45,6 +46,24 @@ type Reader interface {
 	Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error)
 }
 
+// Exister represents a content-addressable storage engine which can
+// check for a blob without reading it.
+type Exister interface {
+
+	// Exists returns true if the blob for digest is in the store.  A
+	// missing blob is not an error.
+	Exists(ctx context.Context, digest digest.Digest) (exists bool, err error)
+}
+
+// Stater represents a content-addressable storage engine stater.
+type Stater interface {
+
+	// Stat returns the size of a blob in the store.  Returns an error
+	// matching os.ErrNotExist (see errors.Is) if the digest is not
+	// found.
+	Stat(ctx context.Context, digest digest.Digest) (size int64, err error)
+}
+
 // AlgorithmCallback templates an AlgorithmLister.Algorithms callback
 // used for processing algorithms.  AlgorithmLister.Algorithms for
 // more details.
@@ -0,0 +1,115 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// ErrDigestMismatch is returned when retrieved content does not match
+// the requested digest.
+var ErrDigestMismatch = errors.New("content does not match digest")
+
+// LayerReader retrieves a tar or gzipped-tar layer blob from reader
+// and returns a tar.Reader over its entries.  The blob is verified
+// against digest as it is read.  Reading past the end of a
+// mismatched blob returns an error wrapping ErrDigestMismatch.  The
+// tar format allows trailing padding which the tar.Reader may not
+// consume, so closer.Close reads any remaining content and returns
+// the same error if the blob does not match.  Callers must call
+// closer.Close when they are done with the tar.Reader.  Returns the
+// error from digest.Validate if digest is invalid or its algorithm is
+// not available.
+func LayerReader(ctx context.Context, reader Reader, digest digest.Digest) (tarReader *tar.Reader, closer io.Closer, err error) {
+	err = digest.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawReader, err := reader.Get(ctx, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifiedReader := &verifiedReadCloser{
+		reader:   rawReader,
+		digest:   digest,
+		verifier: digest.Verifier(),
+	}
+
+	bufferedReader := bufio.NewReader(verifiedReader)
+	magic, err := bufferedReader.Peek(2)
+	if err != nil && err != io.EOF {
+		verifiedReader.Close()
+		return nil, nil, err
+	}
+
+	var layerReader io.Reader = bufferedReader
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		layerReader, err = gzip.NewReader(bufferedReader)
+		if err != nil {
+			verifiedReader.Close()
+			return nil, nil, err
+		}
+	}
+
+	return tar.NewReader(layerReader), verifiedReader, nil
+}
+
+// verifiedReadCloser checks its content against digest as it is
+// read.
+type verifiedReadCloser struct {
+	reader   io.ReadCloser
+	digest   digest.Digest
+	verifier digest.Verifier
+	eof      bool
+}
+
+// Read implements io.Reader.Read.
+func (reader *verifiedReadCloser) Read(p []byte) (n int, err error) {
+	n, err = reader.reader.Read(p)
+	reader.verifier.Write(p[:n])
+	if err == io.EOF {
+		reader.eof = true
+		if !reader.verifier.Verified() {
+			return n, fmt.Errorf("%w: %s", ErrDigestMismatch, reader.digest)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer.Close.
+func (reader *verifiedReadCloser) Close() (err error) {
+	if !reader.eof {
+		_, err = io.Copy(ioutil.Discard, reader)
+	} else if !reader.verifier.Verified() {
+		err = fmt.Errorf("%w: %s", ErrDigestMismatch, reader.digest)
+	}
+
+	err2 := reader.reader.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
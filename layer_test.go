@@ -0,0 +1,151 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// mapReader is a Reader serving blobs from a map.
+type mapReader map[digest.Digest][]byte
+
+func (reader mapReader) Get(ctx context.Context, digest digest.Digest) (rawReader io.ReadCloser, err error) {
+	data, ok := reader[digest]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestLayerReader(t *testing.T) {
+	ctx := context.Background()
+	entries := map[string]string{
+		"hello":   "Hello, World!",
+		"goodbye": "Goodbye, World!",
+	}
+	names := []string{"goodbye", "hello"}
+
+	var tarBuffer bytes.Buffer
+	tarWriter := tar.NewWriter(&tarBuffer)
+	for _, name := range names {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(entries[name])),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tarWriter.Write([]byte(entries[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tarWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarBlob := tarBuffer.Bytes()
+
+	var gzipBuffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBuffer)
+	_, err = gzipWriter.Write(tarBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipBlob := gzipBuffer.Bytes()
+
+	corruptDigest := digest.FromString("not the layer")
+	reader := mapReader{
+		digest.FromBytes(tarBlob):  tarBlob,
+		digest.FromBytes(gzipBlob): gzipBlob,
+		corruptDigest:              gzipBlob,
+	}
+
+	for _, testcase := range []struct {
+		name   string
+		digest digest.Digest
+		err    error
+	}{
+		{
+			name:   "tar",
+			digest: digest.FromBytes(tarBlob),
+		},
+		{
+			name:   "gzip",
+			digest: digest.FromBytes(gzipBlob),
+		},
+		{
+			name:   "mismatch",
+			digest: corruptDigest,
+			err:    ErrDigestMismatch,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			tarReader, closer, err := LayerReader(ctx, reader, testcase.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found := []string{}
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := ioutil.ReadAll(tarReader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, entries[header.Name], string(data))
+				found = append(found, header.Name)
+			}
+			assert.Equal(t, names, found)
+
+			err = closer.Close()
+			if testcase.err == nil {
+				assert.Nil(t, err)
+			} else if !errors.Is(err, testcase.err) {
+				t.Fatalf("expected an error matching %s, got %v", testcase.err, err)
+			}
+		})
+	}
+
+	t.Run("unavailable algorithm", func(t *testing.T) {
+		unavailable := digest.Digest("md5:65a8e27d8879283831b664bd8b7f0ad4")
+		_, _, err := LayerReader(ctx, mapReader{unavailable: tarBlob}, unavailable)
+		assert.Equal(t, digest.ErrDigestUnsupported, err)
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory implements an in-memory CAS engine.  It is mostly
+// useful for testing and for small, ephemeral stores.
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+// Engine is a CAS engine which stores blobs in memory.
+type Engine struct {
+	mutex sync.RWMutex
+	blobs map[digest.Digest][]byte
+
+	// Algorithm selects the Algorithm used for Put.
+	Algorithm digest.Algorithm
+}
+
+// NewEngine creates a new, empty CAS-engine instance.
+func NewEngine(ctx context.Context) (engine casengine.DigestListerEngine, err error) {
+	return &Engine{
+		blobs:     map[digest.Digest][]byte{},
+		Algorithm: digest.SHA256,
+	}, nil
+}
+
+// New creates a new, empty CAS-engine instance from a configuration
+// object, for the protocol registry.  The baseURI is ignored.  The
+// config may be nil, a map[string]string, or a
+// map[string]interface{} with string values.  The optional
+// 'algorithm' property sets Algorithm, which otherwise defaults to
+// sha256.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	var algorithmString string
+	switch configMap := config.(type) {
+	case nil:
+	case map[string]string:
+		algorithmString = configMap["algorithm"]
+	case map[string]interface{}:
+		value, ok := configMap["algorithm"]
+		if ok {
+			algorithmString, ok = value.(string)
+			if !ok {
+				return nil, fmt.Errorf("memory config 'algorithm' is not a string: %v", value)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("memory config is not a map[string]string: %v", config)
+	}
+
+	eng, err := NewEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithmString != "" {
+		algorithm := digest.Algorithm(algorithmString)
+		if !algorithm.Available() {
+			return nil, fmt.Errorf("memory config 'algorithm' %q is not available", algorithmString)
+		}
+		eng.(*Engine).Algorithm = algorithm
+	}
+
+	return eng, nil
+}
+
+// Get implements Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if engine.blobs == nil {
+		return nil, fmt.Errorf("engine is closed")
+	}
+
+	data, ok := engine.blobs[digest]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if engine.blobs == nil {
+		return -1, fmt.Errorf("engine is closed")
+	}
+
+	data, ok := engine.blobs[digest]
+	if !ok {
+		return -1, os.ErrNotExist
+	}
+
+	return int64(len(data)), nil
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.  Only algorithms
+// with stored digests are listed.
+func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	engine.mutex.RLock()
+	present := map[digest.Algorithm]bool{}
+	for digest := range engine.blobs {
+		present[digest.Algorithm()] = true
+	}
+	engine.mutex.RUnlock()
+
+	algorithms := make([]string, 0, len(present))
+	for algorithm := range present {
+		algorithms = append(algorithms, algorithm.String())
+	}
+	sort.Strings(algorithms)
+
+	offset := 0
+	count := 0
+	for _, algorithm := range algorithms {
+		if prefix == "" || strings.HasPrefix(algorithm, prefix) {
+			if offset >= from {
+				err = callback(ctx, digest.Algorithm(algorithm))
+				if err != nil {
+					return err
+				}
+				count++
+				if size != -1 && count >= size {
+					return nil
+				}
+			}
+			offset++
+		}
+	}
+	return nil
+}
+
+// Digests implements DigestLister.Digests.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	engine.mutex.RLock()
+	digests := make([]string, 0, len(engine.blobs))
+	for digest := range engine.blobs {
+		digests = append(digests, digest.String())
+	}
+	engine.mutex.RUnlock()
+	sort.Strings(digests)
+
+	offset := 0
+	count := 0
+	for _, digestString := range digests {
+		dig := digest.Digest(digestString)
+		if algorithm.String() == "" || dig.Algorithm() == algorithm {
+			if prefix == "" || strings.HasPrefix(dig.Encoded(), prefix) {
+				if offset >= from {
+					err = callback(ctx, dig)
+					if err != nil {
+						return err
+					}
+					count++
+					if size != -1 && count >= size {
+						return nil
+					}
+				}
+				offset++
+			}
+		}
+	}
+	return nil
+}
+
+// Put implements Writer.Put.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	if algorithm.String() == "" {
+		algorithm = engine.Algorithm
+	}
+	if !algorithm.Available() {
+		return "", digest.ErrDigestUnsupported
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	dig = algorithm.FromBytes(data)
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.blobs == nil {
+		return "", fmt.Errorf("engine is closed")
+	}
+
+	engine.blobs[dig] = data
+	return dig, nil
+}
+
+// Delete implements Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.blobs == nil {
+		return fmt.Errorf("engine is closed")
+	}
+
+	delete(engine.blobs, digest)
+	return nil
+}
+
+// Close implements Closer.Close.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	engine.blobs = nil
+	return nil
+}
+
+func init() {
+	read.Register("oci-cas-memory-v1", read.ReadWrite, New)
+}
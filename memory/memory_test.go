@@ -0,0 +1,182 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"github.com/xiekeyang/oci-discovery/tools/engine"
+	"golang.org/x/net/context"
+)
+
+func TestRegistration(t *testing.T) {
+	ctx := context.Background()
+
+	var reference engine.Reference
+	err := json.Unmarshal([]byte(`{"config": {"protocol": "oci-cas-memory-v1", "algorithm": "sha512"}}`), &reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constructor, err := read.Lookup(reference.Config.Protocol, read.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng, err := constructor.New(ctx, reference.URI, reference.Config.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close(ctx)
+
+	dig, err := eng.(casengine.Engine).Put(ctx, "", strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, digest.SHA512, dig.Algorithm())
+
+	reader, err := eng.Get(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello, World!", string(content))
+
+	t.Run("no config", func(t *testing.T) {
+		eng, err := New(ctx, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer eng.Close(ctx)
+		assert.Equal(t, digest.SHA256, eng.(*Engine).Algorithm)
+	})
+
+	t.Run("bad algorithm", func(t *testing.T) {
+		_, err := New(ctx, nil, map[string]string{"algorithm": "md5"})
+		assert.Error(t, err)
+	})
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, testcase := range []struct {
+		algorithm digest.Algorithm
+		body      string
+	}{
+		{
+			algorithm: "",
+			body:      "Hello, World!",
+		},
+		{
+			algorithm: "",
+			body:      "",
+		},
+		{
+			algorithm: digest.SHA512,
+			body:      "Hello, World!",
+		},
+	} {
+		_, err := engine.Put(ctx, testcase.algorithm, strings.NewReader(testcase.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		reader, err := engine.Get(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		bodyOut, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "Hello, World!", string(bodyOut))
+	})
+
+	t.Run("algorithms", func(t *testing.T) {
+		algorithms := []string{}
+		err := engine.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+			algorithms = append(algorithms, algorithm.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"sha256", "sha512"}, algorithms)
+	})
+
+	t.Run("digests", func(t *testing.T) {
+		digests := []string{}
+		err := engine.Digests(ctx, digest.SHA256, "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+			digests = append(digests, digest.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(
+			t,
+			[]string{
+				"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+				"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+			digests,
+		)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		digest := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+		err := engine.Delete(ctx, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = engine.Get(ctx, digest)
+		assert.Equal(t, os.ErrNotExist, err)
+
+		err = engine.Delete(ctx, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrInvalidDigest is returned by NormalizeDigest for digests which
+// are malformed or violate its CasePolicy.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// CasePolicy selects how NormalizeDigest handles uppercase characters.
+type CasePolicy int
+
+const (
+	// CaseUnchecked returns digests unchanged, without validation.
+	CaseUnchecked CasePolicy = iota
+
+	// CaseFold lowercases the algorithm and, for registered
+	// algorithms with hex encodings, the encoded portion.  The
+	// encoded portion of unregistered algorithms is left alone,
+	// because their encodings (e.g. base64) may be case-sensitive.
+	CaseFold
+
+	// CaseReject returns an error wrapping ErrInvalidDigest for
+	// digests which CaseFold would change.
+	CaseReject
+)
+
+// algorithmPattern and encodedPattern are the digest grammar from the
+// OCI image specification.
+// https://github.com/opencontainers/image-spec/blob/v1.0.0/descriptor.md#digests
+var (
+	algorithmPattern = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*$`)
+	encodedPattern   = regexp.MustCompile(`^[a-zA-Z0-9=_-]+$`)
+)
+
+// NormalizeDigest returns the canonical form of dig, so that digests
+// like SHA256:ABC... and sha256:abc... never map to different paths
+// or URIs.  Unless policy is CaseUnchecked, the encoded portion is
+// validated for the algorithm: registered algorithms (see
+// digest.Algorithm.Available) require lowercase hex of the
+// algorithm's length, and other algorithms require the OCI digest
+// grammar.  Errors wrap ErrInvalidDigest.
+func NormalizeDigest(dig digest.Digest, policy CasePolicy) (normalized digest.Digest, err error) {
+	if policy == CaseUnchecked {
+		return dig, nil
+	}
+
+	i := strings.Index(string(dig), ":")
+	if i <= 0 || i == len(dig)-1 {
+		return "", fmt.Errorf("%w: %q is not <algorithm>:<encoded>", ErrInvalidDigest, dig)
+	}
+	algorithm := digest.Algorithm(strings.ToLower(string(dig[:i])))
+	encoded := string(dig[i+1:])
+	if algorithm.Available() {
+		encoded = strings.ToLower(encoded)
+	}
+
+	normalized = digest.NewDigestFromEncoded(algorithm, encoded)
+	if policy == CaseReject && normalized != dig {
+		return "", fmt.Errorf("%w: %q is not lowercase (expected %q)", ErrInvalidDigest, dig, normalized)
+	}
+
+	if algorithm.Available() {
+		err = algorithm.Validate(encoded)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q: %s", ErrInvalidDigest, dig, err)
+		}
+	} else if !algorithmPattern.MatchString(string(algorithm)) {
+		return "", fmt.Errorf("%w: %q has an invalid algorithm", ErrInvalidDigest, dig)
+	} else if !encodedPattern.MatchString(encoded) {
+		return "", fmt.Errorf("%w: %q has an invalid encoded portion", ErrInvalidDigest, dig)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDigest(t *testing.T) {
+	hello := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	upperHello := digest.Digest("SHA256:DFFD6021BB2BD5B0AF676290809EC3A53191DD81C7F70A4B28688A362182986F")
+
+	for _, testcase := range []struct {
+		digest   digest.Digest
+		policy   CasePolicy
+		expected digest.Digest
+	}{
+		{
+			digest:   hello,
+			policy:   CaseFold,
+			expected: hello,
+		},
+		{
+			digest:   upperHello,
+			policy:   CaseFold,
+			expected: hello,
+		},
+		{
+			digest:   "Sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			policy:   CaseFold,
+			expected: hello,
+		},
+		{
+			digest:   hello,
+			policy:   CaseReject,
+			expected: hello,
+		},
+		{
+			digest: upperHello,
+			policy: CaseReject,
+		},
+		{
+			digest:   upperHello,
+			policy:   CaseUnchecked,
+			expected: upperHello,
+		},
+		{
+			digest:   "MultiHash+Base58:QmRZxt2b1FVZPNqd8hsiykDL3TdBDeTSPX9Kv46HmX4Gx8",
+			policy:   CaseFold,
+			expected: "multihash+base58:QmRZxt2b1FVZPNqd8hsiykDL3TdBDeTSPX9Kv46HmX4Gx8",
+		},
+		{
+			digest: "sha256:dffd",
+			policy: CaseFold,
+		},
+		{
+			digest: "sha256:xyzd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			policy: CaseFold,
+		},
+		{
+			digest: "foo:a/b",
+			policy: CaseFold,
+		},
+		{
+			digest: "foo!:abc",
+			policy: CaseFold,
+		},
+		{
+			digest: "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+			policy: CaseFold,
+		},
+	} {
+		t.Run(string(testcase.digest), func(t *testing.T) {
+			normalized, err := NormalizeDigest(testcase.digest, testcase.policy)
+			if testcase.expected == "" {
+				if !errors.Is(err, ErrInvalidDigest) {
+					t.Fatalf("expected an error matching %s, got %v", ErrInvalidDigest, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, normalized)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"golang.org/x/net/context"
+)
+
+// DigestListerEngine is a pack engine which can list the digests it
+// contains.
+type DigestListerEngine struct {
+	*Engine
+
+	lister casengine.DigestLister
+}
+
+// NewDigestListerEngine creates a new CAS-engine instance that can
+// list the digests it contains.  Arguments are the same as for
+// dir.NewDigestListerEngine, which is used for standalone blobs.
+func NewDigestListerEngine(ctx context.Context, path string, uri string, getDigest dir.GetDigest) (engine casengine.DigestListerEngine, err error) {
+	large, err := dir.NewDigestListerEngine(ctx, path, uri, getDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	eng, err := newEngine(path, large.(*dir.DigestListerEngine).Engine)
+	if err != nil {
+		large.Close(ctx)
+		return nil, err
+	}
+
+	return &DigestListerEngine{
+		Engine: eng,
+		lister: large,
+	}, nil
+}
+
+// Digests implements DigestLister.Digests.  Packed digests come from
+// the in-memory index, so only standalone blobs are enumerated by
+// walking the filesystem.  Results are sorted by digest string.
+func (engine *DigestListerEngine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	matches := map[digest.Digest]bool{}
+	engine.mutex.RLock()
+	closed := engine.closed
+	for dig := range engine.index {
+		if (algorithm == "" || dig.Algorithm() == algorithm) && strings.HasPrefix(dig.Encoded(), prefix) {
+			matches[dig] = true
+		}
+	}
+	engine.mutex.RUnlock()
+	if closed {
+		return dir.ErrClosed
+	}
+
+	err = engine.lister.Digests(ctx, algorithm, prefix, -1, 0, func(ctx context.Context, dig digest.Digest) (err error) {
+		matches[dig] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]digest.Digest, 0, len(matches))
+	for dig := range matches {
+		sorted = append(sorted, dig)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(sorted); i++ {
+		err = callback(ctx, sorted[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
+	}
+	return nil
+}
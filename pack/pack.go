@@ -0,0 +1,472 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pack implements a CAS engine which stores small blobs in
+// append-only packfiles, to save inodes and speed up enumeration for
+// stores with many tiny blobs.  Larger blobs are stored as standalone
+// files by a wrapped dir engine.  DigestListerEngine lists packed
+// digests from the in-memory index, so only standalone blobs are
+// enumerated by walking the filesystem.
+//
+// Packfiles and their index live in a packs directory under the
+// store's root path.  The index is an append-only text file with one
+// "put <digest> <packfile> <offset> <length>" or "delete <digest>"
+// record per line, which is replayed when the engine is created.
+// Deleting a packed blob only removes it from the index; the space it
+// occupied in its packfile is not reclaimed.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"golang.org/x/net/context"
+)
+
+// DefaultSmallBlobSize is the default Engine.SmallBlobSize.
+const DefaultSmallBlobSize = 4 * 1024
+
+// DefaultPackSize is the default Engine.PackSize.
+const DefaultPackSize = 64 * 1024 * 1024
+
+// indexName is the name of the index file in the packs directory.
+const indexName = "index"
+
+// location is where a packed blob is stored.
+type location struct {
+	pack   string
+	offset int64
+	length int64
+}
+
+// Engine is a CAS engine which stores small blobs in packfiles.
+type Engine struct {
+	path  string
+	large *dir.Engine
+
+	mutex     sync.RWMutex
+	closed    bool
+	index     map[digest.Digest]*location
+	indexFile *os.File
+	packs     int
+	current   *os.File
+	size      int64
+
+	// SmallBlobSize is the size in bytes of the largest blob which is
+	// stored in a packfile.  Larger blobs are stored as standalone
+	// files.
+	SmallBlobSize int64
+
+	// PackSize is the size in bytes after which a packfile is
+	// considered full, and new blobs are appended to a new packfile.
+	PackSize int64
+}
+
+// NewEngine creates a new CAS-engine instance.  The path and uri
+// arguments are the same as for dir.NewEngine, which is used for
+// standalone blobs.  Packfiles are stored in path/packs.
+func NewEngine(ctx context.Context, path string, uri string) (engine casengine.Engine, err error) {
+	large, err := dir.NewEngine(ctx, path, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	eng, err := newEngine(path, large.(*dir.Engine))
+	if err != nil {
+		large.Close(ctx)
+		return nil, err
+	}
+
+	return eng, nil
+}
+
+// newEngine creates a new CAS-engine instance which stores standalone
+// blobs in large.
+func newEngine(path string, large *dir.Engine) (engine *Engine, err error) {
+	packs := filepath.Join(path, "packs")
+	err = os.MkdirAll(packs, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	eng := &Engine{
+		path:          packs,
+		large:         large,
+		index:         map[digest.Digest]*location{},
+		SmallBlobSize: DefaultSmallBlobSize,
+		PackSize:      DefaultPackSize,
+	}
+
+	err = eng.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	eng.indexFile, err = os.OpenFile(filepath.Join(packs, indexName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return eng, nil
+}
+
+// Get implements Reader.Get.  Packed blobs are read with a ranged
+// read from their packfile.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if engine.closed {
+		return nil, dir.ErrClosed
+	}
+
+	loc, ok := engine.index[digest]
+	if !ok {
+		return engine.large.Get(ctx, digest)
+	}
+
+	file, err := os.Open(filepath.Join(engine.path, loc.pack))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sectionReadCloser{
+		SectionReader: io.NewSectionReader(file, loc.offset, loc.length),
+		file:          file,
+	}, nil
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if engine.closed {
+		return -1, dir.ErrClosed
+	}
+
+	loc, ok := engine.index[digest]
+	if !ok {
+		return engine.large.Stat(ctx, digest)
+	}
+
+	return loc.length, nil
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.
+func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	algorithms := map[digest.Algorithm]bool{}
+	engine.mutex.RLock()
+	for dig := range engine.index {
+		algorithms[dig.Algorithm()] = true
+	}
+	engine.mutex.RUnlock()
+
+	err = engine.large.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+		algorithms[algorithm] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := []digest.Algorithm{}
+	for algorithm := range algorithms {
+		if strings.HasPrefix(algorithm.String(), prefix) {
+			sorted = append(sorted, algorithm)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(sorted); i++ {
+		err = callback(ctx, sorted[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Put implements Writer.Put.  Blobs no larger than SmallBlobSize are
+// appended to a packfile.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	if algorithm.String() == "" {
+		algorithm = engine.large.Algorithm
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, engine.SmallBlobSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if int64(len(data)) > engine.SmallBlobSize {
+		return engine.large.Put(ctx, algorithm, io.MultiReader(bytes.NewReader(data), reader))
+	}
+
+	dig = algorithm.FromBytes(data)
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.closed {
+		return "", dir.ErrClosed
+	}
+
+	_, ok := engine.index[dig]
+	if ok {
+		return dig, nil
+	}
+
+	err = engine.rotate(int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	loc := &location{
+		pack:   filepath.Base(engine.current.Name()),
+		offset: engine.size,
+		length: int64(len(data)),
+	}
+
+	n, err := engine.current.Write(data)
+	engine.size += int64(n)
+	if err != nil {
+		return "", err
+	}
+
+	// The index record must not outlive the data it points at.
+	err = engine.current.Sync()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fmt.Fprintf(engine.indexFile, "put %s %s %d %d\n", dig, loc.pack, loc.offset, loc.length)
+	if err != nil {
+		return "", err
+	}
+
+	logrus.Debugf("packed %s into %s at %d", dig, loc.pack, loc.offset)
+	engine.index[dig] = loc
+	return dig, nil
+}
+
+// Delete implements Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	engine.mutex.Lock()
+	if engine.closed {
+		engine.mutex.Unlock()
+		return dir.ErrClosed
+	}
+
+	_, ok := engine.index[digest]
+	if ok {
+		_, err = fmt.Fprintf(engine.indexFile, "delete %s\n", digest)
+		if err != nil {
+			engine.mutex.Unlock()
+			return err
+		}
+		delete(engine.index, digest)
+	}
+	engine.mutex.Unlock()
+
+	return engine.large.Delete(ctx, digest)
+}
+
+// Close releases resources held by the engine.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if engine.closed {
+		return dir.ErrClosed
+	}
+	engine.closed = true
+
+	if engine.current != nil {
+		err = engine.current.Close()
+	}
+
+	err2 := engine.indexFile.Close()
+	if err == nil {
+		err = err2
+	}
+
+	err2 = engine.large.Close(ctx)
+	if err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+// rotate makes sure there is a current packfile with room for length
+// more bytes, starting a new packfile if necessary.  The caller must
+// hold the write lock.
+func (engine *Engine) rotate(length int64) (err error) {
+	if engine.current != nil {
+		if engine.size == 0 || engine.size+length <= engine.PackSize {
+			return nil
+		}
+
+		err = engine.current.Close()
+		engine.current = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	// Packfiles from interrupted Puts may be missing from the index,
+	// so skip over any names which are already taken.
+	var file *os.File
+	for {
+		engine.packs++
+		name := filepath.Join(engine.path, fmt.Sprintf("pack-%d", engine.packs))
+		file, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+
+	// Persist the new packfile's name before the index refers to it.
+	err = syncDir(engine.path)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	engine.current = file
+	engine.size = 0
+	return nil
+}
+
+// syncDir flushes the directory entries in path to stable storage.
+func syncDir(path string) (err error) {
+	directory, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = directory.Sync()
+	err2 := directory.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// loadIndex replays the index file.
+func (engine *Engine) loadIndex() (err error) {
+	file, err := os.Open(filepath.Join(engine.path, indexName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		err = engine.loadRecord(strings.Fields(scanner.Text()))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", file.Name(), line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// loadRecord applies a single index record.
+func (engine *Engine) loadRecord(fields []string) (err error) {
+	if len(fields) == 2 && fields[0] == "delete" {
+		delete(engine.index, digest.Digest(fields[1]))
+		return nil
+	}
+
+	if len(fields) != 5 || fields[0] != "put" {
+		return fmt.Errorf("invalid record %q", strings.Join(fields, " "))
+	}
+
+	dig, err := digest.Parse(fields[1])
+	if err != nil {
+		return err
+	}
+
+	var pack int
+	_, err = fmt.Sscanf(fields[2], "pack-%d", &pack)
+	if err != nil {
+		return fmt.Errorf("invalid packfile name %q", fields[2])
+	}
+	if pack > engine.packs {
+		engine.packs = pack
+	}
+
+	offset, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	length, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	engine.index[dig] = &location{
+		pack:   fields[2],
+		offset: offset,
+		length: length,
+	}
+	return nil
+}
+
+// sectionReadCloser reads a section of a packfile.
+type sectionReadCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+// Close implements io.Closer.Close.
+func (reader *sectionReadCloser) Close() (err error) {
+	return reader.file.Close()
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"golang.org/x/net/context"
+)
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-pack-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	uri := fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	engine, err := NewEngine(ctx, temp, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.(*Engine).PackSize = 1024
+
+	blobs := map[digest.Digest][]byte{}
+	for i := 0; i < 100; i++ {
+		data := []byte(fmt.Sprintf("small blob %d", i))
+		dig, err := engine.Put(ctx, "", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[dig] = data
+	}
+
+	large := bytes.Repeat([]byte("large blob "), DefaultSmallBlobSize)
+	largeDigest, err := engine.Put(ctx, "", bytes.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs[largeDigest] = large
+
+	check := func(t *testing.T, engine casengine.Engine) {
+		for dig, data := range blobs {
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, data, content)
+
+			size, err := engine.(*Engine).Stat(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(len(data)), size)
+		}
+	}
+
+	t.Run("packed", func(t *testing.T) {
+		check(t, engine)
+
+		packs, err := filepath.Glob(filepath.Join(temp, "packs", "pack-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, len(packs) > 1, "expected several packfiles, got %v", packs)
+
+		standalone, err := filepath.Glob(filepath.Join(temp, "blobs", "*", "*", "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{filepath.Join(temp, "blobs", "sha256", largeDigest.Encoded()[:2], largeDigest.Encoded())}, standalone)
+	})
+
+	t.Run("algorithms", func(t *testing.T) {
+		algorithms := []digest.Algorithm{}
+		err := engine.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+			algorithms = append(algorithms, algorithm)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, algorithms, digest.SHA256)
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		err := engine.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err = NewEngine(ctx, temp, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, engine)
+
+		dig, err := engine.Put(ctx, "", bytes.NewReader([]byte("after reopen")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[dig] = []byte("after reopen")
+		check(t, engine)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		dig := digest.FromString("small blob 0")
+		err := engine.Delete(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delete(blobs, dig)
+
+		err = engine.Delete(ctx, largeDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delete(blobs, largeDigest)
+
+		for _, deleted := range []digest.Digest{dig, largeDigest} {
+			_, err = engine.Get(ctx, deleted)
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+		}
+
+		err = engine.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err = NewEngine(ctx, temp, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+
+		_, err = engine.Get(ctx, dig)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s after reopening, got %v", os.ErrNotExist, err)
+		}
+		check(t, engine)
+	})
+}
+
+func TestDigestListerEngine(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-pack-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	template := fmt.Sprintf("%s/blobs/{algorithm}/{encoded:2}/{encoded}", temp)
+	re, err := dir.TemplateRegexp(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewDigestListerEngine(ctx, temp, "file://"+template, (&dir.RegexpGetDigest{Regexp: re}).GetDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	expected := []digest.Digest{}
+	for _, data := range [][]byte{
+		[]byte("small blob 0"),
+		[]byte("small blob 1"),
+		bytes.Repeat([]byte("large blob "), DefaultSmallBlobSize),
+	} {
+		dig, err := engine.Put(ctx, "", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, dig)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i] < expected[j]
+	})
+
+	for _, testcase := range []struct {
+		name      string
+		algorithm digest.Algorithm
+		prefix    string
+		size      int
+		from      int
+		expected  []digest.Digest
+	}{
+		{name: "all", size: -1, expected: expected},
+		{name: "sha256", algorithm: digest.SHA256, size: -1, expected: expected},
+		{name: "sha512", algorithm: digest.SHA512, size: -1, expected: []digest.Digest{}},
+		{name: "prefix", algorithm: digest.SHA256, prefix: expected[1].Encoded(), size: -1, expected: expected[1:2]},
+		{name: "page", size: 1, from: 1, expected: expected[1:2]},
+		{name: "past the end", size: -1, from: 10, expected: []digest.Digest{}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			digests := []digest.Digest{}
+			err := engine.Digests(ctx, testcase.algorithm, testcase.prefix, testcase.size, testcase.from, func(ctx context.Context, dig digest.Digest) (err error) {
+				digests = append(digests, dig)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, digests)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package blob implements a read-only pseudo-engine serving a single
+// blob, e.g. content piped to the command line, under its own
+// computed digest.  This allows verifying ad-hoc content without
+// configuring a store.
+package blob
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/context"
+)
+
+// Engine implements casengine.ReadCloser and casengine.Stater for a
+// single in-memory blob.
+type Engine struct {
+	digest digest.Digest
+	data   []byte
+}
+
+// New creates a new pseudo-engine serving the content of reader, which
+// is read into memory.  The content is addressed by its algorithm
+// digest, or by its sha256 digest if algorithm is empty.
+func New(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (engine *Engine, err error) {
+	if algorithm.String() == "" {
+		algorithm = digest.SHA256
+	}
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("algorithm %q is not available", algorithm)
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		digest: algorithm.FromBytes(data),
+		data:   data,
+	}, nil
+}
+
+// Digest returns the digest of the served blob.
+func (engine *Engine) Digest() (dig digest.Digest) {
+	return engine.digest
+}
+
+// Get implements Reader.Get.  Returns an error matching
+// os.ErrNotExist for any digest but the blob's own.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	if digest != engine.digest {
+		return nil, fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(engine.data)), nil
+}
+
+// Stat implements Stater.Stat.
+func (engine *Engine) Stat(ctx context.Context, digest digest.Digest) (size int64, err error) {
+	if digest != engine.digest {
+		return -1, fmt.Errorf("%s: %w", digest, os.ErrNotExist)
+	}
+
+	return int64(len(engine.data)), nil
+}
+
+// Close implements Closer.Close.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+
+	for _, testcase := range []struct {
+		algorithm digest.Algorithm
+		expected  digest.Digest
+	}{
+		{
+			expected: digest.SHA256.FromString("Hello, World!"),
+		},
+		{
+			algorithm: digest.SHA512,
+			expected:  digest.SHA512.FromString("Hello, World!"),
+		},
+	} {
+		t.Run(string(testcase.expected), func(t *testing.T) {
+			engine, err := New(ctx, testcase.algorithm, strings.NewReader("Hello, World!"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			assert.Equal(t, testcase.expected, engine.Digest())
+
+			reader, err := engine.Get(ctx, testcase.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(content))
+
+			size, err := engine.Stat(ctx, testcase.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(13), size)
+
+			other := digest.FromString("Goodbye, World!")
+			_, err = engine.Get(ctx, other)
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+
+			_, err = engine.Stat(ctx, other)
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+		})
+	}
+}
+
+func TestNewUnavailableAlgorithm(t *testing.T) {
+	_, err := New(context.Background(), "md5", strings.NewReader("Hello, World!"))
+	assert.EqualError(t, err, `algorithm "md5" is not available`)
+}
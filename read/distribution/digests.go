@@ -0,0 +1,198 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// manifestMediaTypes are accepted when resolving tags, so the
+// registry reports the digest of the manifest as pushed instead of
+// converting it.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Digests implements DigestLister.Digests.  Registries do not list
+// the blobs in a repository, so this lists the digests of the
+// repository's tagged manifests.  Tags are listed with the paginated
+// tags API, following Link headers, and each tag is resolved to a
+// digest with a manifest HEAD request.  Every tag is resolved before
+// the first callback.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	tags, err := engine.tags(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := map[digest.Digest]bool{}
+	digests := []digest.Digest{}
+	for _, tag := range tags {
+		dig, err := engine.resolve(ctx, tag)
+		if err != nil {
+			return err
+		}
+
+		if seen[dig] {
+			continue
+		}
+		seen[dig] = true
+
+		if algorithm.String() == "" || dig.Algorithm() == algorithm {
+			if prefix == "" || strings.HasPrefix(dig.Encoded(), prefix) {
+				digests = append(digests, dig)
+			}
+		}
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(digests); i++ {
+		err = callback(ctx, digests[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
+	}
+	return nil
+}
+
+// tags lists the repository's tags.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-tags
+func (engine *Engine) tags(ctx context.Context) (tags []string, err error) {
+	uri := engine.base.ResolveReference(&url.URL{
+		Path: fmt.Sprintf("/v2/%s/tags/list", engine.name),
+	})
+
+	for uri != nil {
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := engine.request(ctx, "GET", uri, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		if response.StatusCode == http.StatusOK {
+			err = json.NewDecoder(response.Body).Decode(&body)
+		} else {
+			err = fmt.Errorf("requested %s but got %s", uri, response.Status)
+		}
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, body.Tags...)
+
+		next, err := nextLink(response.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			uri = nil
+		} else {
+			uri = uri.ResolveReference(next)
+		}
+	}
+
+	return tags, nil
+}
+
+// resolve returns the digest of the manifest referenced by tag.
+func (engine *Engine) resolve(ctx context.Context, tag string) (dig digest.Digest, err error) {
+	uri := engine.base.ResolveReference(&url.URL{
+		Path: fmt.Sprintf("/v2/%s/manifests/%s", engine.name, tag),
+	})
+
+	response, err := engine.request(ctx, "HEAD", uri, http.Header{
+		"Accept": []string{strings.Join(manifestMediaTypes, ", ")},
+	})
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requested %s but got %s", uri, response.Status)
+	}
+
+	digestString := response.Header.Get("Docker-Content-Digest")
+	if digestString == "" {
+		return "", fmt.Errorf("%s did not return a Docker-Content-Digest header", uri)
+	}
+
+	logrus.Debugf("resolved %s to %s", tag, digestString)
+	return digest.Parse(digestString)
+}
+
+// nextLink returns the target of a rel="next" link from a Link
+// header like:
+//
+//	</v2/library/busybox/tags/list?n=2&last=b>; rel="next"
+//
+// or nil if there is no such link.
+// https://www.rfc-editor.org/rfc/rfc8288
+func nextLink(header string) (uri *url.URL, err error) {
+	for _, link := range strings.Split(header, ",") {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+
+		end := strings.Index(link, ">")
+		if !strings.HasPrefix(link, "<") || end < 0 {
+			return nil, fmt.Errorf("invalid Link header %q", header)
+		}
+
+		for _, parameter := range strings.Split(link[end+1:], ";") {
+			parameter = strings.TrimSpace(parameter)
+			if strings.ToLower(parameter) == `rel="next"` || strings.ToLower(parameter) == "rel=next" {
+				return url.Parse(link[1:end])
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distribution
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestNextLink(t *testing.T) {
+	for _, testcase := range []struct {
+		header   string
+		expected string
+	}{
+		{
+			header:   "",
+			expected: "",
+		},
+		{
+			header:   `</v2/a/tags/list?n=2&last=b>; rel="next"`,
+			expected: "/v2/a/tags/list?n=2&last=b",
+		},
+		{
+			header:   `</v2/a/tags/list?n=2>; rel="prev", </v2/a/tags/list?n=2&last=d>; rel=next`,
+			expected: "/v2/a/tags/list?n=2&last=d",
+		},
+	} {
+		t.Run(testcase.header, func(t *testing.T) {
+			uri, err := nextLink(testcase.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testcase.expected == "" {
+				assert.Nil(t, uri)
+				return
+			}
+			assert.Equal(t, testcase.expected, uri.String())
+		})
+	}
+}
+
+func TestDigests(t *testing.T) {
+	ctx := context.Background()
+
+	manifests := map[string]string{
+		"a": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"b": "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		"c": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/v2/library/hello/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/library/hello/tags/list?n=2&last=b>; rel="next"`)
+			fmt.Fprint(w, `{"name": "library/hello", "tags": ["a", "b"]}`)
+		case "b":
+			fmt.Fprint(w, `{"name": "library/hello", "tags": ["c"]}`)
+		default:
+			http.Error(w, "bad last", http.StatusBadRequest)
+		}
+	})
+
+	mux.HandleFunc("/v2/library/hello/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" || !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		dig, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/library/hello/manifests/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", dig)
+	})
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"name": "library/hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	lister, ok := engine.(casengine.DigestLister)
+	if !ok {
+		t.Fatalf("%T does not implement DigestLister", engine)
+	}
+
+	for _, testcase := range []struct {
+		prefix   string
+		expected []digest.Digest
+	}{
+		{
+			prefix: "",
+			expected: []digest.Digest{
+				"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+				"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+		},
+		{
+			prefix: "e",
+			expected: []digest.Digest{
+				"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("prefix %q", testcase.prefix), func(t *testing.T) {
+			digests := []digest.Digest{}
+			err := lister.Digests(ctx, "", testcase.prefix, -1, 0, func(ctx context.Context, dig digest.Digest) (err error) {
+				digests = append(digests, dig)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, digests)
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package distribution implements a read-only CAS engine for blobs
+// served by OCI registries under /v2/<name>/blobs/<digest>.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+//
+// This is not one of the CAS-engine protocols from oci-discovery, so
+// it is registered under the non-standard oci-distribution-v1
+// protocol identifier.
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+// Engine implements casengine.Reader for an OCI registry repository.
+type Engine struct {
+	base     *url.URL
+	name     string
+	username string
+	password string
+
+	mutex         sync.Mutex
+	authorization string
+
+	// Client allows callers to configure the HTTP client.  Get will use
+	// http.DefaultClient if Client is not set.  You can set this
+	// property with:
+	//
+	//   engine, err := New(ctx, base, config)
+	//   // handle err and possibly engine.Close(ctx)
+	//   engine.(*Engine).Client = yourCustomClient
+	Client *http.Client
+}
+
+// New creates a new CAS-engine instance.  The baseURI is the registry
+// root (e.g. https://registry.example.com).  The config must be a
+// map[string]string or a map[string]interface{} with string values.
+// The required 'name' property is the repository name
+// (e.g. library/busybox).  The optional 'username' and 'password'
+// properties are used when the registry challenges for credentials.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	if baseURI == nil {
+		return nil, fmt.Errorf("distribution engine requires a base registry URI")
+	}
+
+	configMap, ok := config.(map[string]string)
+	if !ok {
+		configMap2, ok := config.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("distribution config is not a map[string]string: %v", config)
+		}
+		configMap = make(map[string]string)
+		for key, value := range configMap2 {
+			configMap[key], ok = value.(string)
+			if !ok {
+				return nil, fmt.Errorf("distribution config %q is not a string: %v", key, value)
+			}
+		}
+	}
+
+	name, ok := configMap["name"]
+	if !ok {
+		return nil, fmt.Errorf("distribution config missing required 'name' property: %v", configMap)
+	}
+
+	return &Engine{
+		base:     baseURI,
+		name:     name,
+		username: configMap["username"],
+		password: configMap["password"],
+	}, nil
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	uri := engine.base.ResolveReference(&url.URL{
+		Path: fmt.Sprintf("/v2/%s/blobs/%s", engine.name, digest),
+	})
+
+	response, err := engine.request(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, fmt.Errorf("%s not found at %s: %w", digest, uri, os.ErrNotExist)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("requested %s but got %s", uri, response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// Close releases resources held by the engine.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	return nil
+}
+
+func (engine *Engine) client() *http.Client {
+	if engine.Client == nil {
+		return http.DefaultClient
+	}
+	return engine.Client
+}
+
+// request makes an HTTP request, authenticating and retrying once if
+// the registry challenges for credentials.
+func (engine *Engine) request(ctx context.Context, method string, uri *url.URL, header http.Header) (response *http.Response, err error) {
+	response, err = engine.do(ctx, method, uri, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		err = engine.authenticate(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err = engine.do(ctx, method, uri, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func (engine *Engine) do(ctx context.Context, method string, uri *url.URL, header http.Header) (response *http.Response, err error) {
+	request, err := http.NewRequest(method, uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	engine.mutex.Lock()
+	authorization := engine.authorization
+	engine.mutex.Unlock()
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	logrus.Debugf("requesting %s", request.URL)
+	return engine.client().Do(request)
+}
+
+// authenticate responds to a WWW-Authenticate challenge by setting
+// the Authorization header used for subsequent requests.
+func (engine *Engine) authenticate(ctx context.Context, challenge string) (err error) {
+	scheme, parameters, err := parseChallenge(challenge)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if engine.username == "" {
+			return fmt.Errorf("registry requested basic authentication, but no username is configured")
+		}
+		request := &http.Request{Header: http.Header{}}
+		request.SetBasicAuth(engine.username, engine.password)
+		engine.mutex.Lock()
+		engine.authorization = request.Header.Get("Authorization")
+		engine.mutex.Unlock()
+		return nil
+	case "bearer":
+		token, err := engine.getToken(ctx, parameters)
+		if err != nil {
+			return err
+		}
+		engine.mutex.Lock()
+		engine.authorization = "Bearer " + token
+		engine.mutex.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+}
+
+// getToken requests a bearer token from the realm given in a
+// challenge.
+// https://docs.docker.com/registry/spec/auth/token/
+func (engine *Engine) getToken(ctx context.Context, parameters map[string]string) (token string, err error) {
+	realm, ok := parameters["realm"]
+	if !ok {
+		return "", fmt.Errorf("bearer challenge missing required 'realm' parameter")
+	}
+
+	uri, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+
+	query := uri.Query()
+	for _, key := range []string{"service", "scope"} {
+		value, ok := parameters[key]
+		if ok {
+			query.Set(key, value)
+		}
+	}
+	uri.RawQuery = query.Encode()
+
+	request, err := http.NewRequest("GET", uri.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	request = request.WithContext(ctx)
+	if engine.username != "" {
+		request.SetBasicAuth(engine.username, engine.password)
+	}
+
+	logrus.Debugf("requesting token from %s", request.URL)
+	response, err := engine.client().Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requested token from %s but got %s", uri, response.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("token response from %s did not include a token", uri)
+}
+
+// parseChallenge parses a WWW-Authenticate challenge like:
+//
+//	Bearer realm="https://auth.example.com/token",service="registry.example.com"
+//
+// Only a single challenge is supported.
+func parseChallenge(challenge string) (scheme string, parameters map[string]string, err error) {
+	challenge = strings.TrimSpace(challenge)
+	if challenge == "" {
+		return "", nil, fmt.Errorf("missing WWW-Authenticate challenge")
+	}
+
+	index := strings.IndexAny(challenge, " \t")
+	if index < 0 {
+		return challenge, map[string]string{}, nil
+	}
+
+	scheme = challenge[:index]
+	remaining := challenge[index:]
+	parameters = map[string]string{}
+	for {
+		remaining = strings.TrimLeft(remaining, " \t,")
+		if remaining == "" {
+			return scheme, parameters, nil
+		}
+
+		index = strings.Index(remaining, "=")
+		if index < 0 {
+			return "", nil, fmt.Errorf("invalid WWW-Authenticate parameter in %q", challenge)
+		}
+		key := strings.ToLower(strings.TrimSpace(remaining[:index]))
+		remaining = remaining[index+1:]
+
+		var value string
+		if strings.HasPrefix(remaining, `"`) {
+			var builder strings.Builder
+			i := 1
+			for ; i < len(remaining); i++ {
+				if remaining[i] == '\\' && i+1 < len(remaining) {
+					i++
+					builder.WriteByte(remaining[i])
+					continue
+				}
+				if remaining[i] == '"' {
+					break
+				}
+				builder.WriteByte(remaining[i])
+			}
+			if i >= len(remaining) {
+				return "", nil, fmt.Errorf("unterminated quoted string in %q", challenge)
+			}
+			value = builder.String()
+			remaining = remaining[i+1:]
+		} else {
+			index = strings.Index(remaining, ",")
+			if index < 0 {
+				index = len(remaining)
+			}
+			value = strings.TrimSpace(remaining[:index])
+			remaining = remaining[index:]
+		}
+		parameters[key] = value
+	}
+}
+
+func init() {
+	read.Register("oci-distribution-v1", read.ReadOnly, New)
+}
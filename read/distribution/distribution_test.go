@@ -0,0 +1,129 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+func TestRegistration(t *testing.T) {
+	constructor, ok := read.Constructors["oci-distribution-v1"]
+	if !ok {
+		t.Fatalf("failed to register oci-distribution-v1")
+	}
+	assert.Equal(t, read.ReadOnly, constructor.Capability)
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, parameters, err := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(
+		t,
+		map[string]string{
+			"realm":   "https://auth.example.com/token",
+			"service": "registry.example.com",
+			"scope":   "repository:a/b:pull",
+		},
+		parameters,
+	)
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	bodyIn := "Hello, World!"
+	tokenRequests := 0
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if r.URL.Query().Get("scope") != "repository:library/hello:pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token": "abc"}`)
+	})
+
+	mux.HandleFunc("/v2/library/hello/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set(
+				"WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:library/hello:pull"`, server.URL),
+			)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/library/hello/blobs/sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, bodyIn)
+	})
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]interface{}{
+		"name": "library/hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	t.Run("good", func(t *testing.T) {
+		reader, err := engine.Get(ctx, digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		bodyOut, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, bodyIn, string(bodyOut))
+		assert.Equal(t, 1, tokenRequests)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := engine.Get(ctx, digest.Digest("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+		assert.Equal(t, 1, tokenRequests)
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dockersave implements a read-only CAS engine for the image
+// tarballs written by 'docker save'.
+//
+// Both tarball layouts are supported.  Legacy tarballs store each
+// image's config at <hex>.json and its layers at <id>/layer.tar, and
+// those blobs are indexed by hashing their content.  OCI-style
+// tarballs (Docker 25 and later) store blobs at
+// blobs/<algorithm>/<encoded>, and those blobs are indexed by path,
+// along with any manifests listed in index.json.  In both cases
+// layers are served as stored in the tarball, which is usually
+// uncompressed, so layer digests are DiffIDs rather than the
+// compressed digests used by registries.
+package dockersave
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/omeid/go-tarfs"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// manifestEntry is an entry in a 'docker save' manifest.json.
+type manifestEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Engine implements casengine.ReadCloser and casengine.DigestLister
+// for a 'docker save' tarball.
+type Engine struct {
+	fileSystem http.FileSystem
+
+	// paths maps indexed digests to their paths in the tarball.
+	paths map[digest.Digest]string
+}
+
+// NewEngine creates a new CAS-engine instance.  The path argument is
+// the tarball written by 'docker save'.  The tarball is read into
+// memory and indexed by NewEngine.
+func NewEngine(ctx context.Context, path string) (engine casengine.ReadCloser, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return New(ctx, file)
+}
+
+// New is like NewEngine, but it reads the tarball from reader.
+func New(ctx context.Context, reader io.Reader) (engine casengine.ReadCloser, err error) {
+	fileSystem, err := tarfs.New(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	eng := &Engine{
+		fileSystem: fileSystem,
+		paths:      map[digest.Digest]string{},
+	}
+
+	var manifest []manifestEntry
+	err = eng.readJSON("manifest.json", &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range manifest {
+		for _, blobPath := range append([]string{entry.Config}, entry.Layers...) {
+			err = eng.index(blobPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var index ocispec.Index
+	err = eng.readJSON("index.json", &index)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, descriptor := range index.Manifests {
+		err = eng.index(path.Join("blobs", descriptor.Digest.Algorithm().String(), descriptor.Digest.Encoded()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return eng, nil
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	blobPath, ok := engine.paths[digest]
+	if !ok {
+		return nil, fmt.Errorf("%s not found: %w", digest, os.ErrNotExist)
+	}
+
+	return engine.fileSystem.Open(blobPath)
+}
+
+// Digests implements casengine.DigestLister.Digests.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	digests := []digest.Digest{}
+	for dig := range engine.paths {
+		if algorithm.String() == "" || dig.Algorithm() == algorithm {
+			if prefix == "" || strings.HasPrefix(dig.Encoded(), prefix) {
+				digests = append(digests, dig)
+			}
+		}
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(digests); i++ {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = callback(ctx, digests[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close releases resources held by the engine.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	return nil
+}
+
+// index adds the blob at blobPath to the engine's index.  Paths under
+// blobs/<algorithm>/<encoded> are indexed by path, and other paths
+// are indexed by hashing their content with SHA-256.
+func (engine *Engine) index(blobPath string) (err error) {
+	blobPath = path.Clean("/" + blobPath)
+
+	parts := strings.Split(strings.TrimPrefix(blobPath, "/"), "/")
+	if len(parts) == 3 && parts[0] == "blobs" {
+		dig, err := digest.Parse(fmt.Sprintf("%s:%s", parts[1], parts[2]))
+		if err == nil {
+			engine.paths[dig] = blobPath
+			return nil
+		}
+	}
+
+	file, err := engine.fileSystem.Open(blobPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", blobPath, err)
+	}
+	defer file.Close()
+
+	dig, err := digest.SHA256.FromReader(file)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("indexed %s as %s", blobPath, dig)
+	engine.paths[dig] = blobPath
+	return nil
+}
+
+// readJSON decodes the JSON file at name into value.
+func (engine *Engine) readJSON(name string, value interface{}) (err error) {
+	file, err := engine.fileSystem.Open("/" + name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockersave
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// config is the image config stored in the test tarballs.
+const config = `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`
+
+// layer is the layer stored in the test tarballs.
+const layer = "not really a tarball"
+
+// tarball creates a tar archive holding files.
+func tarball(t *testing.T, files map[string]string) (reader *bytes.Reader) {
+	buffer := &bytes.Buffer{}
+	writer := tar.NewWriter(buffer)
+	for name, content := range files {
+		err := writer.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = writer.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(buffer.Bytes())
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	configDigest := digest.FromString(config)
+	layerDigest := digest.FromString(layer)
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":%d}}`, configDigest, len(config))
+	manifestDigest := digest.FromString(manifest)
+
+	for _, testcase := range []struct {
+		name     string
+		files    map[string]string
+		expected []digest.Digest
+	}{
+		{
+			name: "legacy",
+			files: map[string]string{
+				configDigest.Encoded() + ".json": config,
+				"0123456789abcdef/layer.tar":     layer,
+				"0123456789abcdef/VERSION":       "1.0",
+				"manifest.json":                  fmt.Sprintf(`[{"Config":"%s.json","RepoTags":["hello:latest"],"Layers":["0123456789abcdef/layer.tar"]}]`, configDigest.Encoded()),
+				"repositories":                   `{"hello":{"latest":"0123456789abcdef"}}`,
+			},
+			expected: []digest.Digest{configDigest, layerDigest},
+		},
+		{
+			name: "OCI",
+			files: map[string]string{
+				"blobs/sha256/" + configDigest.Encoded():   config,
+				"blobs/sha256/" + layerDigest.Encoded():    layer,
+				"blobs/sha256/" + manifestDigest.Encoded(): manifest,
+				"index.json":    fmt.Sprintf(`{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d}]}`, manifestDigest, len(manifest)),
+				"manifest.json": fmt.Sprintf(`[{"Config":"blobs/sha256/%s","RepoTags":["hello:latest"],"Layers":["blobs/sha256/%s"]}]`, configDigest.Encoded(), layerDigest.Encoded()),
+				"oci-layout":    `{"imageLayoutVersion":"1.0.0"}`,
+			},
+			expected: []digest.Digest{configDigest, layerDigest, manifestDigest},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			engine, err := New(ctx, tarball(t, testcase.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			reader, err := engine.Get(ctx, configDigest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, config, string(content))
+
+			_, err = engine.Get(ctx, digest.FromString(""))
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+
+			digests := []digest.Digest{}
+			err = engine.(*Engine).Digests(ctx, "", "", -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+				digests = append(digests, digest)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.ElementsMatch(t, testcase.expected, digests)
+		})
+	}
+
+	t.Run("missing manifest.json", func(t *testing.T) {
+		_, err := New(ctx, tarball(t, map[string]string{"oci-layout": "{}"}))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,484 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package git implements a read-only CAS engine backed by the object
+// store of a git repository using the SHA-256 object format.
+// https://git-scm.com/docs/hash-function-transition
+//
+// Git object names hash the object's canonical form, which is a
+// "<type> <size>" header, a NUL byte, and then the object content.
+// Get returns that canonical form, so the content matches the
+// requested sha256 digest and callers can verify it like any other
+// blob.  Strip everything up to and including the first NUL to
+// recover the git blob content.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// hashSize is the size of a SHA-256 object name in bytes.
+const hashSize = 32
+
+// objectTypes maps packfile object type numbers to git type names.
+var objectTypes = map[byte]string{
+	1: "commit",
+	2: "tree",
+	3: "blob",
+	4: "tag",
+}
+
+const (
+	ofsDelta = 6
+	refDelta = 7
+)
+
+// Engine implements casengine.ReadCloser for a git object store.
+type Engine struct {
+	path string
+}
+
+// NewEngine creates a new CAS-engine instance.  The path argument is
+// the git directory (e.g. the .git directory of a working tree, or a
+// bare repository), which must use the sha256 object format.
+func NewEngine(ctx context.Context, path string) (engine casengine.ReadCloser, err error) {
+	info, err := os.Stat(filepath.Join(path, "objects"))
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a git directory", path)
+	}
+
+	format, err := objectFormat(filepath.Join(path, "config"))
+	if err != nil {
+		return nil, err
+	}
+	if format != "sha256" {
+		return nil, fmt.Errorf("%s uses the %s object format, but only sha256 is supported", path, format)
+	}
+
+	return &Engine{
+		path: path,
+	}, nil
+}
+
+// objectFormat returns the extensions.objectformat setting from a git
+// config file, which defaults to sha1.
+// https://git-scm.com/docs/git-config#Documentation/git-config.txt-extensionsobjectFormat
+func objectFormat(path string) (format string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	format = "sha1"
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+			continue
+		}
+		if section != "extensions" {
+			continue
+		}
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) == 2 && strings.ToLower(strings.TrimSpace(fields[0])) == "objectformat" {
+			format = strings.ToLower(strings.TrimSpace(fields[1]))
+		}
+	}
+
+	return format, scanner.Err()
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	if digest.Algorithm() != "sha256" {
+		return nil, fmt.Errorf("%s not found: git objects are only addressed by sha256: %w", digest, os.ErrNotExist)
+	}
+
+	err = digest.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = engine.getLoose(digest.Encoded())
+	if err == nil || !os.IsNotExist(err) {
+		return reader, err
+	}
+
+	name, err := hex.DecodeString(digest.Encoded())
+	if err != nil {
+		return nil, err
+	}
+
+	objectType, content, err := engine.getPacked(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s not found in %s: %w", digest, engine.path, os.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	header := fmt.Sprintf("%s %d\x00", objectType, len(content))
+	return ioutil.NopCloser(io.MultiReader(
+		bytes.NewReader([]byte(header)),
+		bytes.NewReader(content),
+	)), nil
+}
+
+// Close releases resources held by the engine.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	return nil
+}
+
+// zlibReadCloser closes both the zlib reader and the underlying file.
+type zlibReadCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+// Close implements io.Closer.Close.
+func (reader *zlibReadCloser) Close() (err error) {
+	err = reader.ReadCloser.Close()
+	err2 := reader.file.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// getLoose returns the canonical form of a loose object, which is
+// stored zlib-compressed under objects/<first two hex digits>/<rest>.
+func (engine *Engine) getLoose(encoded string) (reader io.ReadCloser, err error) {
+	path := filepath.Join(engine.path, "objects", encoded[:2], encoded[2:])
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	zlibReader, err := zlib.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return &zlibReadCloser{
+		ReadCloser: zlibReader,
+		file:       file,
+	}, nil
+}
+
+// getPacked returns the type and content of an object stored in one
+// of the repository's packfiles.
+func (engine *Engine) getPacked(name []byte) (objectType string, content []byte, err error) {
+	indexes, err := filepath.Glob(filepath.Join(engine.path, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, index := range indexes {
+		offset, err := findOffset(index, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", nil, err
+		}
+
+		pack := index[:len(index)-len(".idx")] + ".pack"
+		logrus.Debugf("reading %x from %s at %d", name, pack, offset)
+		return engine.readPacked(pack, offset)
+	}
+
+	return "", nil, os.ErrNotExist
+}
+
+// findOffset looks up an object's packfile offset in a version 2 pack
+// index.
+// https://git-scm.com/docs/gitformat-pack#_version_2_pack_idx_files_support_packs_larger_than_4_gib_and
+func findOffset(path string, name []byte) (offset int64, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return -1, err
+	}
+
+	fanoutStart := 8
+	namesStart := fanoutStart + 256*4
+	if len(data) < namesStart || !bytes.Equal(data[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return -1, fmt.Errorf("%s is not a version 2 pack index", path)
+	}
+
+	fanout := func(i int) int {
+		return int(binary.BigEndian.Uint32(data[fanoutStart+4*i:]))
+	}
+
+	count := fanout(255)
+	offsetsStart := namesStart + count*(hashSize+4)
+	largeOffsetsStart := offsetsStart + count*4
+	if len(data) < largeOffsetsStart {
+		return -1, fmt.Errorf("%s is truncated", path)
+	}
+
+	low := 0
+	if name[0] > 0 {
+		low = fanout(int(name[0]) - 1)
+	}
+	high := fanout(int(name[0]))
+	i := low + sort.Search(high-low, func(i int) bool {
+		start := namesStart + (low+i)*hashSize
+		return bytes.Compare(data[start:start+hashSize], name) >= 0
+	})
+	start := namesStart + i*hashSize
+	if i >= high || !bytes.Equal(data[start:start+hashSize], name) {
+		return -1, os.ErrNotExist
+	}
+
+	offset32 := binary.BigEndian.Uint32(data[offsetsStart+4*i:])
+	if offset32&0x80000000 == 0 {
+		return int64(offset32), nil
+	}
+
+	start = largeOffsetsStart + 8*int(offset32&0x7fffffff)
+	if len(data) < start+8 {
+		return -1, fmt.Errorf("%s is truncated", path)
+	}
+	return int64(binary.BigEndian.Uint64(data[start:])), nil
+}
+
+// readPacked reads the object at offset in a packfile, resolving
+// deltas against their base objects.
+// https://git-scm.com/docs/gitformat-pack#_pack_pack_files_have_the_following_format
+func (engine *Engine) readPacked(path string, offset int64) (objectType string, content []byte, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	return engine.readPackedEntry(file, offset)
+}
+
+func (engine *Engine) readPackedEntry(file *os.File, offset int64) (objectType string, content []byte, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, math.MaxInt64-offset))
+
+	c, err := reader.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	typeNumber := (c >> 4) & 0x7
+	size := uint64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		c, err = reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+
+	var baseType string
+	var base []byte
+	switch typeNumber {
+	case ofsDelta:
+		c, err = reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			c, err = reader.ReadByte()
+			if err != nil {
+				return "", nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return "", nil, fmt.Errorf("invalid delta base distance %d at offset %d of %s", distance, offset, file.Name())
+		}
+		baseType, base, err = engine.readPackedEntry(file, offset-distance)
+		if err != nil {
+			return "", nil, err
+		}
+	case refDelta:
+		name := make([]byte, hashSize)
+		_, err = io.ReadFull(reader, name)
+		if err != nil {
+			return "", nil, err
+		}
+		baseType, base, err = engine.getObject(name)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		var ok bool
+		objectType, ok = objectTypes[typeNumber]
+		if !ok {
+			return "", nil, fmt.Errorf("unrecognized object type %d at offset %d of %s", typeNumber, offset, file.Name())
+		}
+	}
+
+	zlibReader, err := zlib.NewReader(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zlibReader.Close()
+
+	// Read instead of allocating size up front, so a corrupt size
+	// cannot force a huge allocation.
+	if size > math.MaxInt64 {
+		return "", nil, fmt.Errorf("invalid object size %d at offset %d of %s", size, offset, file.Name())
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(zlibReader, int64(size)))
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(data)) != size {
+		return "", nil, fmt.Errorf("object at offset %d of %s is %d bytes, but its header declares %d", offset, file.Name(), len(data), size)
+	}
+
+	if base == nil {
+		return objectType, data, nil
+	}
+
+	content, err = applyDelta(base, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("delta at offset %d of %s: %s", offset, file.Name(), err)
+	}
+	return baseType, content, nil
+}
+
+// getObject returns the type and content of a loose or packed object.
+func (engine *Engine) getObject(name []byte) (objectType string, content []byte, err error) {
+	reader, err := engine.getLoose(hex.EncodeToString(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return engine.getPacked(name)
+		}
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	index := bytes.IndexByte(data, 0)
+	space := bytes.IndexByte(data, ' ')
+	if index < 0 || space < 0 || space > index {
+		return "", nil, fmt.Errorf("invalid header for loose object %x", name)
+	}
+
+	return string(data[:space]), data[index+1:], nil
+}
+
+// applyDelta reconstructs an object from its base and a packfile
+// delta.
+// https://git-scm.com/docs/gitformat-pack#_deltified_representation
+func applyDelta(base []byte, delta []byte) (target []byte, err error) {
+	reader := bytes.NewReader(delta)
+
+	baseSize, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("base size %d does not match expected %d", len(base), baseSize)
+	}
+
+	targetSize, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Grow target as instructions are applied, instead of allocating
+	// targetSize up front, so a corrupt delta cannot force a huge
+	// allocation.
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c&0x80 != 0:
+			var offset, size uint64
+			for i := uint(0); i < 7; i++ {
+				if c&(1<<i) == 0 {
+					continue
+				}
+				b, err := reader.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if i < 4 {
+					offset |= uint64(b) << (8 * i)
+				} else {
+					size |= uint64(b) << (8 * (i - 4))
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, fmt.Errorf("copy of %d bytes from offset %d overruns the %d-byte base", size, offset, len(base))
+			}
+			if uint64(len(target))+size > targetSize {
+				return nil, fmt.Errorf("copy of %d bytes overruns the %d-byte target", size, targetSize)
+			}
+			target = append(target, base[offset:offset+size]...)
+		case c != 0:
+			if uint64(len(target))+uint64(c) > targetSize {
+				return nil, fmt.Errorf("insert of %d bytes overruns the %d-byte target", c, targetSize)
+			}
+			data := make([]byte, c)
+			_, err = io.ReadFull(reader, data)
+			if err != nil {
+				return nil, err
+			}
+			target = append(target, data...)
+		default:
+			return nil, fmt.Errorf("reserved delta instruction 0")
+		}
+	}
+
+	if uint64(len(target)) != targetSize {
+		return nil, fmt.Errorf("target size %d does not match expected %d", len(target), targetSize)
+	}
+
+	return target, nil
+}
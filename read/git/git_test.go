@@ -0,0 +1,212 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// testdata/repo.git was created with:
+//
+//   git init --bare --object-format=sha256 repo.git
+//
+// pushing a commit with hello ("Hello, World!") and two 5-KiB files
+// differing in one line, running 'git gc --aggressive' (which stores
+// big1 as a delta against big2), and then adding a loose blob with
+// 'printf "Goodbye, World!" | git hash-object -w --stdin'.
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := NewEngine(ctx, "testdata/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	for _, testcase := range []struct {
+		name     string
+		digest   digest.Digest
+		expected string
+	}{
+		{
+			name:     "loose",
+			digest:   "sha256:ac3eeac05663ef70e66a42cbb9877d897bd39ec4e66b1bfb780d306f70be404c",
+			expected: "blob 15\x00Goodbye, World!",
+		},
+		{
+			name:     "packed",
+			digest:   "sha256:e118a058f018dda253bb692320c940091b15e4f19067e12fff110606a111f5da",
+			expected: "blob 13\x00Hello, World!",
+		},
+		{
+			name:     "packed delta",
+			digest:   "sha256:b6dad0e3c648e38e65dec01c52f56fcb36b9e886850251720cb989884e7b8740",
+			expected: "blob 5190\x00line 0 of a file which git should store as a delta\n",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			reader, err := engine.Get(ctx, testcase.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.True(t, strings.HasPrefix(string(data), testcase.expected), "%q does not start with %q", data, testcase.expected)
+			assert.Equal(t, testcase.digest, digest.FromBytes(data))
+		})
+	}
+
+	for _, testcase := range []struct {
+		name   string
+		digest digest.Digest
+	}{
+		{
+			name:   "unknown object",
+			digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			name:   "other algorithm",
+			digest: "sha512:374d794a95cdcfd8b35993185fef9ba368f160d8daf432d08ba9f1ed1e5abe6cc69291e0fa2fe0006a52570ef18c19def4e617c33ce52ef0a6e5fbe318cb0387",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, err := engine.Get(ctx, testcase.digest)
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+		})
+	}
+}
+
+func TestNewEngineObjectFormat(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-git-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	err = os.Mkdir(filepath.Join(temp, "objects"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(temp, "config"), []byte("[core]\n\trepositoryformatversion = 0\n\tbare = true\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewEngine(ctx, temp)
+	assert.EqualError(t, err, fmt.Sprintf("%s uses the sha1 object format, but only sha256 is supported", temp))
+}
+
+// packEntryHeader encodes a packfile object header.
+func packEntryHeader(typeNumber byte, size uint64) []byte {
+	c := typeNumber<<4 | byte(size&0x0f)
+	size >>= 4
+	header := []byte{}
+	for size > 0 {
+		header = append(header, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(header, c)
+}
+
+func TestReadPackedCorrupt(t *testing.T) {
+	temp, err := ioutil.TempDir("", "casengine-git-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte("Hello, World!"))
+	writer.Close()
+
+	for _, testcase := range []struct {
+		name     string
+		entry    []byte
+		expected string
+	}{
+		{
+			name:     "zero delta distance",
+			entry:    append(packEntryHeader(ofsDelta, 13), 0x00),
+			expected: "invalid delta base distance 0",
+		},
+		{
+			name:     "delta distance beyond the start of the pack",
+			entry:    append(packEntryHeader(ofsDelta, 13), 0x7f),
+			expected: "invalid delta base distance 127",
+		},
+		{
+			name:     "huge size",
+			entry:    append(packEntryHeader(3, 1<<40), compressed.Bytes()...),
+			expected: "header declares 1099511627776",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			path := filepath.Join(temp, "pack")
+			err := ioutil.WriteFile(path, append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x01"), testcase.entry...), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = (&Engine{path: temp}).readPacked(path, 12)
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			assert.Contains(t, err.Error(), testcase.expected)
+		})
+	}
+}
+
+func TestApplyDeltaHugeTarget(t *testing.T) {
+	base := []byte("Hello, World!")
+	delta := binary.AppendUvarint(nil, uint64(len(base)))
+	delta = binary.AppendUvarint(delta, 1<<40)
+	delta = append(delta, 0x90, 13) // copy 13 bytes from offset 0
+
+	_, err := applyDelta(base, delta)
+	assert.EqualError(t, err, "target size 13 does not match expected 1099511627776")
+
+	delta = binary.AppendUvarint(nil, uint64(len(base)))
+	delta = binary.AppendUvarint(delta, 5)
+	delta = append(delta, 0x90, 13)
+
+	_, err = applyDelta(base, delta)
+	assert.EqualError(t, err, "copy of 13 bytes overruns the 5-byte target")
+}
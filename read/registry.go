@@ -16,6 +16,8 @@
 package read
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 
 	"github.com/wking/casengine"
@@ -25,6 +27,76 @@ import (
 // New creates a new CAS-engine ReadCloser.
 type New func(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error)
 
+// Capability describes the operations supported by engines from a
+// registered constructor.
+type Capability int
+
+const (
+	// ReadOnly engines implement casengine.ReadCloser.
+	ReadOnly Capability = iota
+
+	// ReadWrite engines also implement casengine.Writer and
+	// casengine.Deleter.
+	ReadWrite
+)
+
+// String returns a human-readable name for the capability.
+func (capability Capability) String() string {
+	switch capability {
+	case ReadOnly:
+		return "read-only"
+	case ReadWrite:
+		return "read-write"
+	default:
+		return fmt.Sprintf("Capability(%d)", int(capability))
+	}
+}
+
+// Constructor is a registered CAS-engine generator.
+type Constructor struct {
+	// New creates engines for the registered protocol.
+	New New
+
+	// Capability is the set of operations supported by engines
+	// created by New.
+	Capability Capability
+}
+
+// ErrUnsupportedProtocol is returned by Lookup for unregistered
+// protocol identifiers.
+var ErrUnsupportedProtocol = errors.New("unsupported CAS-engine protocol")
+
+// ErrUnsupportedOperation is returned by Lookup for registered
+// protocols which lack the requested capability.
+var ErrUnsupportedOperation = errors.New("operation not supported by CAS-engine protocol")
+
 // Constructors holds CAS-engine generators associated with registered
 // protocol identifiers.
-var Constructors = map[string]New{}
+var Constructors = map[string]*Constructor{}
+
+// Register associates a CAS-engine generator with a protocol
+// identifier.  Engines returned by a ReadWrite generator must
+// implement casengine.Engine.
+func Register(protocol string, capability Capability, newEngine New) {
+	Constructors[protocol] = &Constructor{
+		New:        newEngine,
+		Capability: capability,
+	}
+}
+
+// Lookup returns the constructor registered for protocol.  It returns
+// an error wrapping ErrUnsupportedProtocol if no constructor is
+// registered, or ErrUnsupportedOperation if the constructor lacks the
+// requested capability.
+func Lookup(protocol string, capability Capability) (constructor *Constructor, err error) {
+	constructor, ok := Constructors[protocol]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedProtocol, protocol)
+	}
+
+	if constructor.Capability < capability {
+		return nil, fmt.Errorf("%w: %q is %s, but %s is required", ErrUnsupportedOperation, protocol, constructor.Capability, capability)
+	}
+
+	return constructor, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package read
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+func TestLookup(t *testing.T) {
+	newEngine := func(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+		return nil, nil
+	}
+	Register("test-read-only", ReadOnly, newEngine)
+	Register("test-read-write", ReadWrite, newEngine)
+	defer delete(Constructors, "test-read-only")
+	defer delete(Constructors, "test-read-write")
+
+	for _, testcase := range []struct {
+		protocol   string
+		capability Capability
+		expected   error
+	}{
+		{
+			protocol:   "test-read-only",
+			capability: ReadOnly,
+		},
+		{
+			protocol:   "test-read-only",
+			capability: ReadWrite,
+			expected:   ErrUnsupportedOperation,
+		},
+		{
+			protocol:   "test-read-write",
+			capability: ReadOnly,
+		},
+		{
+			protocol:   "test-read-write",
+			capability: ReadWrite,
+		},
+		{
+			protocol:   "test-missing",
+			capability: ReadOnly,
+			expected:   ErrUnsupportedProtocol,
+		},
+	} {
+		t.Run(testcase.protocol+" "+testcase.capability.String(), func(t *testing.T) {
+			constructor, err := Lookup(testcase.protocol, testcase.capability)
+			if testcase.expected == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, Constructors[testcase.protocol], constructor)
+				return
+			}
+			if !errors.Is(err, testcase.expected) {
+				t.Fatalf("expected an error matching %s, got %v", testcase.expected, err)
+			}
+		})
+	}
+}
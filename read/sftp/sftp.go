@@ -0,0 +1,321 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sftp implements a read-only CAS engine for blobs served
+// over SFTP, with paths given by a URI Template.
+//
+// This is not one of the CAS-engine protocols from oci-discovery, so
+// it is registered under the non-standard oci-cas-sftp-v1 protocol
+// identifier.
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"github.com/wking/casengine/read"
+	"github.com/wking/casengine/read/template"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/context"
+)
+
+// uriScheme matches URI Templates which begin with a scheme.
+var uriScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// Engine implements casengine.Reader and casengine.DigestLister for
+// an SFTP server.
+type Engine struct {
+	conn      *ssh.Client
+	client    *sftp.Client
+	template  *template.Engine
+	getDigest *dir.RegexpGetDigest
+}
+
+// New creates a new CAS-engine instance.  The baseURI must be an
+// sftp://[user@]host[:port]/path URI, and relative URI Templates are
+// resolved against it.  The config must be a map[string]string or a
+// map[string]interface{} with string values.
+//
+// The required 'uri' property is a URI Template for blob paths, which
+// must be a relative or absolute path supporting {algorithm},
+// {encoded}, and {encoded:N} expressions.  The optional 'password'
+// and 'privateKey' (the path to a PEM-encoded private key)
+// properties configure authentication.  The server's host key is
+// checked against either the 'hostKey' property, in authorized_keys
+// format, or the known_hosts file at the 'knownHosts' path.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	if baseURI == nil || baseURI.Scheme != "sftp" {
+		return nil, fmt.Errorf("sftp engine requires an sftp:// base URI, not %v", baseURI)
+	}
+
+	configMap, err := stringMap(config)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, ok := configMap["uri"]
+	if !ok {
+		return nil, fmt.Errorf("sftp config missing required 'uri' property: %v", configMap)
+	}
+
+	pathTemplate := uri
+	if !strings.HasPrefix(pathTemplate, "/") {
+		if uriScheme.MatchString(pathTemplate) {
+			return nil, fmt.Errorf("sftp config 'uri' must be a path, not %q", uri)
+		}
+		pathTemplate = baseURI.Path[:strings.LastIndex(baseURI.Path, "/")+1] + pathTemplate
+	}
+
+	pathRegexp, err := dir.TemplateRegexp(pathTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	templateEngine, err := template.New(ctx, &url.URL{Scheme: "sftp", Path: "/"}, map[string]string{
+		"uri": pathTemplate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig, err := clientConfig(baseURI, configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	address := baseURI.Host
+	if baseURI.Port() == "" {
+		address = net.JoinHostPort(baseURI.Hostname(), "22")
+	}
+
+	logrus.Debugf("connecting to %s", address)
+	conn, err := ssh.Dial("tcp", address, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Engine{
+		conn:      conn,
+		client:    client,
+		template:  templateEngine.(*template.Engine),
+		getDigest: &dir.RegexpGetDigest{Regexp: pathRegexp},
+	}, nil
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	remotePath, err := engine.path(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("opening %s", remotePath)
+	file, err := engine.client.Open(remotePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s not found at %s: %w", digest, remotePath, os.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Digests implements casengine.DigestLister.Digests.  Every matching
+// path is visited before the first callback.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	globAlgorithm := algorithm.String()
+	if globAlgorithm == "" {
+		globAlgorithm = "*"
+	}
+	glob, err := engine.path(digest.Digest(fmt.Sprintf("%s:*", globAlgorithm)))
+	if err != nil {
+		return err
+	}
+
+	matches, err := engine.client.Glob(glob)
+	if err != nil {
+		return err
+	}
+
+	digests := []digest.Digest{}
+	for _, match := range matches {
+		dig, err := engine.getDigest.GetDigest(match)
+		if err != nil {
+			logrus.Warnf("cannot compute digest for %q (%s)", match, err)
+			continue
+		}
+
+		if algorithm.String() == "" || dig.Algorithm() == algorithm {
+			if prefix == "" || strings.HasPrefix(dig.Encoded(), prefix) {
+				digests = append(digests, dig)
+			}
+		}
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+
+	if from < 0 {
+		from = 0
+	}
+	count := 0
+	for i := from; i < len(digests); i++ {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = callback(ctx, digests[i])
+		if err != nil {
+			return err
+		}
+		count++
+		if size != -1 && count >= size {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close releases resources held by the engine.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	err = engine.client.Close()
+	err2 := engine.conn.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// path returns the remote path for digest.
+func (engine *Engine) path(digest digest.Digest) (remotePath string, err error) {
+	uri, err := engine.template.URI(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Clean(uri.Path), nil
+}
+
+// clientConfig creates the SSH client configuration for New.
+func clientConfig(baseURI *url.URL, configMap map[string]string) (config *ssh.ClientConfig, err error) {
+	config = &ssh.ClientConfig{}
+	if baseURI.User != nil {
+		config.User = baseURI.User.Username()
+	}
+
+	password, ok := configMap["password"]
+	if ok {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+
+	keyPath, ok := configMap["privateKey"]
+	if ok {
+		data, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", keyPath, err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if len(config.Auth) == 0 {
+		return nil, fmt.Errorf("sftp config requires a 'password' or 'privateKey' property: %v", configMap)
+	}
+
+	hostKey, ok := configMap["hostKey"]
+	if ok {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("sftp config 'hostKey': %s", err)
+		}
+		config.HostKeyCallback = ssh.FixedHostKey(key)
+	}
+
+	knownHostsPath, ok := configMap["knownHosts"]
+	if ok {
+		if config.HostKeyCallback != nil {
+			return nil, fmt.Errorf("setting both 'hostKey' and 'knownHosts' in sftp config is invalid")
+		}
+		config.HostKeyCallback, err = knownhosts.New(knownHostsPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.HostKeyCallback == nil {
+		return nil, fmt.Errorf("sftp config requires a 'hostKey' or 'knownHosts' property: %v", configMap)
+	}
+
+	return config, nil
+}
+
+// stringMap converts a map[string]string or map[string]interface{}
+// with string values into a map[string]string.
+func stringMap(config interface{}) (configMap map[string]string, err error) {
+	configMap, ok := config.(map[string]string)
+	if ok {
+		return configMap, nil
+	}
+
+	configMap2, ok := config.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sftp config is not a map[string]string: %v", config)
+	}
+
+	configMap = make(map[string]string)
+	for key, value := range configMap2 {
+		configMap[key], ok = value.(string)
+		if !ok {
+			return nil, fmt.Errorf("sftp config %q is not a string: %v", key, value)
+		}
+	}
+
+	return configMap, nil
+}
+
+func init() {
+	read.Register("oci-cas-sftp-v1", read.ReadOnly, New)
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+)
+
+func TestRegistration(t *testing.T) {
+	constructor, ok := read.Constructors["oci-cas-sftp-v1"]
+	if !ok {
+		t.Fatalf("failed to register oci-cas-sftp-v1")
+	}
+	assert.Equal(t, read.ReadOnly, constructor.Capability)
+}
+
+// serve runs an in-process SFTP server accepting the given password,
+// returning its address and host key.
+func serve(t *testing.T, password string) (address string, hostKey ssh.PublicKey, closer io.Closer) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (permissions *ssh.Permissions, err error) {
+			if string(pass) != password {
+				return nil, fmt.Errorf("password rejected for %s", conn.User())
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn, config)
+		}
+	}()
+
+	return listener.Addr().String(), signer.PublicKey(), listener
+}
+
+func handle(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for request := range requests {
+				ok := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+				request.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+
+	temp, err := ioutil.TempDir("", "casengine-sftp-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	path := filepath.Join(temp, "blobs", "sha256", "df", dig.Encoded())
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte("Hello, World!"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address, hostKey, closer := serve(t, "secret")
+	defer closer.Close()
+
+	base, err := url.Parse(fmt.Sprintf("sftp://tester@%s%s/", address, temp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]interface{}{
+		"uri":      "blobs/{algorithm}/{encoded:2}/{encoded}",
+		"password": "secret",
+		"hostKey":  string(ssh.MarshalAuthorizedKey(hostKey)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	t.Run("good", func(t *testing.T) {
+		reader, err := engine.Get(ctx, dig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Hello, World!", string(content))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := engine.Get(ctx, digest.Digest("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+	})
+
+	t.Run("digests", func(t *testing.T) {
+		digests := []digest.Digest{}
+		err := engine.(casengine.DigestLister).Digests(ctx, "", "", -1, 0, func(ctx context.Context, dig digest.Digest) (err error) {
+			digests = append(digests, dig)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []digest.Digest{dig}, digests)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := New(ctx, base, map[string]string{
+			"uri":      "blobs/{algorithm}/{encoded:2}/{encoded}",
+			"password": "wrong",
+			"hostKey":  string(ssh.MarshalAuthorizedKey(hostKey)),
+		})
+		assert.Error(t, err)
+	})
+}
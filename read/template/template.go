@@ -17,11 +17,17 @@
 package template
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jtacoma/uritemplates"
 	"github.com/opencontainers/go-digest"
@@ -31,6 +37,27 @@ import (
 	"golang.org/x/net/context"
 )
 
+// ErrTruncated is returned when reading a response body which ends
+// before its advertised Content-Length, e.g. because a proxy cut the
+// connection.
+var ErrTruncated = errors.New("truncated response body")
+
+// ErrSizeMismatch is returned by GetSized when the response's
+// Content-Length does not match the expected size.
+var ErrSizeMismatch = errors.New("unexpected response size")
+
+// ErrContentRange is returned by GetRange when a partial response's
+// Content-Range is malformed or does not match the requested range.
+var ErrContentRange = errors.New("invalid Content-Range")
+
+// existsBatchWorkers is the number of concurrent requests made by
+// ExistsBatch.
+const existsBatchWorkers = 8
+
+// retryDelay is the delay before the first retry.  It doubles for
+// each subsequent retry.
+var retryDelay = 100 * time.Millisecond
+
 // Engine implements the OCI CAS Template Protocol v1.
 type Engine struct {
 	uri  *uritemplates.UriTemplate
@@ -44,6 +71,55 @@ type Engine struct {
 	//   // handle err and possibly engine.Close(ctx)
 	//   engine.(*Engine).Client = yourCustomClient
 	Client *http.Client
+
+	// DirectoryBase makes relative URI Template expansions resolve
+	// against the base URI as a directory, whether or not the base
+	// path ends with a slash.  For example, "blob" resolves against
+	// https://example.com/a to https://example.com/a/blob instead of
+	// the RFC 3986 https://example.com/blob.  References without a
+	// path, like "?digest={digest}", keep the base path unchanged.
+	DirectoryBase bool
+
+	// Retries is the number of times Get retries a request which fails
+	// with a network error or a 429 or 5xx status.  Each retry also
+	// spends from any casengine.RetryBudget carried by the context,
+	// and retrying stops once that budget is exhausted.
+	Retries int
+
+	// Mirrors are base URIs which serve the same URI Template
+	// expansions as the engine's base URI.  When a request fails or
+	// gets a non-2xx response (including 404) after any Retries, it
+	// is repeated against each mirror in turn, and the first 2xx
+	// response wins.  Blobs served by a mirror are logged with the
+	// mirror.  Mirrors have no effect for templates which expand to
+	// absolute URIs.  If the engine has no base URI, the first mirror
+	// is tried first.
+	Mirrors []*url.URL
+
+	// DigestCase sets how digests are normalized before they are
+	// expanded into URIs (see casengine.NormalizeDigest), so that
+	// SHA256:ABC... and sha256:abc... request the same URI.  The
+	// default, casengine.CaseUnchecked, expands digests unchanged.
+	DigestCase casengine.CasePolicy
+
+	// SignURL, if set, is called on each resolved URI before it is
+	// requested, and the request uses the returned URL instead.  This
+	// allows callers to attach time-limited signatures, for example for
+	// a CDN which requires signed URLs.  URI and URIWithVariables
+	// return unsigned URIs.
+	SignURL func(*url.URL) (*url.URL, error)
+
+	// ReadAheadSize, if positive, buffers readers returned by Get and
+	// its variants with a read-ahead buffer of this many bytes, so
+	// consumers doing many small Reads do not make a network read for
+	// each.  Buffering does not change the returned content, so
+	// digest verification is unaffected.  New sets it from the
+	// optional 'readAheadSize' config property.
+	ReadAheadSize int
+
+	// Logger, if set, receives the engine's log messages.  Get will
+	// use the logrus standard logger if Logger is not set.
+	Logger logrus.FieldLogger
 }
 
 // New creates a new CAS-engine instance.
@@ -63,6 +139,13 @@ func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine case
 		if !ok {
 			return nil, fmt.Errorf("CAS-template config 'uri' is not a string: %v", uriInterface)
 		}
+		readAheadInterface, ok := configMap2["readAheadSize"]
+		if ok {
+			configMap["readAheadSize"], ok = readAheadInterface.(string)
+			if !ok {
+				return nil, fmt.Errorf("CAS-template config 'readAheadSize' is not a string: %v", readAheadInterface)
+			}
+		}
 	}
 
 	uriString, ok := configMap["uri"]
@@ -75,31 +158,321 @@ func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine case
 		return nil, err
 	}
 
+	var readAheadSize int
+	readAheadString, ok := configMap["readAheadSize"]
+	if ok {
+		readAheadSize, err = strconv.Atoi(readAheadString)
+		if err != nil {
+			return nil, fmt.Errorf("CAS-template config 'readAheadSize' %q is not an integer: %s", readAheadString, err)
+		}
+	}
+
 	return &Engine{
-		uri:  uriTemplate,
-		base: baseURI,
+		uri:           uriTemplate,
+		base:          baseURI,
+		ReadAheadSize: readAheadSize,
 	}, nil
 }
 
 // Get returns a reader for retrieving a blob from the store.
 func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
-	request, err := engine.getPreFetch(digest)
+	return engine.GetWithVariables(ctx, digest, nil)
+}
+
+// GetWithVariables is like Get, but it also expands the URI Template
+// with additional caller-supplied variables, e.g. the 'repo' in
+// {repo}/blobs/{algorithm}/{encoded}.  See URIWithVariables.
+func (engine *Engine) GetWithVariables(ctx context.Context, digest digest.Digest, variables map[string]string) (reader io.ReadCloser, err error) {
+	response, err := engine.fetch(ctx, "GET", digest, variables, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.getPostFetch(response, digest)
+}
+
+// Exists returns true if the blob for digest is in the store.  It
+// issues a HEAD request, so the blob content is not transferred.
+func (engine *Engine) Exists(ctx context.Context, digest digest.Digest) (exists bool, err error) {
+	response, err := engine.fetch(ctx, "HEAD", digest, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("requested %s but got %s", response.Request.URL, response.Status)
+	}
+}
+
+// ExistsBatch is like Exists, but it checks many digests with up to
+// existsBatchWorkers concurrent HEAD requests.  See
+// casengine.ExistsAll.
+func (engine *Engine) ExistsBatch(ctx context.Context, digests []digest.Digest) (exists map[digest.Digest]bool, err error) {
+	return casengine.ExistsAll(ctx, engine, digests, existsBatchWorkers)
+}
+
+// GetSized is like Get, but it returns an error wrapping
+// ErrSizeMismatch without reading the body if the response's
+// Content-Length is not expectedSize.  This is a cheap check when the
+// size is known, e.g. from a descriptor.  If the response does not
+// advertise its length, reads return an error wrapping ErrTruncated
+// if the body ends before expectedSize bytes.
+func (engine *Engine) GetSized(ctx context.Context, digest digest.Digest, expectedSize int64) (reader io.ReadCloser, err error) {
+	response, err := engine.fetch(ctx, "GET", digest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = engine.getPostFetch(response, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ContentLength < 0 {
+		return &lengthCheckingReader{
+			ReadCloser: reader,
+			uri:        response.Request.URL,
+			expected:   expectedSize,
+		}, nil
+	}
+
+	if response.ContentLength != expectedSize {
+		reader.Close()
+		return nil, fmt.Errorf("%w: %s advertised %d bytes, but %d were expected", ErrSizeMismatch, response.Request.URL, response.ContentLength, expectedSize)
+	}
+
+	return reader, nil
+}
+
+// GetRange is like Get, but it only returns length bytes of the blob
+// starting at offset.  A negative length reads through the end of the
+// blob.  If the server responds with 206 Partial Content, its
+// Content-Range is checked against the requested range (and the
+// total size, if the server gives it), and mismatched or malformed
+// headers return an error wrapping ErrContentRange.  If the server
+// ignores the Range header and returns the whole blob, GetRange
+// skips to offset itself.
+func (engine *Engine) GetRange(ctx context.Context, digest digest.Digest, offset int64, length int64) (reader io.ReadCloser, err error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("negative offset %d", offset)
+	}
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	header := http.Header{}
+	header.Set("Range", byteRange)
+
+	response, err := engine.fetch(ctx, "GET", digest, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusPartialContent {
+		first, last, err := checkContentRange(response.Header.Get("Content-Range"), offset, length)
+		if err != nil {
+			response.Body.Close()
+			return nil, fmt.Errorf("%w from %s", err, response.Request.URL)
+		}
+		return engine.readAhead(&lengthCheckingReader{
+			ReadCloser: response.Body,
+			uri:        response.Request.URL,
+			expected:   last - first + 1,
+		}), nil
+	}
+
+	reader, err = engine.getPostFetch(response, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.CopyN(ioutil.Discard, reader, offset)
 	if err != nil {
+		reader.Close()
 		return nil, err
 	}
-	request = request.WithContext(ctx)
 
+	if length < 0 {
+		return reader, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.LimitReader(reader, length),
+		Closer: reader,
+	}, nil
+}
+
+// checkContentRange parses a Content-Range header value like "bytes
+// 0-99/1234" and checks it against a request for length bytes starting
+// at offset.  The returned first and last are the inclusive byte
+// positions of the returned range.
+func checkContentRange(contentRange string, offset int64, length int64) (first int64, last int64, err error) {
+	unit := "bytes "
+	if !strings.HasPrefix(contentRange, unit) {
+		return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+	}
+
+	spec := strings.TrimPrefix(contentRange, unit)
+	slash := strings.Index(spec, "/")
+	if slash < 0 {
+		return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+	}
+
+	positions := strings.SplitN(spec[:slash], "-", 2)
+	if len(positions) != 2 {
+		return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+	}
+
+	first, err = strconv.ParseInt(positions[0], 10, 64)
+	if err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+	}
+
+	last, err = strconv.ParseInt(positions[1], 10, 64)
+	if err != nil || last < first {
+		return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+	}
+
+	total := int64(-1)
+	if spec[slash+1:] != "*" {
+		total, err = strconv.ParseInt(spec[slash+1:], 10, 64)
+		if err != nil || total <= last {
+			return 0, 0, fmt.Errorf("%w: malformed %q", ErrContentRange, contentRange)
+		}
+	}
+
+	// A range running past the end of the blob is truncated to the
+	// blob's last byte, which is unknown if the total is "*".
+	expectedLast := offset + length - 1
+	if length < 0 || (total >= 0 && expectedLast >= total) {
+		expectedLast = total - 1
+	}
+
+	if first != offset || (expectedLast >= 0 && last != expectedLast) {
+		return 0, 0, fmt.Errorf("%w: requested %d bytes from offset %d, but got %q", ErrContentRange, length, offset, contentRange)
+	}
+
+	return first, last, nil
+}
+
+// fetch requests the blob for digest with method, adding any entries
+// in header to the request.  If the request fails or gets a non-2xx
+// response, it is repeated against each of Mirrors in turn.
+func (engine *Engine) fetch(ctx context.Context, method string, digest digest.Digest, variables map[string]string, header http.Header) (response *http.Response, err error) {
+	// Fail fast, without a connection attempt, if ctx is already done.
+	err = ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	bases := engine.Mirrors
+	if engine.base != nil || len(bases) == 0 {
+		bases = append([]*url.URL{engine.base}, bases...)
+	}
+
+	var requests []*http.Request
+	tried := map[string]bool{}
+	for _, base := range bases {
+		request, err := engine.getPreFetchFrom(base, digest, variables)
+		if err != nil {
+			return nil, err
+		}
+		if tried[request.URL.String()] {
+			continue
+		}
+		tried[request.URL.String()] = true
+
+		request = request.WithContext(ctx)
+		request.Method = method
+		if len(header) > 0 {
+			request.Header = header
+		}
+		requests = append(requests, request)
+	}
+
+	for i, request := range requests {
+		response, err = engine.do(ctx, request, digest)
+		if err == nil && response.StatusCode >= 200 && response.StatusCode < 300 {
+			if i > 0 {
+				engine.logger().WithFields(logrus.Fields{
+					"digest": digest,
+					"uri":    request.URL.String(),
+				}).Info("fetched blob from mirror")
+			}
+			return response, nil
+		}
+
+		if i == len(requests)-1 || ctx.Err() != nil {
+			return response, err
+		}
+
+		if err == nil {
+			engine.logger().Warnf("trying the next mirror after %s got %s", request.URL, response.Status)
+			response.Body.Close()
+		} else {
+			engine.logger().Warnf("trying the next mirror after %s failed: %s", request.URL, err)
+		}
+	}
+
+	return response, err
+}
+
+// do issues request, retrying as configured by Retries.
+func (engine *Engine) do(ctx context.Context, request *http.Request, digest digest.Digest) (response *http.Response, err error) {
 	client := engine.Client
 	if client == nil {
 		client = http.DefaultClient
 	}
-	logrus.Debugf("requesting %s from %s", digest, request.URL)
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		engine.logger().Debugf("requesting %s from %s", digest, request.URL)
+		response, err = client.Do(request)
+		if !retryable(response, err) || attempt >= engine.Retries || ctx.Err() != nil {
+			return response, err
+		}
+
+		if !casengine.SpendRetry(ctx) {
+			engine.logger().Debugf("retry budget exhausted after attempt %d for %s", attempt+1, request.URL)
+			return response, err
+		}
+
+		if err == nil {
+			engine.logger().Warnf("retrying %s after attempt %d got %s", request.URL, attempt+1, response.Status)
+			response.Body.Close()
+		} else {
+			engine.logger().Warnf("retrying %s after attempt %d failed: %s", request.URL, attempt+1, err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
 	}
+}
 
-	return engine.getPostFetch(response, digest)
+// retryable returns true if a request which returned response and err
+// is worth retrying.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
 }
 
 // Close releases resources held by the engine.
@@ -109,10 +482,43 @@ func (engine *Engine) Close(ctx context.Context) (err error) {
 
 // URI returns the expanded, resolved URI for digest.
 func (engine *Engine) URI(digest digest.Digest) (uri *url.URL, err error) {
-	values := map[string]interface{}{
-		"digest":    string(digest),
-		"algorithm": string(digest.Algorithm()),
-		"encoded":   digest.Encoded(),
+	return engine.URIWithVariables(digest, nil)
+}
+
+// URIWithVariables is like URI, but it also expands the URI Template
+// with additional caller-supplied variables.  Templates may address
+// blobs by query parameter, e.g. "blob?digest={digest}"; simple
+// expansion percent-encodes the digest's colon, which servers decode
+// when parsing the query.  The digest, algorithm,
+// and encoded variables are always set from digest, and take
+// precedence over entries in variables.  Returns an error if the URI
+// Template uses a variable which is not set, or if digest is rejected
+// by DigestCase.
+func (engine *Engine) URIWithVariables(digest digest.Digest, variables map[string]string) (uri *url.URL, err error) {
+	return engine.resolve(engine.base, digest, variables)
+}
+
+// resolve is like URIWithVariables, but it resolves relative
+// expansions against base instead of the engine's base URI.
+func (engine *Engine) resolve(base *url.URL, digest digest.Digest, variables map[string]string) (uri *url.URL, err error) {
+	digest, err = casengine.NormalizeDigest(digest, engine.DigestCase)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for key, value := range variables {
+		values[key] = value
+	}
+	values["digest"] = string(digest)
+	values["algorithm"] = string(digest.Algorithm())
+	values["encoded"] = digest.Encoded()
+
+	for _, name := range engine.uri.Names() {
+		_, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("URI Template variable %q is not set", name)
+		}
 	}
 
 	referenceURI, err := engine.uri.Expand(values)
@@ -125,25 +531,64 @@ func (engine *Engine) URI(digest digest.Digest) (uri *url.URL, err error) {
 		return nil, err
 	}
 
-	if !parsedReference.IsAbs() && engine.base == nil {
+	if !parsedReference.IsAbs() && base == nil {
 		return nil, fmt.Errorf("cannot resolve relative %s without a base engine URI", parsedReference)
 	}
 
-	return engine.base.ResolveReference(parsedReference), nil
+	if engine.DirectoryBase && base != nil && parsedReference.Path != "" && !strings.HasSuffix(base.Path, "/") {
+		directory := *base
+		directory.Path += "/"
+		if directory.RawPath != "" {
+			directory.RawPath += "/"
+		}
+		base = &directory
+	}
+
+	return base.ResolveReference(parsedReference), nil
 }
 
-func (engine *Engine) getPreFetch(digest digest.Digest) (request *http.Request, err error) {
-	uri, err := engine.URI(digest)
+func (engine *Engine) getPreFetch(digest digest.Digest, variables map[string]string) (request *http.Request, err error) {
+	return engine.getPreFetchFrom(engine.base, digest, variables)
+}
+
+// getPreFetchFrom is like getPreFetch, but it resolves relative
+// expansions against base instead of the engine's base URI.
+func (engine *Engine) getPreFetchFrom(base *url.URL, digest digest.Digest, variables map[string]string) (request *http.Request, err error) {
+	uri, err := engine.resolve(base, digest, variables)
 	if err != nil {
 		return nil, err
 	}
 
+	engine.logger().WithFields(logrus.Fields{
+		"digest":    digest,
+		"algorithm": digest.Algorithm(),
+		"encoded":   digest.Encoded(),
+		"uri":       uri.String(),
+	}).Debug("resolved URI Template")
+
+	if engine.SignURL != nil {
+		signed, err := engine.SignURL(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign %s: %w", uri, err)
+		}
+		uri = signed
+	}
+
 	return &http.Request{
 		Method: "GET",
 		URL:    uri,
 	}, nil
 }
 
+// logger returns Logger or, if it is not set, the logrus standard
+// logger.
+func (engine *Engine) logger() (logger logrus.FieldLogger) {
+	if engine.Logger == nil {
+		return logrus.StandardLogger()
+	}
+	return engine.Logger
+}
+
 func (engine *Engine) getPostFetch(response *http.Response, digest digest.Digest) (reader io.ReadCloser, err error) {
 	defer func() {
 		if err != nil {
@@ -152,16 +597,59 @@ func (engine *Engine) getPostFetch(response *http.Response, digest digest.Digest
 	}()
 
 	if response.StatusCode == http.StatusNotFound {
-		return nil, os.ErrNotExist
+		return nil, fmt.Errorf("%s not found at %s: %w", digest, response.Request.URL, os.ErrNotExist)
 	}
 
 	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
 		return nil, fmt.Errorf("requested %s but got %s", response.Request.URL, response.Status)
 	}
 
-	return response.Body, nil
+	if response.ContentLength > 0 {
+		return engine.readAhead(&lengthCheckingReader{
+			ReadCloser: response.Body,
+			uri:        response.Request.URL,
+			expected:   response.ContentLength,
+		}), nil
+	}
+
+	return engine.readAhead(response.Body), nil
+}
+
+// readAhead wraps reader in a ReadAheadSize buffer, if ReadAheadSize
+// is positive.
+func (engine *Engine) readAhead(reader io.ReadCloser) io.ReadCloser {
+	if engine.ReadAheadSize <= 0 {
+		return reader
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: bufio.NewReaderSize(reader, engine.ReadAheadSize),
+		Closer: reader,
+	}
+}
+
+// lengthCheckingReader returns an error wrapping ErrTruncated if its
+// content ends before the expected length.
+type lengthCheckingReader struct {
+	io.ReadCloser
+	uri      *url.URL
+	expected int64
+	count    int64
+}
+
+// Read implements io.Reader.Read.
+func (reader *lengthCheckingReader) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	reader.count += int64(n)
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && reader.count < reader.expected {
+		return n, fmt.Errorf("%w: received %d of %d bytes from %s", ErrTruncated, reader.count, reader.expected, reader.uri)
+	}
+	return n, err
 }
 
 func init() {
-	read.Constructors["oci-cas-template-v1"] = New
+	read.Register("oci-cas-template-v1", read.ReadOnly, New)
 }
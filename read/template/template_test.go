@@ -15,17 +15,25 @@
 package template
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
 	"github.com/wking/casengine/read"
 	"github.com/xiekeyang/oci-discovery/tools/engine"
 	"golang.org/x/net/context"
@@ -34,10 +42,11 @@ import (
 )
 
 func TestRegistration(t *testing.T) {
-	_, ok := read.Constructors["oci-cas-template-v1"]
+	constructor, ok := read.Constructors["oci-cas-template-v1"]
 	if !ok {
 		t.Fatalf("failed to register oci-cas-template-v1")
 	}
+	assert.Equal(t, read.ReadOnly, constructor.Capability)
 }
 
 func TestNewFromEngineConfigGood(t *testing.T) {
@@ -184,7 +193,7 @@ func TestGetPreFetchGood(t *testing.T) {
 			}
 			defer engine.Close(ctx)
 
-			request, err := engine.(*Engine).getPreFetch(digest)
+			request, err := engine.(*Engine).getPreFetch(digest, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -205,6 +214,61 @@ func TestGetPreFetchGood(t *testing.T) {
 	}
 }
 
+func TestDirectoryBase(t *testing.T) {
+	ctx := context.Background()
+	digest, err := digest.Parse("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := url.Parse("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		template      string
+		directoryBase bool
+		expected      string
+	}{
+		{
+			template:      "{algorithm}/{encoded}",
+			directoryBase: false,
+			expected:      "https://example.com/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			template:      "{algorithm}/{encoded}",
+			directoryBase: true,
+			expected:      "https://example.com/a/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			template:      "/{algorithm}/{encoded}",
+			directoryBase: true,
+			expected:      "https://example.com/sha256/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+	} {
+		name := fmt.Sprintf("%s with directory base %t", testcase.template, testcase.directoryBase)
+		t.Run(name, func(t *testing.T) {
+			engine, err := New(ctx, base, map[string]string{
+				"uri": testcase.template,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).DirectoryBase = testcase.directoryBase
+
+			uri, err := engine.(*Engine).URI(digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, testcase.expected, uri.String())
+			assert.Equal(t, "https://example.com/a", base.String())
+		})
+	}
+}
+
 func TestGetPreFetchBad(t *testing.T) {
 	ctx := context.Background()
 	for _, testcase := range []struct {
@@ -225,6 +289,12 @@ func TestGetPreFetchBad(t *testing.T) {
 			digest:   "some-algorithm:0123456789abcdef",
 			expected: "cannot resolve relative 0123456789abcdef without a base engine URI",
 		},
+		{
+			name:     "unset variable",
+			uri:      "https://example.com/{repo}/{encoded}",
+			digest:   "sha256:0123456789abcdef",
+			expected: `^URI Template variable "repo" is not set$`,
+		},
 		//{
 		//	name:     "no colon in digest",
 		//	uri:      "{algorithm}",
@@ -243,7 +313,7 @@ func TestGetPreFetchBad(t *testing.T) {
 			}
 			defer engine.Close(ctx)
 
-			request, err := engine.(*Engine).getPreFetch(testcase.digest)
+			request, err := engine.(*Engine).getPreFetch(testcase.digest, nil)
 			if err == nil {
 				t.Fatalf("returned %s and did not raise the expected error", request.URL)
 			}
@@ -252,6 +322,36 @@ func TestGetPreFetchBad(t *testing.T) {
 	}
 }
 
+func TestGetPreFetchLogging(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := New(ctx, nil, map[string]string{
+		"uri": "https://example.com/blobs/{algorithm}/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	logger, hook := logrustest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	engine.(*Engine).Logger = logger
+
+	_, err = engine.(*Engine).getPreFetch("sha256:0123456789abcdef", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("no log entry")
+	}
+	assert.Equal(t, logrus.DebugLevel, entry.Level)
+	assert.Equal(t, "https://example.com/blobs/sha256/0123456789abcdef", entry.Data["uri"])
+	assert.Equal(t, digest.Algorithm("sha256"), entry.Data["algorithm"])
+	assert.Equal(t, "0123456789abcdef", entry.Data["encoded"])
+}
+
 func TestGetPostFetchGood(t *testing.T) {
 	ctx := context.Background()
 	config := map[string]string{
@@ -347,7 +447,7 @@ func TestGetPostFetchBad(t *testing.T) {
 			label:    "blob not found",
 			status:   "404 Not Found",
 			body:     "",
-			expected: `file does not exist`,
+			expected: `^sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 not found at https://example.com/blob: file does not exist$`,
 		},
 		{
 			label:    "server error",
@@ -435,6 +535,868 @@ func TestGet(t *testing.T) {
 		}
 
 		_, err = engine.Get(ctx, digest)
-		assert.Equal(t, os.ErrNotExist, err)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+		}
+		assert.Contains(t, err.Error(), "file:///e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	})
+}
+
+func TestGetWithVariables(t *testing.T) {
+	ctx := context.Background()
+	bodyIn := "Hello, World!"
+	digest := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	fakeFS := httpfs.New(mapfs.New(map[string]string{
+		"library/hello/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f": bodyIn,
+	}))
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", http.NewFileTransport(fakeFS))
+
+	config := map[string]string{
+		"uri": "file:///{+repo}/{encoded}",
+	}
+
+	engine, err := New(ctx, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	engine.(*Engine).Client = &http.Client{
+		Transport: transport,
+	}
+
+	t.Run("variable set", func(t *testing.T) {
+		reader, err := engine.(*Engine).GetWithVariables(ctx, digest, map[string]string{
+			"repo": "library/hello",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		bodyOut, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, bodyIn, string(bodyOut))
+	})
+
+	t.Run("variable unset", func(t *testing.T) {
+		_, err := engine.Get(ctx, digest)
+		if err == nil {
+			t.Fatal("expected an error for the unset 'repo' variable")
+		}
+		assert.Equal(t, `URI Template variable "repo" is not set`, err.Error())
+	})
+}
+
+func TestGetTruncated(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("response writer does not support hijacking")
+			return
+		}
+
+		connection, buffer, err := hijacker.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer connection.Close()
+
+		fmt.Fprint(buffer, "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nHello")
+		buffer.Flush()
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"uri": "cas/{algorithm}/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	reader, err := engine.Get(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	_, err = ioutil.ReadAll(reader)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected an error matching %s, got %v", ErrTruncated, err)
+	}
+	assert.Regexp(t, `^truncated response body: received 5 of 13 bytes from http://.*/cas/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f$`, err.Error())
+}
+
+func TestGetSized(t *testing.T) {
+	ctx := context.Background()
+	bodyIn := "Hello, World!"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, bodyIn)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"uri": "cas/{algorithm}/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	t.Run("expected size", func(t *testing.T) {
+		reader, err := engine.(*Engine).GetSized(ctx, dig, int64(len(bodyIn)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		bodyOut, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, bodyIn, string(bodyOut))
+	})
+
+	t.Run("wrong size", func(t *testing.T) {
+		reader, err := engine.(*Engine).GetSized(ctx, dig, 12)
+		if !errors.Is(err, ErrSizeMismatch) {
+			t.Fatalf("expected an error matching %s, got %v", ErrSizeMismatch, err)
+		}
+		assert.Nil(t, reader)
+		assert.Regexp(t, `^unexpected response size: http://.*/cas/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f advertised 13 bytes, but 12 were expected$`, err.Error())
+	})
+}
+
+func TestGetQuery(t *testing.T) {
+	ctx := context.Background()
+	blobs := map[string]string{
+		"sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f": "Hello, World!",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, ok := blobs[request.URL.Query().Get("digest")]
+		if !ok {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL + "/blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		uri           string
+		directoryBase bool
+	}{
+		{
+			uri: server.URL + "/blob?digest={digest}",
+		},
+		{
+			uri: "?digest={digest}",
+		},
+		{
+			uri: "{?digest}",
+		},
+		{
+			uri:           "?digest={digest}",
+			directoryBase: true,
+		},
+	} {
+		t.Run(fmt.Sprintf("%s directory base %t", testcase.uri, testcase.directoryBase), func(t *testing.T) {
+			engine, err := New(ctx, base, map[string]string{
+				"uri": testcase.uri,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).DirectoryBase = testcase.directoryBase
+
+			request, err := engine.(*Engine).getPreFetch("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "/blob", request.URL.Path)
+			assert.Equal(t, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f", request.URL.Query().Get("digest"))
+
+			reader, err := engine.Get(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			body, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hello, World!", string(body))
+
+			_, err = engine.Get(ctx, "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+		})
+	}
+}
+
+func TestGetRetryBudget(t *testing.T) {
+	ctx := context.Background()
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = 100 * time.Millisecond }()
+
+	var mutex sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		attempts++
+		mutex.Unlock()
+		http.Error(writer, "try again later", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engines := []*Engine{}
+	for i := 0; i < 3; i++ {
+		engine, err := New(ctx, base, map[string]string{
+			"uri": fmt.Sprintf("/%d/{algorithm}/{encoded}", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close(ctx)
+		engine.(*Engine).Retries = 3
+		engines = append(engines, engine.(*Engine))
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		budget   *casengine.RetryBudget
+		expected int
+	}{
+		{
+			name:     "no budget",
+			expected: 3 * (1 + 3),
+		},
+		{
+			name:     "budget",
+			budget:   casengine.NewRetryBudget(4),
+			expected: 3 + 4,
+		},
+		{
+			name:     "empty budget",
+			budget:   casengine.NewRetryBudget(0),
+			expected: 3,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			mutex.Lock()
+			attempts = 0
+			mutex.Unlock()
+
+			ctx := ctx
+			if testcase.budget != nil {
+				ctx = casengine.WithRetryBudget(ctx, testcase.budget)
+			}
+
+			for _, engine := range engines {
+				_, err := engine.Get(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+				assert.Error(t, err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Equal(t, testcase.expected, attempts)
+		})
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var mutex sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		hits++
+		mutex.Unlock()
+		writer.Write([]byte("Hello, World!"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"uri": "{algorithm}/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	_, err = engine.Get(ctx, "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	assert.Equal(t, context.Canceled, err)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 0, hits)
+}
+
+func TestGetRange(t *testing.T) {
+	ctx := context.Background()
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	for _, testcase := range []struct {
+		name         string
+		offset       int64
+		length       int64
+		contentRange string
+		body         string
+		status       int
+		expected     string
+		err          string
+	}{
+		{
+			name:         "correct Content-Range",
+			offset:       7,
+			length:       5,
+			contentRange: "bytes 7-11/13",
+			body:         "World",
+			status:       http.StatusPartialContent,
+			expected:     "World",
+		},
+		{
+			name:         "correct Content-Range without a total",
+			offset:       7,
+			length:       5,
+			contentRange: "bytes 7-11/*",
+			body:         "World",
+			status:       http.StatusPartialContent,
+			expected:     "World",
+		},
+		{
+			name:         "range past the end",
+			offset:       7,
+			length:       100,
+			contentRange: "bytes 7-12/13",
+			body:         "World!",
+			status:       http.StatusPartialContent,
+			expected:     "World!",
+		},
+		{
+			name:         "range through the end",
+			offset:       7,
+			length:       -1,
+			contentRange: "bytes 7-12/13",
+			body:         "World!",
+			status:       http.StatusPartialContent,
+			expected:     "World!",
+		},
+		{
+			name:     "ignored Range",
+			offset:   7,
+			length:   5,
+			body:     "Hello, World!",
+			status:   http.StatusOK,
+			expected: "World",
+		},
+		{
+			name:         "mismatched Content-Range",
+			offset:       7,
+			length:       5,
+			contentRange: "bytes 0-4/13",
+			body:         "Hello",
+			status:       http.StatusPartialContent,
+			err:          `^invalid Content-Range: requested 5 bytes from offset 7, but got "bytes 0-4/13" from http://.*$`,
+		},
+		{
+			name:         "mismatched total",
+			offset:       7,
+			length:       5,
+			contentRange: "bytes 7-11/10",
+			body:         "World",
+			status:       http.StatusPartialContent,
+			err:          `^invalid Content-Range: malformed "bytes 7-11/10" from http://.*$`,
+		},
+		{
+			name:         "malformed Content-Range",
+			offset:       7,
+			length:       5,
+			contentRange: "bytes seven-eleven",
+			body:         "World",
+			status:       http.StatusPartialContent,
+			err:          `^invalid Content-Range: malformed "bytes seven-eleven" from http://.*$`,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var requestedRange string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestedRange = r.Header.Get("Range")
+				if testcase.contentRange != "" {
+					w.Header().Set("Content-Range", testcase.contentRange)
+				}
+				w.WriteHeader(testcase.status)
+				fmt.Fprint(w, testcase.body)
+			}))
+			defer server.Close()
+
+			base, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			engine, err := New(ctx, base, map[string]string{
+				"uri": "cas/{algorithm}/{encoded}",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			reader, err := engine.(*Engine).GetRange(ctx, dig, testcase.offset, testcase.length)
+			if testcase.err != "" {
+				if !errors.Is(err, ErrContentRange) {
+					t.Fatalf("expected an error matching %s, got %v", ErrContentRange, err)
+				}
+				assert.Nil(t, reader)
+				assert.Regexp(t, testcase.err, err.Error())
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			if testcase.length < 0 {
+				assert.Equal(t, fmt.Sprintf("bytes=%d-", testcase.offset), requestedRange)
+			} else {
+				assert.Equal(t, fmt.Sprintf("bytes=%d-%d", testcase.offset, testcase.offset+testcase.length-1), requestedRange)
+			}
+
+			bodyOut, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, string(bodyOut))
+		})
+	}
+}
+
+func TestGetSignURL(t *testing.T) {
+	ctx := context.Background()
+	bodyIn := "Hello, World!"
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("signature") != "secret:"+r.URL.Path {
+			http.Error(w, "missing or invalid signature", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, bodyIn)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(uri *url.URL) (signed *url.URL, err error) {
+		signedURI := *uri
+		query := signedURI.Query()
+		query.Set("signature", "secret:"+uri.Path)
+		signedURI.RawQuery = query.Encode()
+		return &signedURI, nil
+	}
+
+	signError := errors.New("signing key unavailable")
+
+	for _, testcase := range []struct {
+		name          string
+		signURL       func(*url.URL) (*url.URL, error)
+		expectedError string
+	}{
+		{
+			name:    "signed",
+			signURL: sign,
+		},
+		{
+			name:          "unsigned",
+			expectedError: "403 Forbidden",
+		},
+		{
+			name: "signer error",
+			signURL: func(uri *url.URL) (signed *url.URL, err error) {
+				return nil, signError
+			},
+			expectedError: "signing key unavailable",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			engine, err := New(ctx, base, map[string]string{
+				"uri": "cas/{algorithm}/{encoded}",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).SignURL = testcase.signURL
+
+			reader, err := engine.Get(ctx, dig)
+			if testcase.expectedError != "" {
+				if err == nil {
+					reader.Close()
+					t.Fatal("unexpected success")
+				}
+				assert.Contains(t, err.Error(), testcase.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			bodyOut, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, bodyIn, string(bodyOut))
+
+			uri, err := engine.(*Engine).URI(dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "", uri.RawQuery)
+		})
+	}
+}
+
+func TestExistsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	present := map[string]bool{}
+	expected := map[digest.Digest]bool{}
+	for i := 0; i < 20; i++ {
+		dig := digest.FromString(fmt.Sprintf("blob %d", i))
+		present["/cas/"+dig.Encoded()] = true
+		expected[dig] = true
+		expected[digest.FromString(fmt.Sprintf("missing %d", i))] = false
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("unexpected %s request", r.Method)
+		}
+		if !present[r.URL.Path] {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"uri": "cas/{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	var digests []digest.Digest
+	for dig := range expected {
+		digests = append(digests, dig)
+	}
+
+	exists, err := engine.(*Engine).ExistsBatch(ctx, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, exists)
+}
+
+func TestDigestCase(t *testing.T) {
+	upper := digest.Digest("SHA256:DFFD6021BB2BD5B0AF676290809EC3A53191DD81C7F70A4B28688A362182986F")
+
+	for _, testcase := range []struct {
+		policy   casengine.CasePolicy
+		expected string
+	}{
+		{
+			policy:   casengine.CaseUnchecked,
+			expected: "https://example.com/SHA256/DFFD6021BB2BD5B0AF676290809EC3A53191DD81C7F70A4B28688A362182986F",
+		},
+		{
+			policy:   casengine.CaseFold,
+			expected: "https://example.com/sha256/dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
+		},
+		{
+			policy: casengine.CaseReject,
+		},
+	} {
+		t.Run(fmt.Sprintf("policy %d", testcase.policy), func(t *testing.T) {
+			engine, err := New(context.Background(), nil, map[string]string{
+				"uri": "https://example.com/{algorithm}/{encoded}",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine.(*Engine).DigestCase = testcase.policy
+
+			uri, err := engine.(*Engine).URI(upper)
+			if testcase.expected == "" {
+				if !errors.Is(err, casengine.ErrInvalidDigest) {
+					t.Fatalf("expected an error matching %s, got %v", casengine.ErrInvalidDigest, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, uri.String())
+		})
+	}
+}
+
+func TestGetMirrors(t *testing.T) {
+	ctx := context.Background()
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	bodyIn := "Hello, World!"
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL, err := url.Parse(down.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	missingURL, err := url.Parse(missing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, bodyIn)
+	}))
+	defer mirror.Close()
+	mirrorURL, err := url.Parse(mirror.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name    string
+		base    *url.URL
+		mirrors []*url.URL
+		found   bool
+	}{
+		{
+			name:    "down primary",
+			base:    downURL,
+			mirrors: []*url.URL{mirrorURL},
+			found:   true,
+		},
+		{
+			name:    "missing from primary",
+			base:    missingURL,
+			mirrors: []*url.URL{downURL, mirrorURL},
+			found:   true,
+		},
+		{
+			name:    "missing everywhere",
+			base:    downURL,
+			mirrors: []*url.URL{missingURL},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			engine, err := New(ctx, testcase.base, map[string]string{
+				"uri": "cas/{algorithm}/{encoded}",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			logger, hook := logrustest.NewNullLogger()
+			engine.(*Engine).Logger = logger
+			engine.(*Engine).Mirrors = testcase.mirrors
+
+			reader, err := engine.Get(ctx, dig)
+			if !testcase.found {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			bodyOut, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, bodyIn, string(bodyOut))
+
+			entry := hook.LastEntry()
+			if entry == nil {
+				t.Fatal("no log entry")
+			}
+			assert.Equal(t, "fetched blob from mirror", entry.Message)
+			assert.Equal(t, mirror.URL+"/cas/sha256/"+dig.Encoded(), entry.Data["uri"])
+		})
+	}
+}
+
+// readInChunks reads reader to the end with Reads of at most size
+// bytes.
+func readInChunks(reader io.Reader, size int) (data []byte, err error) {
+	chunk := make([]byte, size)
+	for {
+		n, err := reader.Read(chunk)
+		data = append(data, chunk[:n]...)
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+}
+
+// newReadAheadServer serves a pseudo-random blob of size bytes,
+// returning the server and the blob's digest.
+func newReadAheadServer(size int) (server *httptest.Server, dig digest.Digest, bodyIn []byte) {
+	bodyIn = make([]byte, size)
+	for i := range bodyIn {
+		bodyIn[i] = byte(i * 7)
+	}
+	dig = digest.FromBytes(bodyIn)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bodyIn)
+	}))
+	return server, dig, bodyIn
+}
+
+func TestReadAhead(t *testing.T) {
+	ctx := context.Background()
+	server, dig, bodyIn := newReadAheadServer(1 << 16)
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, readAheadSize := range []string{"0", "4096"} {
+		t.Run(readAheadSize, func(t *testing.T) {
+			engine, err := New(ctx, base, map[string]interface{}{
+				"uri":           "cas/{algorithm}/{encoded}",
+				"readAheadSize": readAheadSize,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			assert.Equal(t, readAheadSize, strconv.Itoa(engine.(*Engine).ReadAheadSize))
+
+			reader, err := engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			verifier := dig.Verifier()
+			bodyOut, err := readInChunks(io.TeeReader(reader, verifier), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, bodyIn, bodyOut)
+			assert.True(t, verifier.Verified())
+		})
+	}
+
+	_, err = New(ctx, base, map[string]string{
+		"uri":           "cas/{algorithm}/{encoded}",
+		"readAheadSize": "big",
 	})
+	assert.Error(t, err)
+}
+
+func BenchmarkReadAhead(b *testing.B) {
+	ctx := context.Background()
+	server, dig, _ := newReadAheadServer(1 << 20)
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, readAheadSize := range []int{0, 32 << 10} {
+		b.Run(fmt.Sprintf("read-ahead %d", readAheadSize), func(b *testing.B) {
+			engine, err := New(ctx, base, map[string]string{
+				"uri": "cas/{algorithm}/{encoded}",
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer engine.Close(ctx)
+			engine.(*Engine).ReadAheadSize = readAheadSize
+
+			b.SetBytes(1 << 20)
+			for i := 0; i < b.N; i++ {
+				reader, err := engine.Get(ctx, dig)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = readInChunks(reader, 16)
+				reader.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
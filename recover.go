@@ -0,0 +1,101 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// ErrPanic is returned by the Recovering* wrappers when the wrapped
+// engine panics.
+var ErrPanic = errors.New("engine panicked")
+
+// RecoveringReadCloser wraps a ReadCloser, converting panics in its
+// methods into errors wrapping ErrPanic and logging the panicking
+// stack.  This is a safety net which keeps one misbehaving engine
+// from crashing a process which is falling back between several
+// engines.  It is not a correctness guarantee: the wrapped engine
+// may be left in an inconsistent state, and panics in the readers it
+// returns are not recovered.
+type RecoveringReadCloser struct {
+	ReadCloser
+}
+
+// Get implements Reader.Get.
+func (engine *RecoveringReadCloser) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	defer recoverPanic("Get", &err)
+	return engine.ReadCloser.Get(ctx, digest)
+}
+
+// Close implements Closer.Close.
+func (engine *RecoveringReadCloser) Close(ctx context.Context) (err error) {
+	defer recoverPanic("Close", &err)
+	return engine.ReadCloser.Close(ctx)
+}
+
+// RecoveringEngine is like RecoveringReadCloser, but it wraps all of
+// the Engine methods.
+type RecoveringEngine struct {
+	Engine
+}
+
+// Get implements Reader.Get.
+func (engine *RecoveringEngine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	defer recoverPanic("Get", &err)
+	return engine.Engine.Get(ctx, digest)
+}
+
+// Algorithms implements AlgorithmLister.Algorithms.
+func (engine *RecoveringEngine) Algorithms(ctx context.Context, prefix string, size int, from int, callback AlgorithmCallback) (err error) {
+	defer recoverPanic("Algorithms", &err)
+	return engine.Engine.Algorithms(ctx, prefix, size, from, callback)
+}
+
+// Put implements Writer.Put.
+func (engine *RecoveringEngine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	defer recoverPanic("Put", &err)
+	return engine.Engine.Put(ctx, algorithm, reader)
+}
+
+// Delete implements Deleter.Delete.
+func (engine *RecoveringEngine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	defer recoverPanic("Delete", &err)
+	return engine.Engine.Delete(ctx, digest)
+}
+
+// Close implements Closer.Close.
+func (engine *RecoveringEngine) Close(ctx context.Context) (err error) {
+	defer recoverPanic("Close", &err)
+	return engine.Engine.Close(ctx)
+}
+
+// recoverPanic must be deferred.  If the calling method is panicking,
+// it logs the stack and sets *err to an error wrapping ErrPanic.
+func recoverPanic(method string, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	logrus.Errorf("recovered from a panic in %s: %v\n%s", method, value, debug.Stack())
+	*err = fmt.Errorf("%w in %s: %v", ErrPanic, method, value)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casengine
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// panickingEngine is an Engine whose methods all panic.
+type panickingEngine struct{}
+
+func (engine panickingEngine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	panic("Get is broken")
+}
+
+func (engine panickingEngine) Algorithms(ctx context.Context, prefix string, size int, from int, callback AlgorithmCallback) (err error) {
+	panic("Algorithms is broken")
+}
+
+func (engine panickingEngine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	panic("Put is broken")
+}
+
+func (engine panickingEngine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	panic("Delete is broken")
+}
+
+func (engine panickingEngine) Close(ctx context.Context) (err error) {
+	panic("Close is broken")
+}
+
+func TestRecoveringEngine(t *testing.T) {
+	ctx := context.Background()
+	engine := &RecoveringEngine{Engine: panickingEngine{}}
+	dig := digest.FromString("Hello, World!")
+
+	reader, err := engine.Get(ctx, dig)
+	assert.Nil(t, reader)
+	if !errors.Is(err, ErrPanic) {
+		t.Fatalf("expected an error matching %s, got %v", ErrPanic, err)
+	}
+	assert.EqualError(t, err, "engine panicked in Get: Get is broken")
+
+	_, err = engine.Put(ctx, "", strings.NewReader("Hello, World!"))
+	assert.EqualError(t, err, "engine panicked in Put: Put is broken")
+
+	err = engine.Algorithms(ctx, "", -1, 0, nil)
+	assert.EqualError(t, err, "engine panicked in Algorithms: Algorithms is broken")
+
+	err = engine.Delete(ctx, dig)
+	assert.EqualError(t, err, "engine panicked in Delete: Delete is broken")
+
+	err = engine.Close(ctx)
+	assert.EqualError(t, err, "engine panicked in Close: Close is broken")
+}
+
+func TestRecoveringReadCloser(t *testing.T) {
+	ctx := context.Background()
+	engine := &RecoveringReadCloser{ReadCloser: panickingEngine{}}
+
+	_, err := engine.Get(ctx, digest.FromString("Hello, World!"))
+	assert.EqualError(t, err, "engine panicked in Get: Get is broken")
+
+	err = engine.Close(ctx)
+	assert.EqualError(t, err, "engine panicked in Close: Close is broken")
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package route implements a CAS engine which dispatches to wrapped
+// engines by digest algorithm, e.g. to keep sha256 blobs on fast local
+// disk and sha512 blobs in object storage.
+package route
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wking/casengine"
+	"golang.org/x/net/context"
+)
+
+// errStop is returned by callbacks to stop listing once a page is
+// full.
+var errStop = errors.New("stop listing")
+
+// Engine implements casengine.DigestListerEngine by routing each
+// digest to the engine for its algorithm.
+type Engine struct {
+	// Engines maps algorithms to the engines which store their blobs.
+	Engines map[digest.Algorithm]casengine.DigestListerEngine
+
+	// Default, if set, stores blobs for algorithms which are not in
+	// Engines.  Puts with an empty algorithm also go to Default,
+	// which picks its preferred algorithm.
+	Default casengine.DigestListerEngine
+}
+
+// engine returns the engine for algorithm.
+func (engine *Engine) engine(algorithm digest.Algorithm) (backend casengine.DigestListerEngine, err error) {
+	backend, ok := engine.Engines[algorithm]
+	if ok {
+		return backend, nil
+	}
+	if engine.Default == nil {
+		return nil, fmt.Errorf("no engine for algorithm %q", algorithm)
+	}
+	return engine.Default, nil
+}
+
+// backends returns each distinct wrapped engine once.
+func (engine *Engine) backends() (backends []casengine.DigestListerEngine) {
+	seen := map[casengine.DigestListerEngine]bool{}
+	if engine.Default != nil {
+		seen[engine.Default] = true
+		backends = append(backends, engine.Default)
+	}
+	for _, backend := range engine.Engines {
+		if !seen[backend] {
+			seen[backend] = true
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// Get implements casengine.Reader.Get.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	backend, err := engine.engine(digest.Algorithm())
+	if err != nil {
+		return nil, err
+	}
+	return backend.Get(ctx, digest)
+}
+
+// Put implements casengine.Writer.Put.
+func (engine *Engine) Put(ctx context.Context, algorithm digest.Algorithm, reader io.Reader) (dig digest.Digest, err error) {
+	backend, err := engine.engine(algorithm)
+	if err != nil {
+		return "", err
+	}
+	return backend.Put(ctx, algorithm, reader)
+}
+
+// Delete implements casengine.Deleter.Delete.
+func (engine *Engine) Delete(ctx context.Context, digest digest.Digest) (err error) {
+	backend, err := engine.engine(digest.Algorithm())
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, digest)
+}
+
+// algorithms returns the algorithms which the wrapped engines list,
+// keeping only those routed to the listing engine.  The result is in
+// digest order, so algorithms which are prefixes of other algorithms
+// sort as their digests do.
+func (engine *Engine) algorithms(ctx context.Context) (algorithms []digest.Algorithm, err error) {
+	seen := map[digest.Algorithm]bool{}
+	for _, backend := range engine.backends() {
+		err = backend.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+			routed, err := engine.engine(algorithm)
+			if err == nil && routed == backend && !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(algorithms, func(i, j int) bool {
+		return algorithms[i].String()+":" < algorithms[j].String()+":"
+	})
+	return algorithms, nil
+}
+
+// Algorithms implements casengine.AlgorithmLister.Algorithms.
+func (engine *Engine) Algorithms(ctx context.Context, prefix string, size int, from int, callback casengine.AlgorithmCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	algorithms, err := engine.algorithms(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(algorithms, func(i, j int) bool {
+		return algorithms[i] < algorithms[j]
+	})
+
+	offset := 0
+	count := 0
+	for _, algorithm := range algorithms {
+		if prefix == "" || strings.HasPrefix(algorithm.String(), prefix) {
+			if offset >= from {
+				err = callback(ctx, algorithm)
+				if err != nil {
+					return err
+				}
+				count++
+				if size != -1 && count >= size {
+					return nil
+				}
+			}
+			offset++
+		}
+	}
+	return nil
+}
+
+// Digests implements casengine.DigestLister.Digests.  Results from
+// the wrapped engines are merged, with size and from applying to the
+// merged list.
+func (engine *Engine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	if size == 0 {
+		return nil
+	}
+
+	if algorithm != "" {
+		backend, err := engine.engine(algorithm)
+		if err != nil {
+			return err
+		}
+		return backend.Digests(ctx, algorithm, prefix, size, from, callback)
+	}
+
+	algorithms, err := engine.algorithms(ctx)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	count := 0
+	for _, algorithm := range algorithms {
+		backend, err := engine.engine(algorithm)
+		if err != nil {
+			return err
+		}
+
+		err = backend.Digests(ctx, algorithm, prefix, -1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+			if offset < from {
+				offset++
+				return nil
+			}
+			err = callback(ctx, digest)
+			if err != nil {
+				return err
+			}
+			count++
+			if size != -1 && count >= size {
+				return errStop
+			}
+			return nil
+		})
+		if errors.Is(err, errStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements casengine.Closer.Close.  It closes each wrapped
+// engine once.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	var errs []error
+	for _, backend := range engine.backends() {
+		err = backend.Close(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/memory"
+	"golang.org/x/net/context"
+)
+
+func TestRoute(t *testing.T) {
+	ctx := context.Background()
+
+	fast, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &Engine{
+		Engines: map[digest.Algorithm]casengine.DigestListerEngine{
+			digest.SHA512: slow,
+		},
+		Default: fast,
+	}
+	defer engine.Close(ctx)
+
+	var expected []string
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+			dig, err := engine.Put(ctx, algorithm, strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, dig.String())
+
+			backend, other := casengine.DigestListerEngine(fast), casengine.DigestListerEngine(slow)
+			if algorithm == digest.SHA512 {
+				backend, other = other, backend
+			}
+
+			reader, err := backend.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.Close()
+
+			_, err = other.Get(ctx, dig)
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+
+			reader, err = engine.Get(ctx, dig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, content, string(data))
+		}
+	}
+
+	sort.Strings(expected)
+
+	for _, testcase := range []struct {
+		name      string
+		algorithm digest.Algorithm
+		size      int
+		from      int
+		expected  []string
+	}{
+		{
+			name:     "all",
+			size:     -1,
+			expected: expected,
+		},
+		{
+			name:     "page across backends",
+			size:     2,
+			from:     1,
+			expected: expected[1:3],
+		},
+		{
+			name:      "one algorithm",
+			algorithm: digest.SHA512,
+			size:      -1,
+			expected:  expected[2:],
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var digests []string
+			err := engine.Digests(ctx, testcase.algorithm, "", testcase.size, testcase.from, func(ctx context.Context, digest digest.Digest) (err error) {
+				digests = append(digests, digest.String())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testcase.expected, digests)
+		})
+	}
+
+	var algorithms []digest.Algorithm
+	err = engine.Algorithms(ctx, "", -1, 0, func(ctx context.Context, algorithm digest.Algorithm) (err error) {
+		algorithms = append(algorithms, algorithm)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []digest.Algorithm{digest.SHA256, digest.SHA512}, algorithms)
+}
+
+// wrappingEngine wraps the errors returned by its Digests callback.
+type wrappingEngine struct {
+	casengine.DigestListerEngine
+}
+
+func (engine *wrappingEngine) Digests(ctx context.Context, algorithm digest.Algorithm, prefix string, size int, from int, callback casengine.DigestCallback) (err error) {
+	return engine.DigestListerEngine.Digests(ctx, algorithm, prefix, size, from, func(ctx context.Context, digest digest.Digest) (err error) {
+		err = callback(ctx, digest)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", digest, err)
+		}
+		return nil
+	})
+}
+
+func TestDigestsWrappedStop(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := memory.NewEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &Engine{
+		Default: &wrappingEngine{DigestListerEngine: backend},
+	}
+	defer engine.Close(ctx)
+
+	for _, content := range []string{"Hello, World!", "Goodbye, World!"} {
+		_, err = engine.Put(ctx, "", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var digests []digest.Digest
+	err = engine.Digests(ctx, "", "", 1, 0, func(ctx context.Context, digest digest.Digest) (err error) {
+		digests = append(digests, digest)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, digests, 1)
+}
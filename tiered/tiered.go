@@ -0,0 +1,250 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tiered implements a read-only CAS engine which checks a
+// local directory tier before falling back to a remote template
+// tier.  Blobs retrieved from the remote tier are written back to the
+// local tier, so later Gets are served locally.
+package tiered
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/dir"
+	"github.com/wking/casengine/read"
+	"github.com/wking/casengine/read/template"
+	"golang.org/x/net/context"
+)
+
+// Engine implements casengine.ReadCloser with a local and a remote
+// tier.
+type Engine struct {
+	// Local is the local tier, which is checked first and populated
+	// with blobs retrieved from Remote.
+	Local *dir.Engine
+
+	// Remote is the remote tier.
+	Remote casengine.ReadCloser
+
+	// MaxSize, if positive, is the size in bytes of the largest blob
+	// which will be written back to Local.  Larger blobs are served
+	// from Remote without being cached.
+	MaxSize int64
+}
+
+// New creates a new tiered CAS-engine instance.  The baseURI is used
+// to resolve the remote URI Template.  The config must be a
+// map[string]string or a map[string]interface{} with string values.
+// The required 'path' property is the local directory, which stores
+// blobs under blobs/{algorithm}/{encoded:2}/{encoded}.  The required
+// 'uri' property is the remote URI Template, as for the
+// oci-cas-template-v1 protocol.  The optional 'maxSize' property sets
+// MaxSize.
+func New(ctx context.Context, baseURI *url.URL, config interface{}) (engine casengine.ReadCloser, err error) {
+	configMap, ok := config.(map[string]string)
+	if !ok {
+		configMap2, ok := config.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tiered config is not a map[string]string: %v", config)
+		}
+		configMap = make(map[string]string)
+		for key, value := range configMap2 {
+			configMap[key], ok = value.(string)
+			if !ok {
+				return nil, fmt.Errorf("tiered config %q is not a string: %v", key, value)
+			}
+		}
+	}
+
+	path, ok := configMap["path"]
+	if !ok {
+		return nil, fmt.Errorf("tiered config missing required 'path' property: %v", configMap)
+	}
+
+	uri, ok := configMap["uri"]
+	if !ok {
+		return nil, fmt.Errorf("tiered config missing required 'uri' property: %v", configMap)
+	}
+
+	var maxSize int64
+	maxSizeString, ok := configMap["maxSize"]
+	if ok {
+		maxSize, err = strconv.ParseInt(maxSizeString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tiered config 'maxSize' %q is not an integer: %s", maxSizeString, err)
+		}
+	}
+
+	remote, err := template.New(ctx, baseURI, map[string]string{
+		"uri": uri,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := dir.NewEngine(
+		ctx,
+		path,
+		fmt.Sprintf("file://%s/blobs/{algorithm}/{encoded:2}/{encoded}", path),
+	)
+	if err != nil {
+		remote.Close(ctx)
+		return nil, err
+	}
+
+	return &Engine{
+		Local:   local.(*dir.Engine),
+		Remote:  remote,
+		MaxSize: maxSize,
+	}, nil
+}
+
+// Get implements casengine.Reader.Get.  Blobs missing from Local are
+// streamed from Remote and written back to Local as the caller reads
+// them, so each blob is downloaded once.  The remote content is
+// verified against digest as it is read.  The write-back is abandoned
+// if the blob turns out to be larger than MaxSize, or if the caller
+// closes the reader before reaching the end of the blob.
+func (engine *Engine) Get(ctx context.Context, digest digest.Digest) (reader io.ReadCloser, err error) {
+	reader, err = engine.Local.Get(ctx, digest)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return reader, err
+	}
+
+	reader, err = engine.Remote.Get(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.writeBack(ctx, digest, reader), nil
+}
+
+// Close implements casengine.Closer.Close.
+func (engine *Engine) Close(ctx context.Context) (err error) {
+	err = engine.Local.Close(ctx)
+	err2 := engine.Remote.Close(ctx)
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeBack returns a reader which passes remote through to the
+// caller while storing its content in the local tier.
+func (engine *Engine) writeBack(ctx context.Context, digest digest.Digest, remote io.ReadCloser) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		result, err := engine.Local.PutInfo(ctx, digest.Algorithm(), pipeReader)
+		if err == nil && result.Digest != digest {
+			if result.Created {
+				err2 := engine.Local.Delete(ctx, result.Digest)
+				if err2 != nil {
+					logrus.Error(err2)
+				}
+			}
+			err = fmt.Errorf("remote tier returned %s for %s", result.Digest, digest)
+		}
+
+		// unblock the writer if PutInfo returned early
+		pipeReader.CloseWithError(err)
+		done <- err
+	}()
+
+	return &writeBackReader{
+		remote:   remote,
+		digest:   digest,
+		verifier: digest.Verifier(),
+		maxSize:  engine.MaxSize,
+		pipe:     pipeWriter,
+		done:     done,
+	}
+}
+
+// writeBackReader reads a blob from the remote tier, feeding it to a
+// local PutInfo through pipe.  pipe is nil once the write-back has
+// finished or been abandoned.
+type writeBackReader struct {
+	remote   io.ReadCloser
+	digest   digest.Digest
+	verifier digest.Verifier
+	maxSize  int64
+	count    int64
+	pipe     *io.PipeWriter
+	done     chan error
+}
+
+// Read implements io.Reader.Read.
+func (reader *writeBackReader) Read(p []byte) (n int, err error) {
+	n, err = reader.remote.Read(p)
+	if n > 0 {
+		reader.verifier.Write(p[:n])
+		reader.count += int64(n)
+		if reader.pipe != nil {
+			if reader.maxSize > 0 && reader.count > reader.maxSize {
+				logrus.Debugf("not caching %s, which is larger than %d bytes", reader.digest, reader.maxSize)
+				reader.abandon(fmt.Errorf("%s is larger than %d bytes", reader.digest, reader.maxSize))
+			} else {
+				_, err2 := reader.pipe.Write(p[:n])
+				if err2 != nil {
+					reader.abandon(err2)
+				}
+			}
+		}
+	}
+
+	if err == io.EOF {
+		if reader.pipe != nil {
+			reader.pipe.Close()
+			reader.pipe = nil
+			err2 := <-reader.done
+			if err2 != nil {
+				logrus.Warnf("failed to cache %s: %s", reader.digest, err2)
+			}
+		}
+		if !reader.verifier.Verified() {
+			return n, fmt.Errorf("%w: remote tier returned unexpected content for %s", casengine.ErrDigestMismatch, reader.digest)
+		}
+	}
+	return n, err
+}
+
+// abandon stops the write-back, waiting for PutInfo to discard what
+// it has written.
+func (reader *writeBackReader) abandon(err error) {
+	reader.pipe.CloseWithError(err)
+	reader.pipe = nil
+	err = <-reader.done
+	logrus.Debugf("abandoned caching %s: %s", reader.digest, err)
+}
+
+// Close implements io.Closer.Close.
+func (reader *writeBackReader) Close() (err error) {
+	if reader.pipe != nil {
+		reader.abandon(fmt.Errorf("%s closed before the end of the blob", reader.digest))
+	}
+	return reader.remote.Close()
+}
+
+func init() {
+	read.Register("oci-cas-tiered-v1", read.ReadOnly, New)
+}
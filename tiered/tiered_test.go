@@ -0,0 +1,175 @@
+// Copyright 2017 casengine contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/wking/casengine"
+	"github.com/wking/casengine/read"
+	"golang.org/x/net/context"
+)
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+	bodyIn := "Hello, World!"
+
+	for _, testcase := range []struct {
+		name           string
+		maxSize        string
+		cached         bool
+		remoteRequests int
+	}{
+		{
+			name:           "no size cap",
+			cached:         true,
+			remoteRequests: 1,
+		},
+		{
+			name:           "under size cap",
+			maxSize:        "13",
+			cached:         true,
+			remoteRequests: 1,
+		},
+		{
+			name:           "over size cap",
+			maxSize:        "12",
+			cached:         false,
+			remoteRequests: 2,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			temp, err := ioutil.TempDir("", "casengine-tiered-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(temp)
+
+			remoteRequests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteRequests++
+				if r.URL.Path != "/cas/"+dig.String() {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, bodyIn)
+			}))
+			defer server.Close()
+
+			base, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config := map[string]string{
+				"path": temp,
+				"uri":  "cas/{algorithm}:{encoded}",
+			}
+			if testcase.maxSize != "" {
+				config["maxSize"] = testcase.maxSize
+			}
+
+			engine, err := New(ctx, base, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer engine.Close(ctx)
+
+			for i := 0; i < 2; i++ {
+				reader, err := engine.Get(ctx, dig)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				bodyOut, err := ioutil.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, bodyIn, string(bodyOut))
+			}
+
+			assert.Equal(t, testcase.remoteRequests, remoteRequests)
+
+			_, err = engine.(*Engine).Local.Stat(ctx, dig)
+			if testcase.cached {
+				assert.Nil(t, err)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected an error matching %s, got %v", os.ErrNotExist, err)
+			}
+		})
+	}
+}
+
+func TestGetMismatch(t *testing.T) {
+	ctx := context.Background()
+	dig := digest.Digest("sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f")
+
+	temp, err := ioutil.TempDir("", "casengine-tiered-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Goodbye, World!")
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := New(ctx, base, map[string]string{
+		"path": temp,
+		"uri":  "cas/{algorithm}:{encoded}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close(ctx)
+
+	reader, err := engine.Get(ctx, dig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	reader.Close()
+	assert.True(t, errors.Is(err, casengine.ErrDigestMismatch), fmt.Sprint(err))
+
+	for _, stored := range []digest.Digest{dig, digest.FromString("Goodbye, World!")} {
+		_, err = engine.(*Engine).Local.Stat(ctx, stored)
+		assert.True(t, errors.Is(err, os.ErrNotExist), fmt.Sprint(err))
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	constructor, ok := read.Constructors["oci-cas-tiered-v1"]
+	if !ok {
+		t.Fatal("oci-cas-tiered-v1 is not registered")
+	}
+	assert.Equal(t, read.ReadOnly, constructor.Capability)
+}